@@ -2,7 +2,10 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"time"
@@ -10,7 +13,9 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/manifest"
 	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/scan"
 	"github.com/takoeight0821/ccbackup/internal/sync"
 )
 
@@ -30,44 +35,132 @@ func runBackup(cmd *cobra.Command, args []string) error {
 	verbose := viper.GetBool("verbose")
 	out := cmd.OutOrStdout()
 
+	if err := checkConfig(out, verbose); err != nil {
+		return err
+	}
+
 	sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
 	if err != nil {
 		return fmt.Errorf("expand source_dir: %w", err)
 	}
 
-	backupDir, err := paths.ExpandHome(viper.GetString("backup_dir"))
+	dest, err := openBackupDir(viper.GetString("backup_dir"))
 	if err != nil {
-		return fmt.Errorf("expand backup_dir: %w", err)
+		return err
 	}
+	backupDir := dest.Root
 
 	// Validate source directory exists
 	if _, err := os.Stat(sourceDir); os.IsNotExist(err) {
 		return fmt.Errorf("source directory does not exist: %s", sourceDir)
 	}
 
+	useCAS, err := casMode()
+	if err != nil {
+		return err
+	}
+	if err := checkHostNamespace(useCAS); err != nil {
+		return err
+	}
+	if err := checkSources(useCAS); err != nil {
+		return err
+	}
+	warnProjectLocal(out, useCAS)
+	if useCAS {
+		return runBackupCAS(cmd, dest, sourceDir, exec, verbose)
+	}
+
 	// Validate backup directory is initialized (only when executing)
-	if exec {
+	if exec && !dest.Remote {
 		gitDir := filepath.Join(backupDir, ".git")
 		if _, err := os.Stat(gitDir); os.IsNotExist(err) {
 			return fmt.Errorf("backup directory not initialized, run 'ccbackup init --exec' first")
 		}
 	}
 
-	includePatterns := viper.GetStringSlice("include")
+	sources, err := backupSources()
+	if err != nil {
+		return err
+	}
+
+	// With host_namespace, each machine writes to its own hosts/<host>/
+	host, err := currentHost()
+	if err != nil {
+		return err
+	}
+	root := hostRoot(backupDir, host)
+
+	// The Claude files kept in the projects themselves
+	local, err := projectLocalSources(sources[0].Dir)
+	if err != nil {
+		return err
+	}
+	sources = append(sources, local...)
+
+	// The last manifest has the source sizes of redacted copies, so that
+	// unchanged sources are not copied again
+	manifestPath := filepath.Join(root, manifest.Path)
+	var prev *manifest.Manifest
+	if dest.Remote {
+		prev, err = manifest.Latest(dest.FS, root)
+	} else {
+		prev, err = manifest.Read(dest.FS, manifestPath)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(out, "Warning: ignoring previous manifest: %v\n", err)
+	}
+	if err != nil {
+		prev = nil
+	}
+
+	var runs []*sourceSync
+	for _, source := range sources {
+		if _, err := os.Stat(source.Dir); source.Prefix != "" && os.IsNotExist(err) {
+			fmt.Fprintf(out, "Warning: source %s: root does not exist: %s\n", source.Name, source.Dir)
+			continue
+		}
+		syncer := sync.NewSyncer(source.Dir, source.backupDir(root), nil)
+		syncer.Filter = source.Filter
+		syncer.DstFS = dest.FS
+		syncer.DryRun = !exec
+		syncer.Verbose = verbose
+		sourcePrev := prev
+		if source.Prefix != "" {
+			sourcePrev = prev.Sub(source.Prefix)
+		}
+		syncer.Recorded = sourcePrev.Recorded
+		runs = append(runs, &sourceSync{source: source, syncer: syncer})
+	}
 
-	syncer := sync.NewSyncer(sourceDir, backupDir, includePatterns)
-	syncer.DryRun = !exec
-	syncer.Verbose = verbose
+	scanner, err := newSecretScanner()
+	if err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
 
 	ctx := context.Background()
 
-	if !exec {
-		// Dry-run: show what would be copied
-		plan, err := syncer.Plan(ctx)
+	plan, err := planSources(ctx, runs)
+	if err != nil {
+		return fmt.Errorf("plan: %w", err)
+	}
+
+	// Scan planned files for secrets before anything reaches the backup
+	var report *scan.Report
+	if scanner != nil {
+		report, err = scanPlan(scanner, plan)
 		if err != nil {
-			return fmt.Errorf("plan: %w", err)
+			return fmt.Errorf("scan: %w", err)
 		}
+		// Redact reads each file whole, so only when it can change one
+		if scanner.Redacts() {
+			for _, run := range runs {
+				run.syncer.Transform = scanner.Redact
+			}
+		}
+	}
 
+	if !exec {
+		// Dry-run: show what would be copied
 		for _, w := range plan.Warnings {
 			fmt.Fprintf(out, "Warning: %s: %v\n", w.RelPath, w.Err)
 		}
@@ -80,12 +173,25 @@ func runBackup(cmd *cobra.Command, args []string) error {
 		for _, item := range plan.Items {
 			fmt.Fprintf(out, "Would copy: %s (%s)\n", item.RelPath, formatSize(item.Size))
 		}
+		if report != nil {
+			printSecretReport(out, report)
+		}
 		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
 		return nil
 	}
 
+	if report != nil {
+		if blocked := report.Blocked(); len(blocked) > 0 {
+			printSecretReport(out, report)
+			return fmt.Errorf("backup blocked: %d secret(s) found by block rules", len(blocked))
+		}
+		if verbose || len(report.Findings) > 0 {
+			printSecretReport(out, report)
+		}
+	}
+
 	// Execute backup
-	result, err := syncer.Execute(ctx)
+	result, err := applySources(ctx, runs)
 	if err != nil {
 		return fmt.Errorf("sync: %w", err)
 	}
@@ -104,6 +210,29 @@ func runBackup(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(out, "Copied %d files (%s)\n", result.CopiedCount, formatSize(result.TotalBytes))
 	}
 
+	if dest.Remote {
+		// Remote stores have no git history; a manifest records the snapshot
+		m, err := buildManifest(dest, runs, nil, result)
+		if err != nil {
+			return err
+		}
+		name := manifest.SnapshotName(root, m.CreatedAt)
+		if err := m.Write(dest.FS, name); err != nil {
+			return fmt.Errorf("write manifest: %w", err)
+		}
+		fmt.Fprintf(out, "Wrote snapshot: %s\n", name)
+		return syncErrors(out, result)
+	}
+
+	// The manifest is committed with the data it describes
+	m, err := buildManifest(dest, runs, prev, result)
+	if err != nil {
+		return err
+	}
+	if err := m.Write(dest.FS, manifestPath); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
 	// Git commit
 	g := git.NewGit(backupDir)
 	if err := g.AddAll(); err != nil {
@@ -117,12 +246,20 @@ func runBackup(cmd *cobra.Command, args []string) error {
 
 	if hasChanges {
 		commitMsg := fmt.Sprintf("Backup %s", time.Now().Format("2006-01-02 15:04"))
+		if host != "" {
+			commitMsg += " on " + host
+		}
 		if err := g.Commit(commitMsg); err != nil {
 			return fmt.Errorf("git commit: %w", err)
 		}
 		fmt.Fprintf(out, "Committed: \"%s\"\n", commitMsg)
 	}
 
+	return syncErrors(out, result)
+}
+
+// syncErrors reports per-file failures and returns an error if there were any.
+func syncErrors(out io.Writer, result *sync.SyncResult) error {
 	if len(result.Errors) > 0 {
 		for _, e := range result.Errors {
 			fmt.Fprintf(out, "Failed: %s: %v\n", e.RelPath, e.Err)
@@ -133,6 +270,40 @@ func runBackup(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// buildManifest records the backup contents of every source with the mode
+// and modification time of their source files and the run's warnings.
+func buildManifest(dest *backupLocation, runs []*sourceSync, prev *manifest.Manifest, result *sync.SyncResult) (*manifest.Manifest, error) {
+	var m *manifest.Manifest
+	var sourceItems []sync.SyncItem
+	for _, run := range runs {
+		sourcePrev := prev
+		if run.source.Prefix != "" {
+			sourcePrev = prev.Sub(run.source.Prefix)
+		}
+		sm, err := manifest.Build(dest.FS, run.syncer.DstDir, run.syncer.Filter, sourcePrev)
+		if err != nil {
+			return nil, fmt.Errorf("build manifest: %s: %w", run.source.Name, err)
+		}
+		if m == nil {
+			m = sm
+		} else {
+			m.Merge(run.source.Prefix, sm)
+		}
+
+		listed, err := sync.List(run.syncer.SrcFS, run.syncer.SrcDir, run.syncer.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("build manifest: %s: %w", run.source.Name, err)
+		}
+		for _, item := range listed.Items {
+			item.RelPath = run.source.relPath(item.RelPath)
+			sourceItems = append(sourceItems, item)
+		}
+	}
+	m.UseSource(sourceItems, result.Errors)
+	m.AddWarnings(result.Errors)
+	return m, nil
+}
+
 func formatSize(bytes int64) string {
 	const (
 		KB = 1024
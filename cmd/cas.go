@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/cas"
+	"github.com/takoeight0821/ccbackup/internal/config"
+	"github.com/takoeight0821/ccbackup/internal/scan"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+// Repository modes selected by the "repository" config key.
+const (
+	repositoryGit = config.RepositoryGit
+	repositoryCAS = config.RepositoryCAS
+)
+
+// casMode reports whether backup_dir is a content-addressed repository.
+func casMode() (bool, error) {
+	switch mode := viper.GetString("repository"); mode {
+	case repositoryGit:
+		return false, nil
+	case repositoryCAS:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown repository %q (want %s or %s)", mode, repositoryGit, repositoryCAS)
+	}
+}
+
+// openCASRepository opens the CAS repository in backup_dir.
+func openCASRepository(dest *backupLocation) (*cas.Repository, error) {
+	repo, err := cas.Open(dest.FS, dest.Root)
+	if errors.Is(err, cas.ErrNotRepository) {
+		return nil, fmt.Errorf("backup directory not initialized, run 'ccbackup init --exec' first")
+	}
+	if err != nil {
+		return nil, err
+	}
+	repo.Compress = viper.GetBool("cas.compression")
+	return repo, nil
+}
+
+// openCASSnapshot returns a read-only view of a snapshot, or of the latest
+// one if id is empty. The view is nil if the repository has no snapshots.
+func openCASSnapshot(dest *backupLocation, id string) (*cas.Snapshot, storage.FS, error) {
+	repo, err := openCASRepository(dest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if id == "" {
+		id = "latest"
+	}
+	snap, err := repo.FindSnapshot(id)
+	if err != nil || snap == nil {
+		return nil, nil, err
+	}
+	return snap, cas.NewSnapshotFS(repo, snap), nil
+}
+
+// runBackupCAS stores changed files of sourceDir as a new snapshot.
+func runBackupCAS(cmd *cobra.Command, dest *backupLocation, sourceDir string, exec, verbose bool) error {
+	out := cmd.OutOrStdout()
+
+	var repo *cas.Repository
+	var parent *cas.Snapshot
+	repo, err := openCASRepository(dest)
+	switch {
+	case err == nil:
+		if parent, err = repo.FindSnapshot("latest"); err != nil {
+			return err
+		}
+	case exec:
+		return err
+	}
+
+	filter, err := sourceFilter()
+	if err != nil {
+		return err
+	}
+	srcFS := storage.NewOSFS()
+	listed, err := sync.List(srcFS, sourceDir, filter)
+	if err != nil {
+		return fmt.Errorf("plan: %w", err)
+	}
+	plan := &sync.PlanResult{Items: cas.Changed(listed.Items, parent), Warnings: listed.Warnings}
+
+	scanner, err := newSecretScanner()
+	if err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+	var report *scan.Report
+	var transform func(string, []byte) ([]byte, error)
+	if scanner != nil {
+		report, err = scanPlan(scanner, plan)
+		if err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		if scanner.Redacts() {
+			transform = scanner.Redact
+		}
+	}
+
+	for _, w := range plan.Warnings {
+		fmt.Fprintf(out, "Warning: %s: %v\n", w.RelPath, w.Err)
+	}
+	if len(plan.Items) == 0 {
+		fmt.Fprintln(out, "No changes to backup.")
+		return nil
+	}
+
+	if !exec {
+		for _, item := range plan.Items {
+			fmt.Fprintf(out, "Would store: %s (%s)\n", item.RelPath, formatSize(item.Size))
+		}
+		if report != nil {
+			printSecretReport(out, report)
+		}
+		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
+		return nil
+	}
+
+	if report != nil {
+		if blocked := report.Blocked(); len(blocked) > 0 {
+			printSecretReport(out, report)
+			return fmt.Errorf("backup blocked: %d secret(s) found by block rules", len(blocked))
+		}
+		if verbose || len(report.Findings) > 0 {
+			printSecretReport(out, report)
+		}
+	}
+
+	snap, stats, err := repo.Backup(context.Background(), srcFS, listed, parent, transform)
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	if verbose {
+		for _, item := range plan.Items {
+			fmt.Fprintf(out, "Stored: %s\n", item.RelPath)
+		}
+	}
+	fmt.Fprintf(out, "Stored %d changed files: %d new chunks (%s added)\n",
+		stats.ChangedFiles, stats.NewChunks, formatSize(stats.AddedBytes))
+	fmt.Fprintf(out, "Created snapshot %s (%d files, %s)\n", snap.ShortID(), len(snap.Files), formatSize(snap.Size()))
+
+	for _, w := range snap.Warnings {
+		fmt.Fprintf(out, "Error: %s: %s\n", w.Path, w.Message)
+	}
+	if len(snap.Warnings) > 0 {
+		return fmt.Errorf("%d file(s) failed", len(snap.Warnings))
+	}
+	return nil
+}
+
+// initCAS creates a content-addressed repository in backup_dir.
+func initCAS(cmd *cobra.Command, dest *backupLocation, backupDir string, exec, verbose bool) error {
+	out := cmd.OutOrStdout()
+	cfgPath := configFilePath()
+
+	if !exec {
+		fmt.Fprintf(out, "Would create config: %s\n", cfgPath)
+		fmt.Fprintf(out, "Would create CAS repository: %s\n", backupDir)
+		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
+		return nil
+	}
+
+	if err := ensureConfig(out, cfgPath, backupDir, nil, verbose); err != nil {
+		return err
+	}
+	if _, err := cas.Init(dest.FS, dest.Root); err != nil {
+		return fmt.Errorf("init repository: %w", err)
+	}
+	if verbose {
+		fmt.Fprintf(out, "Created CAS repository: %s\n", backupDir)
+	}
+
+	fmt.Fprintln(out, "Ready! Run 'ccbackup backup --exec' to start backing up.")
+	return nil
+}
@@ -1,11 +1,22 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/config"
 	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/profile"
+	"github.com/takoeight0821/ccbackup/internal/scan"
+	"github.com/takoeight0821/ccbackup/internal/usage"
+	"go.yaml.in/yaml/v3"
 )
 
 var configCmd = &cobra.Command{
@@ -26,14 +37,104 @@ var configPathCmd = &cobra.Command{
 	Run:   runConfigPath,
 }
 
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration",
+	Long: `Check config.yaml against the config schema and the effective settings:
+unknown keys, values of the wrong type, missing paths, a backup_dir inside
+source_dir and include patterns that match nothing. backup and restore run
+the same checks, except for the include patterns, and refuse to run on errors.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigValidate,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Show the value of a setting",
+	Long: `Show the value in effect of a setting, such as backup_dir or
+secrets.enabled, with defaults applied. Lists are printed one item per line.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runConfigGet,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a setting in the config file",
+	Long: `Set a string, boolean or number setting in config.yaml, keeping its
+comments and the order of its keys. The edited config is validated before
+it is written.`,
+	Example: "  ccbackup config set host_namespace true --exec",
+	Args:    cobra.ExactArgs(2),
+	RunE:    runConfigSet,
+}
+
+var configAddCmd = &cobra.Command{
+	Use:   "add <key> <value>",
+	Short: "Add a value to a list setting in the config file",
+	Long: `Add a value to a list setting, such as include or exclude, in
+config.yaml. If the file does not set the list yet, it starts from the
+list in effect, so adding to include keeps the default patterns.`,
+	Example: "  ccbackup config add include usage-data --exec",
+	Args:    cobra.ExactArgs(2),
+	RunE:    runConfigAdd,
+}
+
+var configExplainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Show where every setting in effect came from",
+	Long: `Show every setting in effect with the layer it came from: a default,
+the config file, a CCBACKUP_* environment variable or a flag. Values of
+lower layers that the setting overrides are listed below it. Settings no
+layer sets are left out.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigExplain,
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the config file to the current version",
+	Long: `Upgrade config.yaml from an older version, such as one without a
+version field, to the version this ccbackup writes: new default include
+patterns are added and renamed keys are moved. The previous file is kept
+as config.yaml.bak.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigMigrate,
+}
+
+var configRemoveCmd = &cobra.Command{
+	Use:     "remove <key> <value>",
+	Short:   "Remove a value from a list setting in the config file",
+	Example: "  ccbackup config remove include todos --exec",
+	Args:    cobra.ExactArgs(2),
+	RunE:    runConfigRemove,
+}
+
 func init() {
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(configShowCmd)
 	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configAddCmd)
+	configCmd.AddCommand(configRemoveCmd)
+	configCmd.AddCommand(configExplainCmd)
+	configCmd.AddCommand(configMigrateCmd)
+
+	configShowCmd.Flags().Bool("origin", false, "show where each setting came from, as config explain does")
+	configExplainCmd.Flags().String("format", "text", "output format (text, yaml or json)")
 }
 
 func runConfigShow(cmd *cobra.Command, args []string) error {
 	out := cmd.OutOrStdout()
+	if origin, _ := cmd.Flags().GetBool("origin"); origin {
+		settings, err := explainConfig(cmd)
+		if err != nil {
+			return err
+		}
+		writeSettings(out, settings)
+		return nil
+	}
 	sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
 	if err != nil {
 		sourceDir = viper.GetString("source_dir") + " (expansion failed)"
@@ -45,17 +146,79 @@ func runConfigShow(cmd *cobra.Command, args []string) error {
 
 	fmt.Fprintf(out, "source_dir: %s\n", sourceDir)
 	fmt.Fprintf(out, "backup_dir: %s\n", backupDir)
+	fmt.Fprintf(out, "repository: %s\n", viper.GetString("repository"))
+	if viper.GetString("repository") == repositoryCAS {
+		fmt.Fprintf(out, "cas:\n  compression: %t\n", viper.GetBool("cas.compression"))
+	}
+	fmt.Fprintf(out, "host_namespace: %t\n", viper.GetBool("host_namespace"))
+	if host, err := currentHost(); err != nil {
+		fmt.Fprintf(out, "host_id: %s (%v)\n", viper.GetString("host_id"), err)
+	} else if host != "" {
+		fmt.Fprintf(out, "host_id: %s\n", host)
+	}
 
 	fmt.Fprintln(out, "include:")
 	for _, pattern := range viper.GetStringSlice("include") {
 		fmt.Fprintf(out, "  - %s\n", pattern)
 	}
 
+	if exclude := viper.GetStringSlice("exclude"); len(exclude) > 0 {
+		fmt.Fprintln(out, "exclude:")
+		for _, pattern := range exclude {
+			fmt.Fprintf(out, "  - %s\n", pattern)
+		}
+	}
+
+	var sources []config.Source
+	if err := viper.UnmarshalKey("sources", &sources); err == nil && len(sources) > 0 {
+		fmt.Fprintln(out, "sources:")
+		for _, s := range sources {
+			if resolved, err := s.WithProfile(); err == nil {
+				s = resolved
+			}
+			fmt.Fprintf(out, "  - %s: %s -> %s (", s.Name, s.Root, s.Dest)
+			if p, err := profile.Lookup(s.Profile); err == nil {
+				fmt.Fprintf(out, "profile: %s, transcripts: %s; ", p.Name, p.Format)
+			}
+			fmt.Fprintf(out, "include: %s", strings.Join(s.Include, ", "))
+			if len(s.Exclude) > 0 {
+				fmt.Fprintf(out, "; exclude: %s", strings.Join(s.Exclude, ", "))
+			}
+			fmt.Fprintln(out, ")")
+		}
+	}
+
+	fmt.Fprintln(out, "project_local:")
+	fmt.Fprintf(out, "  enabled: %t\n", viper.GetBool("project_local.enabled"))
+	fmt.Fprintln(out, "  include:")
+	for _, pattern := range viper.GetStringSlice("project_local.include") {
+		fmt.Fprintf(out, "    - %s\n", pattern)
+	}
+
 	fmt.Fprintln(out, "lfs_patterns:")
 	for _, pattern := range viper.GetStringSlice("lfs_patterns") {
 		fmt.Fprintf(out, "  - %s\n", pattern)
 	}
 
+	fmt.Fprintln(out, "secrets:")
+	fmt.Fprintf(out, "  enabled: %t\n", viper.GetBool("secrets.enabled"))
+	fmt.Fprintf(out, "  builtin_action: %s\n", viper.GetString("secrets.builtin_action"))
+	var rules []scan.RuleConfig
+	if err := viper.UnmarshalKey("secrets.rules", &rules); err == nil && len(rules) > 0 {
+		fmt.Fprintln(out, "  rules:")
+		for _, r := range rules {
+			fmt.Fprintf(out, "    - %s: %s (%s)\n", r.Name, r.Pattern, r.Action)
+		}
+	}
+
+	var prices []usage.Price
+	if err := viper.UnmarshalKey("usage.prices", &prices); err == nil && len(prices) > 0 {
+		fmt.Fprintln(out, "usage:\n  prices:")
+		for _, p := range prices {
+			fmt.Fprintf(out, "    - %s: input %g, output %g, cache_write %g, cache_read %g\n", p.Model, p.Input, p.Output, p.CacheWrite, p.CacheRead)
+		}
+	}
+
 	return nil
 }
 
@@ -63,3 +226,451 @@ func runConfigPath(cmd *cobra.Command, args []string) {
 	out := cmd.OutOrStdout()
 	fmt.Fprintln(out, configFilePath())
 }
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+
+	path, issues, err := validateConfig(config.CheckOptions{Matches: true})
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Fprintln(out, "Config: none, using defaults")
+	} else {
+		fmt.Fprintf(out, "Config: %s\n", path)
+	}
+	for _, i := range issues {
+		fmt.Fprintf(out, "%-8s %s: %s\n", i.Severity, i.Key, i.Message)
+	}
+
+	errs := len(config.Errors(issues))
+	warnings := len(issues) - errs
+	if errs > 0 {
+		return fmt.Errorf("invalid config: %d error(s), %d warning(s)", errs, warnings)
+	}
+	if warnings > 0 {
+		fmt.Fprintf(out, "Config is valid, with %d warning(s).\n", warnings)
+		return nil
+	}
+	fmt.Fprintln(out, "Config is valid.")
+	return nil
+}
+
+// loadConfig decodes the effective settings into the typed config.
+func loadConfig() (*config.Config, error) {
+	var c config.Config
+	if err := viper.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// validateConfig checks the config file in use against the schema, and the
+// effective settings. It returns the path of the config file, or "" if
+// there is none.
+func validateConfig(opts config.CheckOptions) (string, []config.Issue, error) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		path = configFilePath()
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		path, data = "", nil
+	case err != nil:
+		return "", nil, fmt.Errorf("read config: %w", err)
+	}
+	return path, checkConfigData(data, opts), nil
+}
+
+// checkConfigData checks the config file contents data, nil if there is
+// no file, and the effective settings.
+func checkConfigData(data []byte, opts config.CheckOptions) []config.Issue {
+	var issues []config.Issue
+	if data != nil {
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			issues = append(issues, config.Issue{Severity: config.Error, Key: "config", Message: err.Error()})
+		} else {
+			issues = append(issues, config.CheckKeys(raw)...)
+			issues = append(issues, config.CheckVersion(raw)...)
+		}
+	}
+
+	opts.Explicit = explicitSetting
+	c, err := loadConfig()
+	if err != nil {
+		// Values of the wrong type are already reported by key
+		if len(config.Errors(issues)) == 0 {
+			issues = append(issues, config.Issue{Severity: config.Error, Key: "config", Message: err.Error()})
+		}
+		return issues
+	}
+	return append(issues, config.Check(c, opts)...)
+}
+
+// checkConfig stops a command if the config has errors. Warnings are
+// printed with --verbose, except that of an outdated config version, which
+// always is.
+func checkConfig(out io.Writer, verbose bool) error {
+	_, issues, err := validateConfig(config.CheckOptions{})
+	if err != nil {
+		return err
+	}
+	for _, i := range issues {
+		if i.Severity == config.Error || i.Key == "version" || verbose {
+			fmt.Fprintf(out, "Config %s\n", i)
+		}
+	}
+	if errs := config.Errors(issues); len(errs) > 0 {
+		return fmt.Errorf("invalid config: %d error(s), run 'ccbackup config validate' for details", len(errs))
+	}
+	return nil
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+	key := args[0]
+	if _, err := config.KeyType(key); err != nil {
+		return err
+	}
+
+	switch v := viper.Get(key).(type) {
+	case nil:
+	case string, bool, int, int64, float64:
+		fmt.Fprintln(out, v)
+	default:
+		if config.IsStringList(key) {
+			for _, s := range viper.GetStringSlice(key) {
+				fmt.Fprintln(out, s)
+			}
+			return nil
+		}
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", key, err)
+		}
+		fmt.Fprint(out, string(data))
+	}
+	return nil
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	key, value := args[0], args[1]
+	return editConfig(cmd, func(doc *config.Document) (string, error) {
+		old, changed, err := doc.Set(key, value)
+		if err != nil || !changed {
+			return "", err
+		}
+		if old == "" {
+			return fmt.Sprintf("set %s to %q", key, value), nil
+		}
+		return fmt.Sprintf("set %s to %q (was %q)", key, value, old), nil
+	})
+}
+
+func runConfigAdd(cmd *cobra.Command, args []string) error {
+	key, value := args[0], args[1]
+	return editConfig(cmd, func(doc *config.Document) (string, error) {
+		changed, err := doc.Add(key, value, viper.GetStringSlice(key))
+		if err != nil || !changed {
+			return "", err
+		}
+		return fmt.Sprintf("add %q to %s", value, key), nil
+	})
+}
+
+func runConfigRemove(cmd *cobra.Command, args []string) error {
+	key, value := args[0], args[1]
+	return editConfig(cmd, func(doc *config.Document) (string, error) {
+		changed, err := doc.Remove(key, value, viper.GetStringSlice(key))
+		if err != nil {
+			return "", err
+		}
+		if !changed {
+			return "", fmt.Errorf("%s does not contain %q", key, value)
+		}
+		return fmt.Sprintf("remove %q from %s", value, key), nil
+	})
+}
+
+// editConfig applies edit to the config file and writes it back if the
+// result is valid. edit returns what it did, or "" if it changed nothing.
+func editConfig(cmd *cobra.Command, edit func(*config.Document) (string, error)) error {
+	exec := viper.GetBool("exec")
+	verbose := viper.GetBool("verbose")
+	out := cmd.OutOrStdout()
+
+	path := configFilePath()
+	_, doc, err := readConfigDocument(path)
+	if err != nil {
+		return err
+	}
+
+	action, err := edit(doc)
+	if err != nil {
+		return err
+	}
+	if action == "" {
+		fmt.Fprintf(out, "Config unchanged: %s\n", path)
+		return nil
+	}
+	edited, err := checkEdited(out, path, doc, verbose)
+	if err != nil {
+		return err
+	}
+
+	if !exec {
+		fmt.Fprintf(out, "Would %s in %s\n", action, path)
+		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
+		return nil
+	}
+	if err := writeConfigFile(path, edited); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Updated %s: %s\n", path, action)
+	return nil
+}
+
+// readConfigDocument reads the config file at path for editing.
+func readConfigDocument(path string) ([]byte, *config.Document, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("config file %s does not exist, run 'ccbackup init --exec'", path)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read config: %w", err)
+	}
+	doc, err := config.ParseDocument(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return data, doc, nil
+}
+
+// checkEdited encodes an edited config and checks it as if it were in use.
+// Errors are printed to out, and warnings with verbose.
+func checkEdited(out io.Writer, path string, doc *config.Document, verbose bool) ([]byte, error) {
+	edited, err := doc.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	if err := viper.ReadConfig(bytes.NewReader(edited)); err != nil {
+		return nil, fmt.Errorf("parse edited config: %w", err)
+	}
+	issues := checkConfigData(edited, config.CheckOptions{})
+	for _, i := range issues {
+		if i.Severity == config.Error || verbose {
+			fmt.Fprintf(out, "Config %s\n", i)
+		}
+	}
+	if errs := config.Errors(issues); len(errs) > 0 {
+		return nil, fmt.Errorf("edited config is invalid: %d error(s), %s not changed", len(errs), path)
+	}
+	return edited, nil
+}
+
+// writeConfigFile replaces the config file at path, keeping its mode. The
+// data goes to a temporary file first, so that a failed write leaves the
+// old config intact. A symlinked config is replaced at its target.
+func writeConfigFile(path string, data []byte) error {
+	if err := replaceFile(path, data); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return nil
+}
+
+// replaceFile renames a temporary file with data over path.
+func replaceFile(path string, data []byte) error {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func runConfigMigrate(cmd *cobra.Command, args []string) error {
+	exec := viper.GetBool("exec")
+	verbose := viper.GetBool("verbose")
+	out := cmd.OutOrStdout()
+
+	path := configFilePath()
+	data, doc, err := readConfigDocument(path)
+	if err != nil {
+		return err
+	}
+	from, applied, err := config.Migrate(doc)
+	if err != nil {
+		return err
+	}
+	if from == config.CurrentVersion {
+		fmt.Fprintf(out, "Config is up to date: version %d\n", from)
+		return nil
+	}
+
+	fmt.Fprintf(out, "Config version %d -> %d: %s\n", from, config.CurrentVersion, path)
+	for _, step := range applied {
+		fmt.Fprintf(out, "  - %s\n", step)
+	}
+	fmt.Fprintf(out, "  - set version: %d\n", config.CurrentVersion)
+	migrated, err := checkEdited(out, path, doc, verbose)
+	if err != nil {
+		return err
+	}
+
+	backup := path + ".bak"
+	if !exec {
+		fmt.Fprintf(out, "\nWould back up the config to %s and write:\n\n%s", backup, migrated)
+		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
+		return nil
+	}
+	if err := os.WriteFile(backup, data, 0600); err != nil {
+		return fmt.Errorf("back up config: %w", err)
+	}
+	fmt.Fprintf(out, "Backed up config: %s\n", backup)
+	if err := writeConfigFile(path, migrated); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Migrated config to version %d: %s\n", config.CurrentVersion, path)
+	return nil
+}
+
+func runConfigExplain(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+	format, _ := cmd.Flags().GetString("format")
+	switch format {
+	case "text", "yaml", "json":
+	default:
+		return fmt.Errorf("unknown format %q, want text, yaml or json", format)
+	}
+
+	settings, err := explainConfig(cmd)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		return writeJSON(out, settings)
+	case "yaml":
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(settings); err != nil {
+			return fmt.Errorf("encode settings: %w", err)
+		}
+		return enc.Close()
+	}
+	writeSettings(out, settings)
+	return nil
+}
+
+// explicitSetting reports whether the config file or the environment sets
+// key, rather than its default.
+func explicitSetting(key string) bool {
+	if _, ok := os.LookupEnv("CCBACKUP_" + strings.ToUpper(key)); ok {
+		return true
+	}
+	return viper.InConfig(key)
+}
+
+// explainConfig returns the settings in effect with the value each layer
+// gives them, credentials masked. Environment variables are named as viper.AutomaticEnv looks
+// them up, CCBACKUP_ and the upper-case key.
+func explainConfig(cmd *cobra.Command) ([]config.Setting, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("home directory: %w", err)
+	}
+	defaults := viper.New()
+	setDefaults(defaults, home)
+
+	path := viper.ConfigFileUsed()
+	var raw map[string]interface{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			path = ""
+		case err != nil:
+			return nil, fmt.Errorf("read config: %w", err)
+		default:
+			if err := yaml.Unmarshal(data, &raw); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", path, err)
+			}
+		}
+	}
+
+	var settings []config.Setting
+	for _, key := range append(config.Keys(), "exec", "verbose") {
+		var values []config.Value
+		if v := defaults.Get(key); v != nil {
+			values = append(values, config.Value{Layer: config.LayerDefault, Value: v})
+		}
+		if v, ok := config.Lookup(raw, key); ok {
+			values = append(values, config.Value{Layer: config.LayerFile, Source: path, Value: v})
+		}
+		env := "CCBACKUP_" + strings.ToUpper(key)
+		if v, ok := os.LookupEnv(env); ok {
+			values = append(values, config.Value{Layer: config.LayerEnv, Source: env, Value: v})
+		}
+		if f := cmd.Flags().Lookup(key); f != nil && f.Changed {
+			var v interface{} = f.Value.String()
+			if f.Value.Type() == "bool" {
+				v = f.Value.String() == "true"
+			}
+			values = append(values, config.Value{Layer: config.LayerFlag, Source: "--" + f.Name, Value: v})
+		}
+		if s, ok := config.Explain(key, values); ok {
+			settings = append(settings, s.Mask())
+		}
+	}
+	return settings, nil
+}
+
+// writeSettings prints settings with their origins, one per line.
+func writeSettings(out io.Writer, settings []config.Setting) {
+	origin := func(v config.Value) string {
+		if v.Source == "" {
+			return string(v.Layer)
+		}
+		return fmt.Sprintf("%s %s", v.Layer, v.Source)
+	}
+	for _, s := range settings {
+		fmt.Fprintf(out, "%s: %s (%s)\n", s.Key, formatSetting(s.Value.Value), origin(s.Value))
+		for _, v := range s.Overridden {
+			fmt.Fprintf(out, "  overrides %s (%s)\n", formatSetting(v.Value), origin(v))
+		}
+	}
+}
+
+// formatSetting prints strings as they are and other values as JSON.
+func formatSetting(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
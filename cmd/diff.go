@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/session"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [<rev-a>] [<rev-b>|--source]",
+	Short: "Show session changes between backups or against the source",
+	Long: `Compare two backup points, or a backup point and the live source, message
+by message. Revisions are commits, tags or dates (snapshot IDs with
+repository: cas). Without <rev-b> the source is compared, redacted as a
+backup would store it; without <rev-a> the latest backup is used, so a plain
+"ccbackup diff" shows what the next backup will capture.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: runDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().Bool("source", false, "compare with the live source (the default without <rev-b>)")
+}
+
+// maxDiffEntries bounds the entries printed per file unless verbose.
+const maxDiffEntries = 10
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	verbose := viper.GetBool("verbose")
+	out := cmd.OutOrStdout()
+
+	useSource, _ := cmd.Flags().GetBool("source")
+	if useSource && len(args) == 2 {
+		return fmt.Errorf("--source replaces <rev-b>, give at most one revision")
+	}
+	useCAS, err := casMode()
+	if err != nil {
+		return err
+	}
+
+	revA, revB := "HEAD", ""
+	if useCAS {
+		revA = "latest"
+	}
+	if len(args) > 0 {
+		revA = args[0]
+	}
+	if len(args) == 2 {
+		revB = args[1]
+	}
+
+	a, labelA, err := openRevisionSide(revA, useCAS)
+	if err != nil {
+		return err
+	}
+	b, labelB, err := openRevisionSide(revB, useCAS)
+	if err != nil {
+		return err
+	}
+
+	filter, err := sourceFilter()
+	if err != nil {
+		return err
+	}
+	diffs, err := session.Compare(a, b, filter)
+	if err != nil {
+		return fmt.Errorf("diff: %w", err)
+	}
+
+	fmt.Fprintf(out, "Comparing %s with %s\n", labelA, labelB)
+	if len(diffs) == 0 {
+		fmt.Fprintln(out, "\nNo differences.")
+		return nil
+	}
+
+	var sessions, files int
+	for _, d := range diffs {
+		fmt.Fprintln(out)
+		printFileDiff(out, d, verbose)
+		if d.Session {
+			sessions++
+		} else {
+			files++
+		}
+	}
+	fmt.Fprintf(out, "\n%d sessions and %d other files differ\n", sessions, files)
+	return nil
+}
+
+// openRevisionSide opens a revision, or the source if rev is empty.
+func openRevisionSide(rev string, useCAS bool) (session.Side, string, error) {
+	if rev == "" {
+		sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
+		if err != nil {
+			return session.Side{}, "", fmt.Errorf("expand source_dir: %w", err)
+		}
+		side := session.Side{FS: storage.NewOSFS(), Root: sourceDir, Source: true}
+		scanner, err := newSecretScanner()
+		if err != nil {
+			return session.Side{}, "", fmt.Errorf("secrets: %w", err)
+		}
+		if scanner != nil && scanner.Redacts() {
+			side.Transform = scanner.Redact
+		}
+		return side, "source", nil
+	}
+
+	if err := checkHostNamespace(useCAS); err != nil {
+		return session.Side{}, "", err
+	}
+	if useCAS {
+		dest, err := openBackupDir(viper.GetString("backup_dir"))
+		if err != nil {
+			return session.Side{}, "", err
+		}
+		snap, snapFS, err := openCASSnapshot(dest, rev)
+		if err != nil {
+			return session.Side{}, "", err
+		}
+		if snap == nil {
+			return session.Side{}, "", fmt.Errorf("repository has no snapshots")
+		}
+		label := fmt.Sprintf("snapshot %s (%s)", snap.ShortID(), snap.Time.Local().Format("2006-01-02 15:04"))
+		return session.Side{FS: snapFS, Root: "."}, label, nil
+	}
+
+	backupDir, err := localBackupDir()
+	if err != nil {
+		return session.Side{}, "", err
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, ".git")); os.IsNotExist(err) {
+		return session.Side{}, "", fmt.Errorf("backup directory not initialized, run 'ccbackup init --exec' first")
+	}
+	commit, err := resolveAt(git.NewGit(backupDir), rev)
+	if err != nil {
+		return session.Side{}, "", err
+	}
+	tree, err := git.NewTreeFS(backupDir, commit.Hash)
+	if err != nil {
+		return session.Side{}, "", err
+	}
+	root, err := dataRoot(".")
+	if err != nil {
+		return session.Side{}, "", err
+	}
+	label := fmt.Sprintf("%s (%s)", commit.ShortHash(), commit.Time.Local().Format("2006-01-02 15:04"))
+	return session.Side{FS: tree, Root: root}, label, nil
+}
+
+// printFileDiff prints the header of a changed file and its entries.
+func printFileDiff(out io.Writer, d session.FileDiff, verbose bool) {
+	kind, unit := "file", "entries"
+	if d.Session {
+		kind, unit = "session", "messages"
+	}
+	switch d.Status {
+	case session.FileAdded:
+		fmt.Fprintf(out, "new %s %s (%d %s)\n", kind, d.Path, len(d.Added), unit)
+	case session.FileRemoved:
+		fmt.Fprintf(out, "removed %s %s (%d %s)\n", kind, d.Path, len(d.Removed), unit)
+	case session.Appended:
+		fmt.Fprintf(out, "%s %s: %d %s added\n", kind, d.Path, len(d.Added), unit)
+	case session.Rewritten:
+		fmt.Fprintf(out, "rewritten %s %s: %d kept, %d removed, %d added\n", kind, d.Path, d.Kept, len(d.Removed), len(d.Added))
+	}
+
+	// Removed files are summarized; their content is in the older backup
+	if d.Status != session.FileRemoved {
+		printEntries(out, "-", d.Removed, verbose)
+	}
+	printEntries(out, "+", d.Added, verbose)
+}
+
+func printEntries(out io.Writer, sign string, entries []session.Entry, verbose bool) {
+	for i, e := range entries {
+		if i == maxDiffEntries && !verbose {
+			fmt.Fprintf(out, "  ... %d more (use -v to show all)\n", len(entries)-i)
+			return
+		}
+		when := ""
+		if !e.Time.IsZero() {
+			when = e.Time.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(out, "  %s %-9s  %-16s  %s\n", sign, e.Role, when, truncatePrompt(e.Text, maxPromptWidth))
+	}
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/archive"
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a snapshot as a tar.gz or zip archive",
+	Long: `Export include-filtered files from source_dir, or from a backup commit
+with --rev, as a reproducible archive with an embedded manifest of hashes.`,
+	RunE: runExport,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().String("format", "tar.gz", "archive format (tar.gz or zip)")
+	exportCmd.Flags().String("out", "", "output archive path")
+	exportCmd.Flags().StringSlice("include", nil, "narrow the configured include patterns")
+	exportCmd.Flags().String("rev", "", "export from this backup commit or snapshot ID instead of source_dir")
+	_ = exportCmd.MarkFlagRequired("out")
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	exec := viper.GetBool("exec")
+	verbose := viper.GetBool("verbose")
+	out := cmd.OutOrStdout()
+
+	formatName, _ := cmd.Flags().GetString("format")
+	format, err := archive.ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+	outPath, _ := cmd.Flags().GetString("out")
+	outPath, err = paths.ExpandHome(outPath)
+	if err != nil {
+		return fmt.Errorf("expand out: %w", err)
+	}
+	rev, _ := cmd.Flags().GetString("rev")
+	narrow, _ := cmd.Flags().GetStringSlice("include")
+
+	fsys, root, err := openSnapshot(rev)
+	if err != nil {
+		return err
+	}
+
+	filter, err := sourceFilter()
+	if err != nil {
+		return err
+	}
+	if len(narrow) > 0 {
+		filter = filter.And(sync.NewFilter(narrow))
+	}
+
+	listed, err := sync.List(fsys, root, filter)
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	for _, w := range listed.Warnings {
+		fmt.Fprintf(out, "Warning: %s: %v\n", w.RelPath, w.Err)
+	}
+	if len(listed.Items) == 0 {
+		fmt.Fprintln(out, "No files to export.")
+		return nil
+	}
+
+	files := make([]archive.File, 0, len(listed.Items))
+	var totalBytes int64
+	for _, item := range listed.Items {
+		files = append(files, archive.File{
+			RelPath: filepath.ToSlash(item.RelPath),
+			Path:    item.SrcPath,
+			Size:    item.Size,
+			Mode:    item.Mode,
+		})
+		totalBytes += item.Size
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].RelPath < files[j].RelPath })
+
+	if !exec {
+		for _, f := range files {
+			fmt.Fprintf(out, "Would export: %s (%s)\n", f.RelPath, formatSize(f.Size))
+		}
+		fmt.Fprintf(out, "Would write: %s (%d files, %s)\n", outPath, len(files), formatSize(totalBytes))
+		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
+		return nil
+	}
+
+	if err := writeArchive(outPath, format, fsys, files); err != nil {
+		return err
+	}
+
+	if verbose {
+		for _, f := range files {
+			fmt.Fprintf(out, "Exported: %s\n", f.RelPath)
+		}
+	}
+	fmt.Fprintf(out, "Exported %d files (%s) to %s\n", len(files), formatSize(totalBytes), outPath)
+	return nil
+}
+
+// openSnapshot returns the source_dir, or if rev is set the tree of a backup
+// commit, or a snapshot with repository: cas.
+func openSnapshot(rev string) (storage.FS, string, error) {
+	if rev == "" {
+		sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
+		if err != nil {
+			return nil, "", fmt.Errorf("expand source_dir: %w", err)
+		}
+		return storage.NewOSFS(), sourceDir, nil
+	}
+
+	useCAS, err := casMode()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkHostNamespace(useCAS); err != nil {
+		return nil, "", err
+	}
+	if useCAS {
+		dest, err := openBackupDir(viper.GetString("backup_dir"))
+		if err != nil {
+			return nil, "", err
+		}
+		snap, snapFS, err := openCASSnapshot(dest, rev)
+		if err != nil {
+			return nil, "", err
+		}
+		if snap == nil {
+			return nil, "", fmt.Errorf("repository has no snapshots")
+		}
+		return snapFS, ".", nil
+	}
+
+	backupDir, err := localBackupDir()
+	if err != nil {
+		return nil, "", err
+	}
+	tree, err := git.NewTreeFS(backupDir, rev)
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := dataRoot(".")
+	if err != nil {
+		return nil, "", err
+	}
+	return tree, root, nil
+}
+
+// localBackupDir returns backup_dir, which must be a local git repository.
+func localBackupDir() (string, error) {
+	dest, err := openBackupDir(viper.GetString("backup_dir"))
+	if err != nil {
+		return "", err
+	}
+	if dest.Remote {
+		return "", fmt.Errorf("backup_dir %s has no git history", viper.GetString("backup_dir"))
+	}
+	return dest.Root, nil
+}
+
+// writeArchive writes the archive next to path and renames it into place.
+func writeArchive(path string, format archive.Format, fsys storage.FS, files []archive.File) error {
+	if err := paths.EnsureDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("create output dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := archive.Write(tmp, format, fsys, files); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
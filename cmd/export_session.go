@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/session"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+var exportSessionCmd = &cobra.Command{
+	Use:   "export-session [<session-id|path>]",
+	Short: "Render session transcripts as Markdown or HTML",
+	Long: `Render a session transcript as a Markdown or HTML document with user and
+assistant turns, timestamps, collapsed tool inputs and outputs, and subagent
+runs. A session is given by its ID, a unique ID prefix, or its path. Without
+a session, every session of the projects matching --project is written below
+--out. Sessions are read from the source, redacted as a backup would store
+them, or from a backup revision with --rev.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runExportSession,
+}
+
+func init() {
+	rootCmd.AddCommand(exportSessionCmd)
+	exportSessionCmd.Flags().String("format", "md", "output format (md or html)")
+	exportSessionCmd.Flags().String("out", "", "output file, or directory without a session (default: stdout)")
+	exportSessionCmd.Flags().String("rev", "", "read from this backup commit, tag, date or snapshot ID instead of source_dir")
+	exportSessionCmd.Flags().String("project", "", "without a session, export every session of projects whose directory name contains this")
+	exportSessionCmd.Flags().Bool("thinking", false, "include thinking blocks")
+}
+
+// sessionFile is a transcript on a revision side and its subagent transcripts.
+type sessionFile struct {
+	Ref       session.Ref
+	Path      string
+	Subagents []string
+}
+
+func runExportSession(cmd *cobra.Command, args []string) error {
+	exec := viper.GetBool("exec")
+	out := cmd.OutOrStdout()
+
+	formatName, _ := cmd.Flags().GetString("format")
+	format, err := session.ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+	outPath, _ := cmd.Flags().GetString("out")
+	if outPath, err = paths.ExpandHome(outPath); err != nil {
+		return fmt.Errorf("expand out: %w", err)
+	}
+	rev, _ := cmd.Flags().GetString("rev")
+	project, _ := cmd.Flags().GetString("project")
+	thinking, _ := cmd.Flags().GetBool("thinking")
+	if len(args) == 0 && project == "" {
+		return fmt.Errorf("give a session ID or path, or --project to export a project")
+	}
+	if len(args) == 0 && outPath == "" {
+		return fmt.Errorf("--out is required to export a project")
+	}
+
+	useCAS, err := casMode()
+	if err != nil {
+		return err
+	}
+	side, label, err := openRevisionSide(rev, useCAS)
+	if err != nil {
+		return err
+	}
+	sessions, err := listSessions(side)
+	if err != nil {
+		return err
+	}
+
+	var selected []sessionFile
+	if len(args) == 1 {
+		s, err := findSession(side, sessions, args[0], rev == "")
+		if err != nil {
+			return err
+		}
+		selected = []sessionFile{s}
+	} else {
+		for _, s := range sessions {
+			if strings.Contains(s.Ref.Project, project) {
+				selected = append(selected, s)
+			}
+		}
+		if len(selected) == 0 {
+			fmt.Fprintf(out, "No sessions in projects matching %q.\n", project)
+			return nil
+		}
+	}
+
+	for _, s := range selected {
+		var buf bytes.Buffer
+		messages, err := renderSession(&buf, side, s, format, label, thinking)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", s.Path, err)
+		}
+
+		if outPath == "" {
+			_, err := out.Write(buf.Bytes())
+			return err
+		}
+		dest := outPath
+		if len(args) == 0 {
+			dest = filepath.Join(outPath, s.Ref.Project, s.Ref.ID+format.Ext())
+		}
+		if !exec {
+			fmt.Fprintf(out, "Would write: %s (%d messages)\n", dest, messages)
+			continue
+		}
+		if err := paths.EnsureDir(filepath.Dir(dest)); err != nil {
+			return fmt.Errorf("create output dir: %w", err)
+		}
+		if err := os.WriteFile(dest, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("write %s: %w", dest, err)
+		}
+		fmt.Fprintf(out, "Wrote %s (%d messages)\n", dest, messages)
+	}
+
+	if !exec {
+		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
+	}
+	return nil
+}
+
+// listSessions returns the transcripts under projects/ sorted by path, with
+// the subagent transcripts stored in projects/<project>/<id>/subagents/.
+func listSessions(side session.Side) ([]sessionFile, error) {
+	listed, err := sync.List(side.FS, side.Root, sync.NewFilter([]string{"projects"}))
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+
+	var sessions []sessionFile
+	subagents := map[string][]string{}
+	for _, item := range listed.Items {
+		rel := filepath.ToSlash(item.RelPath)
+		if ref, ok := session.Parse(rel); ok {
+			sessions = append(sessions, sessionFile{Ref: ref, Path: rel})
+			continue
+		}
+		parts := strings.Split(rel, "/")
+		if len(parts) == 5 && parts[3] == "subagents" && path.Ext(rel) == ".jsonl" {
+			owner := path.Join(parts[0], parts[1], parts[2]+".jsonl")
+			subagents[owner] = append(subagents[owner], rel)
+		}
+	}
+	for i := range sessions {
+		sessions[i].Subagents = subagents[sessions[i].Path]
+		sort.Strings(sessions[i].Subagents)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Path < sessions[j].Path })
+	return sessions, nil
+}
+
+// findSession resolves a session ID, unique ID prefix, or path. A path may
+// be relative to the Claude directory or, for the source, a file on disk.
+func findSession(side session.Side, sessions []sessionFile, arg string, isSource bool) (sessionFile, error) {
+	if isSource && strings.HasSuffix(arg, ".jsonl") {
+		if abs, err := filepath.Abs(arg); err == nil {
+			if rel, err := filepath.Rel(side.Root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				arg = rel
+			}
+		}
+	}
+
+	rel := filepath.ToSlash(filepath.Clean(arg))
+	var matches []sessionFile
+	for _, s := range sessions {
+		switch {
+		case s.Path == rel || s.Ref.ID == arg:
+			return s, nil
+		case strings.HasPrefix(s.Ref.ID, arg):
+			matches = append(matches, s)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return sessionFile{}, fmt.Errorf("no session matches %q", arg)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = m.Path
+	}
+	return sessionFile{}, fmt.Errorf("session %q is ambiguous: %s", arg, strings.Join(names, ", "))
+}
+
+// renderSession renders a session and returns its number of messages.
+func renderSession(buf *bytes.Buffer, side session.Side, s sessionFile, format session.Format, label string, thinking bool) (int, error) {
+	t, err := readTranscript(side, s.Path)
+	if err != nil {
+		return 0, err
+	}
+	opts := session.RenderOptions{
+		Title:    "Session " + s.Ref.ID,
+		Fields:   []session.Field{{Name: "Project", Value: s.Ref.Project}},
+		Thinking: thinking,
+	}
+	if len(t.Messages) > 0 && !t.Messages[0].Time.IsZero() {
+		opts.Fields = append(opts.Fields, session.Field{Name: "Started", Value: t.Messages[0].Time.Local().Format("2006-01-02 15:04:05")})
+	}
+	opts.Fields = append(opts.Fields,
+		session.Field{Name: "Messages", Value: strconv.Itoa(len(t.Messages))},
+		session.Field{Name: "Source", Value: label},
+	)
+	for _, p := range s.Subagents {
+		sub, err := readTranscript(side, p)
+		if err != nil {
+			return 0, err
+		}
+		opts.Subagents = append(opts.Subagents, session.Subagent{Name: strings.TrimSuffix(path.Base(p), ".jsonl"), Transcript: sub})
+	}
+	if err := session.Render(buf, t, format, opts); err != nil {
+		return 0, err
+	}
+	return len(t.Messages), nil
+}
+
+func readTranscript(side session.Side, relPath string) (*session.Transcript, error) {
+	data, err := side.ReadFile(relPath)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", relPath, err)
+	}
+	return session.ReadTranscript(bytes.NewReader(data))
+}
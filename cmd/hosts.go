@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/session"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+)
+
+// currentHost returns the machine this backup runs on when host_namespace
+// is enabled: host_id, or the hostname if that is not set. It returns ""
+// when the backup is not namespaced.
+func currentHost() (string, error) {
+	if !viper.GetBool("host_namespace") {
+		return "", nil
+	}
+	host := viper.GetString("host_id")
+	if host == "" {
+		name, err := os.Hostname()
+		if err != nil {
+			return "", fmt.Errorf("host_id is not set: %w", err)
+		}
+		// Only the short name; the domain can change between networks
+		host, _, _ = strings.Cut(name, ".")
+	}
+	if err := validateHost(host); err != nil {
+		return "", fmt.Errorf("host_id: %w", err)
+	}
+	return host, nil
+}
+
+// validateHost checks that a host name is a single path component.
+func validateHost(host string) error {
+	if host == "" || host == "." || host == ".." || strings.ContainsAny(host, `/\`) {
+		return fmt.Errorf("invalid host name %q", host)
+	}
+	return nil
+}
+
+// hostRoot returns the directory of host's data under a backup root, or
+// root itself if host is empty.
+func hostRoot(root, host string) string {
+	if host == "" {
+		return root
+	}
+	return filepath.Join(root, session.HostsDir, host)
+}
+
+// dataRoot returns the directory this machine backs up to under root.
+func dataRoot(root string) (string, error) {
+	host, err := currentHost()
+	if err != nil {
+		return "", err
+	}
+	return hostRoot(root, host), nil
+}
+
+// checkHostNamespace rejects host_namespace where it is not supported.
+func checkHostNamespace(useCAS bool) error {
+	if useCAS && viper.GetBool("host_namespace") {
+		return fmt.Errorf("host_namespace is not supported with repository: %s", repositoryCAS)
+	}
+	return nil
+}
+
+// listHosts returns the hosts that have data under a backup root.
+func listHosts(fsys storage.FS, root string) ([]string, error) {
+	hosts, err := listNames(fsys, filepath.Join(root, session.HostsDir))
+	if err != nil {
+		return nil, fmt.Errorf("list hosts: %w", err)
+	}
+	return hosts, nil
+}
+
+// listNames returns the sorted names of the entries of dir, or none if it
+// does not exist.
+func listNames(fsys storage.FS, dir string) ([]string, error) {
+	seen := map[string]bool{}
+	err := fsys.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		seen[name] = true
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(seen))
+	for n := range seen {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/archive"
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/storage/s3"
+	"github.com/takoeight0821/ccbackup/internal/storage/webdav"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <archive|dir|backup-repo>",
+	Short: "Import sessions from an archive or another backup",
+	Long: `Merge include-filtered files from a tar.gz/zip archive, a directory
+or another ccbackup backup into source_dir, using the same rules as restore.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().String("rev", "", "import this commit of a backup repository instead of its working tree")
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	exec := viper.GetBool("exec")
+	verbose := viper.GetBool("verbose")
+	out := cmd.OutOrStdout()
+
+	sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
+	if err != nil {
+		return fmt.Errorf("expand source_dir: %w", err)
+	}
+	rev, _ := cmd.Flags().GetString("rev")
+
+	fsys, root, cleanup, err := openImportSource(args[0], rev)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	filter, err := sourceFilter()
+	if err != nil {
+		return err
+	}
+	syncer := sync.NewSyncer(root, sourceDir, nil)
+	syncer.Filter = filter
+	syncer.SrcFS = fsys
+	syncer.DryRun = !exec
+	syncer.Verbose = verbose
+
+	ctx := context.Background()
+	plan, err := syncer.Plan(ctx)
+	if err != nil {
+		return fmt.Errorf("plan: %w", err)
+	}
+	for _, w := range plan.Warnings {
+		fmt.Fprintf(out, "Warning: %s: %v\n", w.RelPath, w.Err)
+	}
+
+	if len(plan.Items) == 0 {
+		fmt.Fprintln(out, "No changes to import.")
+		return nil
+	}
+
+	if !exec {
+		for _, item := range plan.Items {
+			fmt.Fprintf(out, "Would import: %s (%s)\n", item.RelPath, formatSize(item.Size))
+		}
+		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
+		return nil
+	}
+
+	result, err := syncer.Apply(ctx, plan)
+	if err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	if verbose {
+		for _, item := range result.Items {
+			fmt.Fprintf(out, "Imported: %s\n", item.RelPath)
+		}
+	}
+	if result.CopiedCount > 0 {
+		fmt.Fprintf(out, "Imported %d files (%s)\n", result.CopiedCount, formatSize(result.TotalBytes))
+	}
+
+	return syncErrors(out, result)
+}
+
+// openImportSource opens an archive, a directory, a backup repository
+// (at rev if set) or a remote backup URL for reading.
+// Archives are extracted to a temporary directory that cleanup removes.
+func openImportSource(raw, rev string) (storage.FS, string, func(), error) {
+	noop := func() {}
+
+	if s3.IsURL(raw) || webdav.IsURL(raw) {
+		if rev != "" {
+			return nil, "", noop, fmt.Errorf("--rev needs a local backup repository, not %s", raw)
+		}
+		src, err := openBackupDir(raw)
+		if err != nil {
+			return nil, "", noop, err
+		}
+		return src.FS, src.Root, noop, nil
+	}
+
+	path, err := paths.ExpandHome(raw)
+	if err != nil {
+		return nil, "", noop, fmt.Errorf("expand %s: %w", raw, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", noop, err
+	}
+
+	if info.IsDir() {
+		if rev == "" {
+			return storage.NewOSFS(), path, noop, nil
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); os.IsNotExist(err) {
+			return nil, "", noop, fmt.Errorf("--rev needs a backup repository, %s is not a git repository", path)
+		}
+		tree, err := git.NewTreeFS(path, rev)
+		if err != nil {
+			return nil, "", noop, err
+		}
+		return tree, ".", noop, nil
+	}
+
+	if rev != "" {
+		return nil, "", noop, fmt.Errorf("--rev needs a backup repository, %s is a file", path)
+	}
+	format, err := archive.DetectFormat(path)
+	if err != nil {
+		return nil, "", noop, err
+	}
+	tmp, err := os.MkdirTemp("", "ccbackup-import-*")
+	if err != nil {
+		return nil, "", noop, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	if err := archive.Extract(path, format, storage.NewOSFS(), tmp); err != nil {
+		cleanup()
+		return nil, "", noop, fmt.Errorf("extract %s: %w", path, err)
+	}
+	return storage.NewOSFS(), tmp, cleanup, nil
+}
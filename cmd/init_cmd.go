@@ -2,13 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/config"
 	"github.com/takoeight0821/ccbackup/internal/git"
 	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/profile"
 )
 
 var initCmd = &cobra.Command{
@@ -21,6 +25,7 @@ var initCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(initCmd)
 	initCmd.Flags().String("backup-dir", "", "backup directory path")
+	initCmd.Flags().StringSlice("profile", nil, "also back up other CLIs as sources: codex, gemini-cli")
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
@@ -34,42 +39,46 @@ func runInit(cmd *cobra.Command, args []string) error {
 		backupDir = flagDir
 	}
 
-	backupDir, err := paths.ExpandHome(backupDir)
+	dest, err := openBackupDir(backupDir)
 	if err != nil {
-		return fmt.Errorf("expand backup_dir: %w", err)
+		return err
 	}
+	useCAS, err := casMode()
+	if err != nil {
+		return err
+	}
+	profiles, err := initProfiles(cmd, useCAS)
+	if err != nil {
+		return err
+	}
+	if useCAS {
+		return initCAS(cmd, dest, backupDir, exec, verbose)
+	}
+	if dest.Remote {
+		return initRemote(cmd, backupDir, profiles, exec, verbose)
+	}
+	backupDir = dest.Root
 
 	cfgPath := configFilePath()
 
 	if !exec {
 		// Dry-run output
 		fmt.Fprintf(out, "Would create config: %s\n", cfgPath)
+		printProfiles(out, profiles)
 		fmt.Fprintf(out, "Would create directory: %s\n", backupDir)
 		fmt.Fprintln(out, "Would run: git init")
 		fmt.Fprintln(out, "Would run: git lfs install")
 		fmt.Fprintln(out, "Would create: .gitattributes (LFS patterns)")
 		fmt.Fprintln(out, "Would create: .gitignore")
 		fmt.Fprintln(out, "Would run: git add -A && git commit")
+		offerProfiles(out, profiles)
 		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
 		return nil
 	}
 
 	// Create config directory and file
-	cfgDir := filepath.Dir(cfgPath)
-	if err := paths.EnsureDir(cfgDir); err != nil {
-		return fmt.Errorf("create config dir: %w", err)
-	}
-
-	// Write config file if it doesn't exist
-	if _, err := os.Stat(cfgPath); os.IsNotExist(err) {
-		if err := writeDefaultConfig(cfgPath, backupDir); err != nil {
-			return fmt.Errorf("write config: %w", err)
-		}
-		if verbose {
-			fmt.Fprintf(out, "Created config: %s\n", cfgPath)
-		}
-	} else if verbose {
-		fmt.Fprintf(out, "Config already exists: %s\n", cfgPath)
+	if err := ensureConfig(out, cfgPath, backupDir, profiles, verbose); err != nil {
+		return err
 	}
 
 	// Create backup directory
@@ -138,22 +147,130 @@ func runInit(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	offerProfiles(out, profiles)
 	fmt.Fprintln(out, "Ready! Run 'ccbackup backup --exec' to start backing up.")
 	return nil
 }
 
-func writeDefaultConfig(path, backupDir string) error {
+// initRemote writes the config for a remote backup_dir.
+// Remote stores need no repository setup; each backup writes a snapshot manifest.
+func initRemote(cmd *cobra.Command, backupDir string, profiles []profile.Profile, exec, verbose bool) error {
+	out := cmd.OutOrStdout()
+	cfgPath := configFilePath()
+
+	if !exec {
+		fmt.Fprintf(out, "Would create config: %s\n", cfgPath)
+		printProfiles(out, profiles)
+		fmt.Fprintf(out, "Would use remote backup: %s (no git repository)\n", backupDir)
+		offerProfiles(out, profiles)
+		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
+		return nil
+	}
+
+	if err := ensureConfig(out, cfgPath, backupDir, profiles, verbose); err != nil {
+		return err
+	}
+
+	offerProfiles(out, profiles)
+	fmt.Fprintln(out, "Ready! Run 'ccbackup backup --exec' to start backing up.")
+	return nil
+}
+
+// ensureConfig writes the default config unless one already exists.
+func ensureConfig(out io.Writer, cfgPath, backupDir string, profiles []profile.Profile, verbose bool) error {
+	if err := paths.EnsureDir(filepath.Dir(cfgPath)); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	if _, err := os.Stat(cfgPath); os.IsNotExist(err) {
+		if err := writeDefaultConfig(cfgPath, backupDir, profiles); err != nil {
+			return fmt.Errorf("write config: %w", err)
+		}
+		if verbose {
+			fmt.Fprintf(out, "Created config: %s\n", cfgPath)
+		}
+	} else if len(profiles) > 0 {
+		fmt.Fprintf(out, "Warning: config already exists, add the profiles to its sources yourself: %s\n", profileNames(profiles))
+	} else if verbose {
+		fmt.Fprintf(out, "Config already exists: %s\n", cfgPath)
+	}
+	return nil
+}
+
+func writeDefaultConfig(path, backupDir string, profiles []profile.Profile) error {
 	home, _ := os.UserHomeDir()
 	sourceDir := filepath.Join(home, ".claude")
 
-	content := fmt.Sprintf(`backup_dir: "%s"
-source_dir: "%s"
-include:
-  - projects
-  - history.jsonl
-  - plans
-  - todos
-`, backupDir, sourceDir)
+	content := fmt.Sprintf("version: %d\nbackup_dir: %q\nsource_dir: %q\ninclude:\n", config.CurrentVersion, backupDir, sourceDir)
+	claude, _ := profile.Lookup(profile.ClaudeCode)
+	for _, pattern := range claude.Include {
+		content += "  - " + pattern + "\n"
+	}
+	if viper.GetString("repository") == repositoryCAS {
+		content += "repository: cas\n"
+	}
+	if len(profiles) > 0 {
+		content += "sources:\n"
+		for _, p := range profiles {
+			content += "  - profile: " + p.Name + "\n"
+		}
+	}
 
 	return os.WriteFile(path, []byte(content), 0644)
 }
+
+// initProfiles returns the profiles given with --profile, which init adds
+// to the config as sources.
+func initProfiles(cmd *cobra.Command, useCAS bool) ([]profile.Profile, error) {
+	names, _ := cmd.Flags().GetStringSlice("profile")
+	if len(names) > 0 && useCAS {
+		return nil, fmt.Errorf("--profile is not supported with repository: %s", repositoryCAS)
+	}
+	var profiles []profile.Profile
+	for _, name := range names {
+		p, err := profile.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if p.Name == profile.ClaudeCode {
+			return nil, fmt.Errorf("%s is backed up from source_dir", p.Name)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// printProfiles shows the sources init would add.
+func printProfiles(out io.Writer, profiles []profile.Profile) {
+	for _, p := range profiles {
+		fmt.Fprintf(out, "Would add source: %s (%s -> %s/)\n", p.Name, p.Root, p.Name)
+	}
+}
+
+// offerProfiles suggests the profiles that have data on this machine but
+// were not selected.
+func offerProfiles(out io.Writer, selected []profile.Profile) {
+	skip := map[string]bool{profile.ClaudeCode: true}
+	for _, p := range selected {
+		skip[p.Name] = true
+	}
+	for _, p := range profile.All() {
+		if skip[p.Name] {
+			continue
+		}
+		root, err := paths.ExpandHome(p.Root)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(root); err == nil && info.IsDir() {
+			fmt.Fprintf(out, "Found %s data in %s; back it up too with --profile %s\n", p.Name, p.Root, p.Name)
+		}
+	}
+}
+
+func profileNames(profiles []profile.Profile) string {
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/session"
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "List backup runs",
+	Long: `List backup commits, newest first, with the number of sessions changed,
+the bytes added and the projects touched by each run.`,
+	Args: cobra.NoArgs,
+	RunE: runLog,
+}
+
+func init() {
+	rootCmd.AddCommand(logCmd)
+	addHistoryFilterFlags(logCmd)
+	logCmd.Flags().Bool("json", false, "print JSON")
+}
+
+// addHistoryFilterFlags adds the filters shared by log and show.
+func addHistoryFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().String("project", "", "only sessions of projects whose directory name contains this")
+	cmd.Flags().String("since", "", "only changes at or after this date, e.g. 2026-09-01 or 2026-09-01T12:00")
+	cmd.Flags().String("until", "", "only changes at or before this date")
+}
+
+// historyFilter selects changes by project and time.
+type historyFilter struct {
+	Project string
+	Since   time.Time
+	Until   time.Time
+}
+
+func parseHistoryFilter(cmd *cobra.Command) (historyFilter, error) {
+	var f historyFilter
+	f.Project, _ = cmd.Flags().GetString("project")
+
+	since, _ := cmd.Flags().GetString("since")
+	if since != "" {
+		t, _, ok := parseDate(since)
+		if !ok {
+			return f, fmt.Errorf("invalid --since date %q", since)
+		}
+		f.Since = t
+	}
+	until, _ := cmd.Flags().GetString("until")
+	if until != "" {
+		t, dateOnly, ok := parseDate(until)
+		if !ok {
+			return f, fmt.Errorf("invalid --until date %q", until)
+		}
+		if dateOnly {
+			// A bare date includes the whole day
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		f.Until = t
+	}
+	return f, nil
+}
+
+// InRange reports whether t is within the date range.
+func (f historyFilter) InRange(t time.Time) bool {
+	return (f.Since.IsZero() || !t.Before(f.Since)) && (f.Until.IsZero() || !t.After(f.Until))
+}
+
+// MatchPath reports whether a changed file belongs to the selected project.
+// Without a project filter every file matches.
+func (f historyFilter) MatchPath(relPath string) bool {
+	if f.Project == "" {
+		return true
+	}
+	project, ok := projectOf(relPath)
+	return ok && strings.Contains(project, f.Project)
+}
+
+// projectOf returns the project directory of a file under projects/,
+// of any host in a backup namespaced by host.
+func projectOf(relPath string) (string, bool) {
+	_, rel := session.SplitHost(relPath)
+	parts := strings.Split(rel, "/")
+	if len(parts) < 3 || parts[0] != "projects" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// Session change kinds reported by log and show.
+const (
+	sessionCreated  = "created"
+	sessionExtended = "extended"
+	sessionModified = "modified"
+	sessionRemoved  = "removed"
+)
+
+// sessionChange is a session transcript changed by a backup run.
+type sessionChange struct {
+	Host        string    `json:"host,omitempty"`
+	Project     string    `json:"project"`
+	Session     string    `json:"session"`
+	Change      string    `json:"change"`
+	Size        int64     `json:"size"`
+	BytesAdded  int64     `json:"bytes_added"`
+	LastActive  time.Time `json:"last_active"`
+	FirstPrompt string    `json:"first_prompt"`
+
+	path string
+}
+
+// backupRun summarizes one backup commit.
+type backupRun struct {
+	Commit          string          `json:"commit"`
+	Time            time.Time       `json:"time"`
+	Subject         string          `json:"subject"`
+	SessionsChanged int             `json:"sessions_changed"`
+	FilesChanged    int             `json:"files_changed"`
+	BytesAdded      int64           `json:"bytes_added"`
+	Projects        []string        `json:"projects"`
+	Sessions        []sessionChange `json:"sessions,omitempty"`
+}
+
+// summarizeRun collects the changes of commit that match filter, of every
+// host. Files under .ccbackup/ are bookkeeping and not counted.
+func summarizeRun(g *git.Git, commit git.Commit, filter historyFilter) (*backupRun, error) {
+	changes, err := g.Changes(commit.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &backupRun{
+		Commit:   commit.Hash,
+		Time:     commit.Time,
+		Subject:  commit.Subject,
+		Projects: []string{},
+	}
+	projects := map[string]bool{}
+	for _, c := range changes {
+		host, rel := session.SplitHost(c.Path)
+		if strings.HasPrefix(rel, ".ccbackup/") || !filter.MatchPath(c.Path) {
+			continue
+		}
+		run.FilesChanged++
+		if c.NewSize > c.OldSize {
+			run.BytesAdded += c.NewSize - c.OldSize
+		}
+		if project, ok := projectOf(c.Path); ok {
+			if host != "" {
+				project = host + ":" + project
+			}
+			if !projects[project] {
+				projects[project] = true
+				run.Projects = append(run.Projects, project)
+			}
+		}
+
+		ref, ok := session.Parse(c.Path)
+		if !ok {
+			continue
+		}
+		sc := sessionChange{
+			Host:    ref.Host,
+			Project: ref.Project,
+			Session: ref.ID,
+			Size:    c.NewSize,
+			path:    c.Path,
+		}
+		switch {
+		case c.Status == git.Added:
+			sc.Change = sessionCreated
+		case c.Status == git.Deleted:
+			sc.Change, sc.Size = sessionRemoved, c.OldSize
+		case c.NewSize > c.OldSize:
+			sc.Change = sessionExtended
+		default:
+			sc.Change = sessionModified
+		}
+		if c.NewSize > c.OldSize {
+			sc.BytesAdded = c.NewSize - c.OldSize
+		}
+		run.Sessions = append(run.Sessions, sc)
+	}
+	run.SessionsChanged = len(run.Sessions)
+	sort.Strings(run.Projects)
+	return run, nil
+}
+
+// openHistory returns the git repository of a local, git-backed backup.
+// name is the command name used in errors.
+func openHistory(name string) (*git.Git, error) {
+	useCAS, err := casMode()
+	if err != nil {
+		return nil, err
+	}
+	if useCAS {
+		return nil, fmt.Errorf("%s requires repository: %s", name, repositoryGit)
+	}
+	backupDir, err := localBackupDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, ".git")); os.IsNotExist(err) {
+		return nil, fmt.Errorf("backup directory not initialized, run 'ccbackup init --exec' first")
+	}
+	return git.NewGit(backupDir), nil
+}
+
+func runLog(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+	asJSON, _ := cmd.Flags().GetBool("json")
+	filter, err := parseHistoryFilter(cmd)
+	if err != nil {
+		return err
+	}
+
+	g, err := openHistory("log")
+	if err != nil {
+		return err
+	}
+	commits, err := g.History()
+	if err != nil {
+		return err
+	}
+
+	runs := []*backupRun{}
+	for i := len(commits) - 1; i >= 0; i-- {
+		if !filter.InRange(commits[i].Time) {
+			continue
+		}
+		run, err := summarizeRun(g, commits[i], filter)
+		if err != nil {
+			return err
+		}
+		if filter.Project != "" && run.FilesChanged == 0 {
+			continue
+		}
+		// The per-session list belongs to show
+		run.Sessions = nil
+		runs = append(runs, run)
+	}
+
+	if asJSON {
+		return writeJSON(out, runs)
+	}
+	if len(runs) == 0 {
+		fmt.Fprintln(out, "No backups.")
+		return nil
+	}
+	fmt.Fprintf(out, "%-7s  %-16s  %8s  %9s  %s\n", "COMMIT", "TIME", "SESSIONS", "ADDED", "PROJECTS")
+	for _, r := range runs {
+		fmt.Fprintf(out, "%-7s  %-16s  %8d  %9s  %s\n",
+			r.Commit[:7], r.Time.Local().Format("2006-01-02 15:04"), r.SessionsChanged, formatSize(r.BytesAdded), strings.Join(r.Projects, ", "))
+	}
+	return nil
+}
+
+// writeJSON prints v as indented JSON.
+func writeJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/config"
+	"github.com/takoeight0821/ccbackup/internal/remap"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+// projectRoots returns the working directory of every project under
+// projects/ of root, read from the cwd fields of its transcripts. Only
+// working directories that encode to the project's name are used.
+func projectRoots(fsys storage.FS, root string) (map[string]string, error) {
+	listed, err := sync.List(fsys, root, sync.NewFilter([]string{"projects"}))
+	if err != nil {
+		return nil, fmt.Errorf("list projects: %w", err)
+	}
+	roots := map[string]string{}
+	for _, item := range listed.Items {
+		parts := strings.Split(filepath.ToSlash(item.RelPath), "/")
+		if len(parts) != 3 || filepath.Ext(parts[2]) != ".jsonl" || roots[parts[1]] != "" {
+			continue
+		}
+		cwd, err := readFirstCWD(fsys, item.SrcPath)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", item.RelPath, err)
+		}
+		if cwd != "" && remap.EncodeProject(cwd) == parts[1] {
+			roots[parts[1]] = cwd
+		}
+	}
+	return roots, nil
+}
+
+// projectLocalSource returns the source of the local Claude files of a
+// project whose working directory is dir.
+func projectLocalSource(project, dir string) backupSource {
+	prefix := path.Join(config.ProjectLocalDir, project)
+	return backupSource{
+		Name:   prefix,
+		Dir:    dir,
+		Prefix: prefix,
+		Filter: sync.NewFilter(viper.GetStringSlice("project_local.include")),
+	}
+}
+
+// warnProjectLocal reports that the local files of projects are skipped
+// where they are not supported, if they are enabled explicitly rather
+// than by default.
+func warnProjectLocal(out io.Writer, useCAS bool) {
+	if useCAS && viper.GetBool("project_local.enabled") && explicitSetting("project_local.enabled") {
+		fmt.Fprintf(out, "Warning: project_local is not supported with repository: %s, the local files of projects are skipped; "+
+			"set project_local.enabled: false to silence this\n", repositoryCAS)
+	}
+}
+
+// projectLocalSources returns a source for every project of sourceDir whose
+// working directory still exists on this machine.
+func projectLocalSources(sourceDir string) ([]backupSource, error) {
+	if !viper.GetBool("project_local.enabled") {
+		return nil, nil
+	}
+	roots, err := projectRoots(storage.NewOSFS(), sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("project_local: %w", err)
+	}
+	var sources []backupSource
+	for project, dir := range roots {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			sources = append(sources, projectLocalSource(project, dir))
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+	return sources, nil
+}
+
+// restoreProjectLocalSources returns a source for every project with local
+// files under root of a backup whose working directory, moved by mapper if
+// not nil, exists on this machine. The other projects are reported to out.
+func restoreProjectLocalSources(out io.Writer, fsys storage.FS, root string, mapper *remap.Mapper) ([]backupSource, error) {
+	if !viper.GetBool("project_local.enabled") {
+		return nil, nil
+	}
+	projects, err := listNames(fsys, filepath.Join(root, config.ProjectLocalDir))
+	if err != nil || len(projects) == 0 {
+		return nil, err
+	}
+	roots, err := projectRoots(fsys, root)
+	if err != nil {
+		return nil, fmt.Errorf("project_local: %w", err)
+	}
+
+	var sources []backupSource
+	for _, project := range projects {
+		dir, ok := roots[project]
+		if !ok {
+			fmt.Fprintf(out, "Skipped local files of %s: working directory unknown\n", project)
+			continue
+		}
+		if mapper != nil {
+			if mapped, ok := mapper.MapPath(dir); ok {
+				dir = mapped
+			}
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			fmt.Fprintf(out, "Skipped local files of %s: %s does not exist\n", project, dir)
+			continue
+		}
+		sources = append(sources, projectLocalSource(project, dir))
+	}
+	return sources, nil
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/retention"
+)
+
+var pruneHistoryCmd = &cobra.Command{
+	Use:   "prune-history",
+	Short: "Thin old backup commits with a retention policy",
+	Long: `Rewrite the linear backup history to keep only the newest commit of each
+hour, day, week and month covered by the --keep-* options, then run git gc.
+Tagged commits and the newest commit are always kept. Use -1 for no limit.`,
+	RunE: runPruneHistory,
+}
+
+func init() {
+	rootCmd.AddCommand(pruneHistoryCmd)
+	pruneHistoryCmd.Flags().Int("keep-hourly", 0, "number of hours to keep one commit for")
+	pruneHistoryCmd.Flags().Int("keep-daily", 0, "number of days to keep one commit for")
+	pruneHistoryCmd.Flags().Int("keep-weekly", 0, "number of weeks to keep one commit for")
+	pruneHistoryCmd.Flags().Int("keep-monthly", 0, "number of months to keep one commit for")
+}
+
+func runPruneHistory(cmd *cobra.Command, args []string) error {
+	exec := viper.GetBool("exec")
+	verbose := viper.GetBool("verbose")
+	out := cmd.OutOrStdout()
+
+	var policy retention.Policy
+	for _, opt := range []struct {
+		flag  string
+		count *int
+	}{
+		{"keep-hourly", &policy.Hourly},
+		{"keep-daily", &policy.Daily},
+		{"keep-weekly", &policy.Weekly},
+		{"keep-monthly", &policy.Monthly},
+	} {
+		*opt.count, _ = cmd.Flags().GetInt(opt.flag)
+		// Other negative counts would keep only the latest commit
+		if *opt.count < retention.Unlimited {
+			return fmt.Errorf("invalid --%s %d, want 0 or more, or %d for no limit", opt.flag, *opt.count, retention.Unlimited)
+		}
+	}
+	if policy.Empty() {
+		return fmt.Errorf("no retention policy given, set at least one --keep-* option")
+	}
+
+	g, err := openHistory("prune-history")
+	if err != nil {
+		return err
+	}
+	commits, err := g.History()
+	if err != nil {
+		return fmt.Errorf("read history: %w", err)
+	}
+
+	times := make([]time.Time, len(commits))
+	for i, c := range commits {
+		times[i] = c.Time
+	}
+	reasons := policy.Apply(times)
+
+	var keep []git.Commit
+	for i, c := range commits {
+		if len(c.Tags) > 0 {
+			reasons[i] = append(reasons[i], "tag "+strings.Join(c.Tags, ", "))
+		}
+		action := "drop"
+		if len(reasons[i]) > 0 {
+			action = "keep"
+			keep = append(keep, c)
+		}
+		if verbose || !exec {
+			line := fmt.Sprintf("%s  %s  %s  %s", action, c.ShortHash(), c.Time.Local().Format("2006-01-02 15:04"), c.Subject)
+			if len(reasons[i]) > 0 {
+				line += " (" + strings.Join(reasons[i], ", ") + ")"
+			}
+			fmt.Fprintln(out, line)
+		}
+	}
+
+	if len(keep) == len(commits) {
+		fmt.Fprintf(out, "Nothing to prune: keeping all %d commits.\n", len(commits))
+		return nil
+	}
+
+	if !exec {
+		fmt.Fprintf(out, "\nWould keep %d of %d commits.\n", len(keep), len(commits))
+		fmt.Fprintln(out, "Would run: git reflog expire --expire=now --all && git gc --prune=now")
+		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
+		return nil
+	}
+
+	if err := g.RewriteHistory(keep); err != nil {
+		return fmt.Errorf("rewrite history: %w", err)
+	}
+	fmt.Fprintf(out, "Kept %d of %d commits.\n", len(keep), len(commits))
+
+	if err := g.GC(); err != nil {
+		return fmt.Errorf("git gc: %w", err)
+	}
+	lfs := git.NewLFS(g.Dir)
+	if lfs.Available() {
+		if err := lfs.Prune(); err != nil {
+			return fmt.Errorf("git lfs prune: %w", err)
+		}
+	}
+	if verbose {
+		fmt.Fprintln(out, "Ran git gc")
+	}
+	return nil
+}
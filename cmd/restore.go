@@ -2,11 +2,20 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/manifest"
+	"github.com/takoeight0821/ccbackup/internal/remap"
+	"github.com/takoeight0821/ccbackup/internal/storage"
 	"github.com/takoeight0821/ccbackup/internal/sync"
 )
 
@@ -19,6 +28,10 @@ var restoreCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().String("snapshot", "", "restore this snapshot ID instead of the latest (repository: cas)")
+	restoreCmd.Flags().String("at", "", "restore the backup as of a commit, tag or date such as 2026-09-01T12:00")
+	restoreCmd.Flags().String("from-host", "", "restore the data another machine backed up to hosts/<host>/")
+	restoreCmd.Flags().StringArray("map", nil, "move projects from one directory to another, e.g. /Users/alice/src=/home/alice/work (repeatable)")
 }
 
 func runRestore(cmd *cobra.Command, args []string) error {
@@ -26,51 +39,200 @@ func runRestore(cmd *cobra.Command, args []string) error {
 	verbose := viper.GetBool("verbose")
 	out := cmd.OutOrStdout()
 
-	sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
-	if err != nil {
-		return fmt.Errorf("expand source_dir: %w", err)
+	if err := checkConfig(out, verbose); err != nil {
+		return err
 	}
 
-	backupDir, err := paths.ExpandHome(viper.GetString("backup_dir"))
+	src, err := openBackupDir(viper.GetString("backup_dir"))
 	if err != nil {
-		return fmt.Errorf("expand backup_dir: %w", err)
+		return err
 	}
 
-	// Restore is the reverse of backup: from backupDir to sourceDir
-	// Use include patterns to filter what gets restored
-	includePatterns := viper.GetStringSlice("include")
+	useCAS, err := casMode()
+	if err != nil {
+		return err
+	}
+	snapshotID, _ := cmd.Flags().GetString("snapshot")
+	if snapshotID != "" && !useCAS {
+		return fmt.Errorf("--snapshot requires repository: %s", repositoryCAS)
+	}
+	at, _ := cmd.Flags().GetString("at")
+	if at != "" && useCAS {
+		return fmt.Errorf("--at requires repository: %s, use --snapshot instead", repositoryGit)
+	}
+	if err := checkHostNamespace(useCAS); err != nil {
+		return err
+	}
+	if err := checkSources(useCAS); err != nil {
+		return err
+	}
+	warnProjectLocal(out, useCAS)
+	fromHost, _ := cmd.Flags().GetString("from-host")
+	if fromHost != "" {
+		if useCAS {
+			return fmt.Errorf("--from-host requires repository: %s", repositoryGit)
+		}
+		if err := validateHost(fromHost); err != nil {
+			return err
+		}
+	}
 
-	syncer := sync.NewSyncer(backupDir, sourceDir, includePatterns)
+	// Restore is the reverse of backup: from the backup to each source
+	sources, err := backupSources()
+	if err != nil {
+		return err
+	}
+	syncer := sync.NewSyncer(src.Root, sources[0].Dir, nil)
+	syncer.Filter = sources[0].Filter
+	syncer.SrcFS = src.FS
 	syncer.DryRun = !exec
 	syncer.Verbose = verbose
+	runs := []*sourceSync{{source: sources[0], syncer: syncer}}
+
+	var m *manifest.Manifest
+	if useCAS {
+		snap, snapFS, err := openCASSnapshot(src, snapshotID)
+		if err != nil {
+			return err
+		}
+		if snap == nil {
+			fmt.Fprintln(out, "No snapshots to restore.")
+			return nil
+		}
+		fmt.Fprintf(out, "Snapshot %s (%s)\n", snap.ShortID(), snap.Time.Local().Format("2006-01-02 15:04"))
+		syncer.SrcFS, syncer.SrcDir = snapFS, "."
+	} else {
+		if at != "" {
+			if src.Remote {
+				return fmt.Errorf("backup_dir %s has no git history", viper.GetString("backup_dir"))
+			}
+			commit, err := resolveAt(git.NewGit(src.Root), at)
+			if err != nil {
+				return err
+			}
+			tree, err := git.NewTreeFS(src.Root, commit.Hash)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Commit %s (%s) %s\n", commit.ShortHash(), commit.Time.Local().Format("2006-01-02 15:04"), commit.Subject)
+			syncer.SrcFS, syncer.SrcDir = tree, "."
+		}
+
+		// Each machine's data is under hosts/<host>/ when namespaced
+		if fromHost != "" {
+			dir := hostRoot(syncer.SrcDir, fromHost)
+			ok, err := hasFiles(syncer.SrcFS, dir)
+			if err != nil {
+				return fmt.Errorf("host %s: %w", fromHost, err)
+			}
+			if !ok {
+				hosts, err := listHosts(syncer.SrcFS, syncer.SrcDir)
+				if err != nil {
+					return err
+				}
+				if len(hosts) == 0 {
+					return fmt.Errorf("backup has no data of host %s", fromHost)
+				}
+				return fmt.Errorf("backup has no data of host %s, hosts: %s", fromHost, strings.Join(hosts, ", "))
+			}
+			syncer.SrcDir = dir
+		} else if syncer.SrcDir, err = dataRoot(syncer.SrcDir); err != nil {
+			return err
+		}
+
+		// The manifest restores source mtimes and modes that a clone loses.
+		// Remote stores list objects with their upload times, so the last
+		// snapshot supplies them
+		if src.Remote {
+			m, err = manifest.Latest(syncer.SrcFS, syncer.SrcDir)
+		} else {
+			m, err = manifest.Read(syncer.SrcFS, filepath.Join(syncer.SrcDir, manifest.Path))
+		}
+		switch {
+		case err == nil:
+			syncer.Metadata = m.Metadata
+		case !errors.Is(err, fs.ErrNotExist):
+			fmt.Fprintf(out, "Warning: ignoring manifest: %v\n", err)
+			m = nil
+		}
+
+	}
+
+	mappings, _ := cmd.Flags().GetStringArray("map")
+	var mapper *remap.Mapper
+	var moves []projectMove
+	if len(mappings) > 0 {
+		if mapper, moves, err = applyPathMap(syncer, mappings); err != nil {
+			return err
+		}
+	}
+
+	if !useCAS {
+		// Additional sources are restored from their dest, if backed up
+		local, err := restoreProjectLocalSources(out, syncer.SrcFS, syncer.SrcDir, mapper)
+		if err != nil {
+			return err
+		}
+		for _, source := range append(sources[1:], local...) {
+			dir := source.backupDir(syncer.SrcDir)
+			ok, err := hasFiles(syncer.SrcFS, dir)
+			if err != nil {
+				return fmt.Errorf("source %s: %w", source.Name, err)
+			}
+			if !ok {
+				continue
+			}
+			s := sync.NewSyncer(dir, source.Dir, nil)
+			s.Filter = source.Filter
+			s.SrcFS = syncer.SrcFS
+			s.DryRun = !exec
+			s.Verbose = verbose
+			if m != nil {
+				s.Metadata = m.Sub(source.Prefix).Metadata
+			}
+			runs = append(runs, &sourceSync{source: source, syncer: s})
+		}
+	}
 
 	ctx := context.Background()
 
+	plan, err := planSources(ctx, runs)
+	if err != nil {
+		return fmt.Errorf("plan: %w", err)
+	}
+
 	if !exec {
 		// Dry-run: show what would be restored
-		plan, err := syncer.Plan(ctx)
-		if err != nil {
-			return fmt.Errorf("plan: %w", err)
-		}
 
 		for _, w := range plan.Warnings {
 			fmt.Fprintf(out, "Warning: %s: %v\n", w.RelPath, w.Err)
 		}
 
+		for _, mv := range moves {
+			fmt.Fprintf(out, "Would move project: %s -> %s\n", mv.From, mv.To)
+		}
+
 		if len(plan.Items) == 0 {
 			fmt.Fprintln(out, "No changes to restore.")
 			return nil
 		}
 
-		for _, item := range plan.Items {
-			fmt.Fprintf(out, "Would restore: %s (%s)\n", item.RelPath, formatSize(item.Size))
+		for _, run := range runs {
+			for _, item := range run.plan.Items {
+				rel := run.source.relPath(item.RelPath)
+				if dst, _ := filepath.Rel(run.syncer.DstDir, item.DstPath); dst != item.RelPath {
+					fmt.Fprintf(out, "Would restore: %s -> %s (%s)\n", rel, dst, formatSize(item.Size))
+					continue
+				}
+				fmt.Fprintf(out, "Would restore: %s (%s)\n", rel, formatSize(item.Size))
+			}
 		}
 		fmt.Fprintln(out, "\nRun with --exec to apply changes.")
 		return nil
 	}
 
 	// Execute restore
-	result, err := syncer.Execute(ctx)
+	result, err := applySources(ctx, runs)
 	if err != nil {
 		return fmt.Errorf("sync: %w", err)
 	}
@@ -88,13 +250,110 @@ func runRestore(cmd *cobra.Command, args []string) error {
 	if result.CopiedCount > 0 {
 		fmt.Fprintf(out, "Restored %d files (%s)\n", result.CopiedCount, formatSize(result.TotalBytes))
 	}
+	for _, mv := range moves {
+		fmt.Fprintf(out, "Moved project: %s -> %s\n", mv.From, mv.To)
+	}
+
+	return syncErrors(out, result)
+}
+
+// dateLayouts are the date formats accepted on the command line, in local time.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	dateOnly,
+}
+
+const dateOnly = "2006-01-02"
+
+// parseDate parses a command line date and reports whether it had no time of day.
+func parseDate(s string) (t time.Time, isDateOnly, ok bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, layout == dateOnly, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// resolveAt returns the commit named by at, or the newest commit made
+// at or before it if at is a date.
+func resolveAt(g *git.Git, at string) (git.Commit, error) {
+	if t, _, ok := parseDate(at); ok {
+		return g.CommitBefore(t)
+	}
+	return g.ResolveCommit(at)
+}
+
+// projectMove is a project directory renamed by restore --map.
+type projectMove struct {
+	From, To string
+}
+
+// applyPathMap sets up syncer to move projects by FROM=TO mappings: project
+// directories are renamed and the cwd fields of transcripts rewritten.
+// It returns the mapper and the renamed project directories, sorted.
+func applyPathMap(syncer *sync.Syncer, mappings []string) (*remap.Mapper, []projectMove, error) {
+	rules := make([]remap.Rule, 0, len(mappings))
+	for _, s := range mappings {
+		r, err := remap.ParseRule(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		rules = append(rules, r)
+	}
+	mapper := remap.New(rules)
+
+	// Project names are ambiguous; the cwd of a transcript is not
+	roots, err := projectRoots(syncer.SrcFS, syncer.SrcDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for project, cwd := range roots {
+		mapper.AddProject(project, cwd)
+	}
+
+	listed, err := sync.List(syncer.SrcFS, syncer.SrcDir, syncer.Filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list: %w", err)
+	}
+	var moves []projectMove
+	seen := map[string]bool{}
+	for _, item := range listed.Items {
+		parts := strings.Split(filepath.ToSlash(item.RelPath), "/")
+		if len(parts) < 3 || parts[0] != "projects" || seen[parts[1]] {
+			continue
+		}
+		seen[parts[1]] = true
+		if dir, ok := mapper.ProjectDir(parts[1]); ok && dir != parts[1] {
+			moves = append(moves, projectMove{From: parts[1], To: dir})
+		}
+	}
+	sort.Slice(moves, func(i, j int) bool { return moves[i].From < moves[j].From })
 
-	if len(result.Errors) > 0 {
-		for _, e := range result.Errors {
-			fmt.Fprintf(out, "Failed: %s: %v\n", e.RelPath, e.Err)
+	syncer.Rename = func(relPath string) string {
+		return filepath.FromSlash(mapper.RelPath(filepath.ToSlash(relPath)))
+	}
+	transform := syncer.Transform
+	syncer.Transform = func(relPath string, data []byte) ([]byte, error) {
+		if transform != nil {
+			var err error
+			if data, err = transform(relPath, data); err != nil {
+				return nil, err
+			}
 		}
-		return fmt.Errorf("%d file(s) failed to sync", len(result.Errors))
+		return mapper.Transform(relPath, data)
 	}
+	return mapper, moves, nil
+}
 
-	return nil
+func readFirstCWD(fsys storage.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return remap.FirstCWD(f)
 }
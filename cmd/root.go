@@ -7,6 +7,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/profile"
 )
 
 var cfgFile string
@@ -53,21 +54,31 @@ func initConfig() {
 	_ = viper.ReadInConfig()
 
 	// Set defaults
-	setDefaults(home)
+	setDefaults(viper.GetViper(), home)
 }
 
-func setDefaults(home string) {
-	viper.SetDefault("source_dir", filepath.Join(home, ".claude"))
-	viper.SetDefault("backup_dir", filepath.Join(home, "claude-backup"))
-	viper.SetDefault("include", []string{
-		"projects",
-		"history.jsonl",
-		"plans",
-		"todos",
-		"usage-data",
-		"stats-cache.json",
+// setDefaults sets the default of every setting on v.
+func setDefaults(v *viper.Viper, home string) {
+	v.SetDefault("source_dir", filepath.Join(home, ".claude"))
+	v.SetDefault("backup_dir", filepath.Join(home, "claude-backup"))
+	claude, _ := profile.Lookup(profile.ClaudeCode)
+	v.SetDefault("include", claude.Include)
+	v.SetDefault("exclude", []string{})
+	v.SetDefault("sources", []map[string]interface{}{})
+	v.SetDefault("project_local.enabled", true)
+	v.SetDefault("project_local.include", []string{
+		"CLAUDE.md",
+		"CLAUDE.local.md",
+		".claude/settings.local.json",
+		".claude/commands",
 	})
-	viper.SetDefault("lfs_patterns", []string{})
+	v.SetDefault("lfs_patterns", []string{})
+	v.SetDefault("repository", "git")
+	v.SetDefault("host_namespace", false)
+	v.SetDefault("cas.compression", true)
+	v.SetDefault("secrets.enabled", true)
+	v.SetDefault("secrets.builtin_action", "warn")
+	v.SetDefault("secrets.rules", []map[string]string{})
 }
 
 // configFilePath returns the path to the config file.
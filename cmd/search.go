@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/search"
+	"github.com/takoeight0821/ccbackup/internal/session"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search session transcripts",
+	Long: `Search user and assistant messages, tool inputs and tool outputs in
+projects/**/*.jsonl for messages containing every word of the query.
+A local index is updated incrementally before each search; it is stored in
+search.index, by default in the user cache directory.
+With --history, sessions that only exist in the backup history are searched too.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runSearch,
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+	searchCmd.Flags().String("project", "", "only sessions of projects whose directory name contains this")
+	searchCmd.Flags().String("since", "", "only messages at or after this date, e.g. 2026-09-01 or 2026-09-01T12:00")
+	searchCmd.Flags().String("until", "", "only messages at or before this date")
+	searchCmd.Flags().String("role", "", "only messages of this role: user, assistant or tool")
+	searchCmd.Flags().String("tool", "", "only inputs and outputs of this tool, e.g. Bash")
+	searchCmd.Flags().Bool("history", false, "also search sessions found only in older backup commits")
+	searchCmd.Flags().Int("limit", 20, "maximum number of results, 0 for no limit")
+}
+
+// searchSnippetWidth is the length of the text shown per result.
+const searchSnippetWidth = 100
+
+func runSearch(cmd *cobra.Command, args []string) error {
+	verbose := viper.GetBool("verbose")
+	out := cmd.OutOrStdout()
+
+	filter, err := parseHistoryFilter(cmd)
+	if err != nil {
+		return err
+	}
+	q := search.Query{
+		Text:    strings.Join(args, " "),
+		Project: filter.Project,
+		Since:   filter.Since,
+		Until:   filter.Until,
+	}
+	q.Role, _ = cmd.Flags().GetString("role")
+	q.Tool, _ = cmd.Flags().GetString("tool")
+	q.History, _ = cmd.Flags().GetBool("history")
+	limit, _ := cmd.Flags().GetInt("limit")
+	switch q.Role {
+	case "", search.RoleUser, search.RoleAssistant, search.RoleTool:
+	default:
+		return fmt.Errorf("invalid --role %q, want user, assistant or tool", q.Role)
+	}
+	if len(search.Tokens(q.Text)) == 0 {
+		return fmt.Errorf("query %q has no words to search for", q.Text)
+	}
+
+	sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
+	if err != nil {
+		return fmt.Errorf("expand source_dir: %w", err)
+	}
+	indexPath, err := searchIndexPath()
+	if err != nil {
+		return err
+	}
+	ix, err := search.Load(indexPath)
+	if err != nil {
+		return fmt.Errorf("load index: %w", err)
+	}
+
+	live, err := liveTranscripts(sourceDir)
+	if err != nil {
+		return err
+	}
+	stats, err := ix.Update(live, false)
+	if err != nil {
+		return err
+	}
+
+	var g *git.Git
+	if q.History {
+		if g, err = openHistory("search --history"); err != nil {
+			return err
+		}
+		old, err := historyTranscripts(g, live)
+		if err != nil {
+			return err
+		}
+		historyStats, err := ix.Update(old, true)
+		if err != nil {
+			return err
+		}
+		stats.Added += historyStats.Added
+		stats.Updated += historyStats.Updated
+		stats.Removed += historyStats.Removed
+	}
+	if err := ix.Save(indexPath); err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	if verbose {
+		fmt.Fprintf(out, "Index %s: %d added, %d updated, %d removed\n", indexPath, stats.Added, stats.Updated, stats.Removed)
+	}
+
+	hits := ix.Search(q)
+	if len(hits) == 0 {
+		fmt.Fprintln(out, "No matches.")
+		return nil
+	}
+	shown := hits
+	if limit > 0 && len(hits) > limit {
+		shown = hits[:limit]
+	}
+
+	for _, h := range shown {
+		block, err := readHit(sourceDir, g, h)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", h.File.Path, err)
+		}
+		when := "unknown time"
+		if !h.Doc.Time.IsZero() {
+			when = h.Doc.Time.Local().Format("2006-01-02 15:04")
+		}
+		role := h.Doc.Role
+		if h.Doc.Tool != "" {
+			role += " " + h.Doc.Tool
+		}
+		host, rel := session.SplitHost(h.File.Path)
+		where := strings.TrimSuffix(strings.TrimPrefix(rel, "projects/"), ".jsonl")
+		if host != "" {
+			where = host + ":" + where
+		}
+		if h.File.Object != "" {
+			where += " (backup only)"
+		}
+		fmt.Fprintf(out, "%s  %s  %s\n", when, where, role)
+		fmt.Fprintf(out, "    %s\n", search.Snippet(block.Text, q.Text, searchSnippetWidth))
+	}
+
+	if len(shown) < len(hits) {
+		fmt.Fprintf(out, "\nShowing %d of %d matches (use --limit 0 for all).\n", len(shown), len(hits))
+	} else {
+		fmt.Fprintf(out, "\n%d matches\n", len(hits))
+	}
+	return nil
+}
+
+// searchIndexPath returns search.index or the default in the user cache directory.
+func searchIndexPath() (string, error) {
+	if p := viper.GetString("search.index"); p != "" {
+		return paths.ExpandHome(p)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("search.index is not set: %w", err)
+	}
+	return filepath.Join(dir, "ccbackup", "search.idx"), nil
+}
+
+// liveTranscripts lists projects/**/*.jsonl under sourceDir.
+func liveTranscripts(sourceDir string) ([]search.Source, error) {
+	var sources []search.Source
+	root := filepath.Join(sourceDir, "projects")
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".jsonl" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		sources = append(sources, search.Source{
+			Key:     "live:" + rel,
+			Path:    rel,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Open:    func() (io.ReadCloser, error) { return os.Open(p) },
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list transcripts: %w", err)
+	}
+	return sources, nil
+}
+
+// historyTranscripts lists the last backed-up version of every transcript
+// that is not in live: those at HEAD, then those deleted from the backup.
+// Transcripts of every host are listed; those this machine backed up are
+// matched against live.
+func historyTranscripts(g *git.Git, live []search.Source) ([]search.Source, error) {
+	host, err := currentHost()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(live))
+	for _, s := range live {
+		seen[path.Join(hostRoot("", host), s.Path)] = true
+	}
+
+	head, err := g.TreeBlobs("HEAD", "projects", session.HostsDir)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := g.DeletedBlobs("projects", session.HostsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []search.Source
+	for _, b := range append(head, deleted...) {
+		_, rel := session.SplitHost(b.Path)
+		if seen[b.Path] || !strings.HasPrefix(rel, "projects/") || path.Ext(rel) != ".jsonl" {
+			continue
+		}
+		seen[b.Path] = true
+		sources = append(sources, search.Source{
+			Key:    "git:" + b.Object + ":" + b.Path,
+			Path:   b.Path,
+			Object: b.Object,
+			Open:   func() (io.ReadCloser, error) { return g.OpenBlob(b) },
+		})
+	}
+	return sources, nil
+}
+
+// readHit reads the matching block from the transcript it was indexed from.
+func readHit(sourceDir string, g *git.Git, h search.Hit) (search.Block, error) {
+	var r io.ReadCloser
+	var err error
+	if h.File.Object != "" {
+		r, err = g.OpenBlob(git.Blob{Path: h.File.Path, Object: h.File.Object})
+	} else {
+		r, err = os.Open(filepath.Join(sourceDir, filepath.FromSlash(h.File.Path)))
+	}
+	if err != nil {
+		return search.Block{}, err
+	}
+	defer r.Close()
+	return search.ReadBlock(r, h.Doc)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/scan"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+// newSecretScanner builds a scanner from the secrets config.
+// It returns nil if scanning is disabled.
+func newSecretScanner() (*scan.Scanner, error) {
+	if !viper.GetBool("secrets.enabled") {
+		return nil, nil
+	}
+
+	builtinAction := scan.ActionWarn
+	if name := viper.GetString("secrets.builtin_action"); name != "" {
+		a, err := scan.ParseAction(name)
+		if err != nil {
+			return nil, fmt.Errorf("builtin_action: %w", err)
+		}
+		builtinAction = a
+	}
+
+	var configs []scan.RuleConfig
+	if err := viper.UnmarshalKey("secrets.rules", &configs); err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+
+	rules, err := scan.CompileRules(scan.BuiltinRules(builtinAction), configs)
+	if err != nil {
+		return nil, err
+	}
+	return scan.NewScanner(rules), nil
+}
+
+// scanPlan scans the source files of every planned item.
+func scanPlan(scanner *scan.Scanner, plan *sync.PlanResult) (*scan.Report, error) {
+	files := make(map[string]string, len(plan.Items))
+	for _, item := range plan.Items {
+		files[item.RelPath] = item.SrcPath
+	}
+	return scanner.ScanFiles(files)
+}
+
+// printSecretReport prints scan findings with masked matches.
+func printSecretReport(out io.Writer, report *scan.Report) {
+	if len(report.Findings) == 0 {
+		fmt.Fprintln(out, "Secret scan: no findings.")
+		return
+	}
+
+	fmt.Fprintf(out, "\nSecret scan: %d finding(s)\n", len(report.Findings))
+	for _, f := range report.Findings {
+		fmt.Fprintf(out, "  %s:%d: %s [%s] %s\n", f.RelPath, f.Line, f.Rule, f.Action, f.Masked())
+	}
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/manifest"
+	"github.com/takoeight0821/ccbackup/internal/session"
+)
+
+var showCmd = &cobra.Command{
+	Use:   "show <rev>",
+	Short: "List the sessions changed by a backup run",
+	Long: `List the sessions created, extended or removed by a backup commit, given as
+a commit, tag or date, with the first prompt of each session.
+--since and --until select sessions by their last activity.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runShow,
+}
+
+func init() {
+	rootCmd.AddCommand(showCmd)
+	addHistoryFilterFlags(showCmd)
+	showCmd.Flags().Bool("json", false, "print JSON")
+}
+
+// maxPromptWidth bounds the first prompt printed per session.
+const maxPromptWidth = 60
+
+func runShow(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+	asJSON, _ := cmd.Flags().GetBool("json")
+	filter, err := parseHistoryFilter(cmd)
+	if err != nil {
+		return err
+	}
+
+	g, err := openHistory("show")
+	if err != nil {
+		return err
+	}
+	commit, err := resolveAt(g, args[0])
+	if err != nil {
+		return err
+	}
+	run, err := summarizeRun(g, commit, historyFilter{Project: filter.Project})
+	if err != nil {
+		return err
+	}
+
+	// Removed sessions are read from the parent commit
+	after := &revisionFiles{dir: g.Dir, rev: commit.Hash}
+	before := &revisionFiles{dir: g.Dir, rev: commit.Hash + "^"}
+	sessions := []sessionChange{}
+	for _, sc := range run.Sessions {
+		files := after
+		if sc.Change == sessionRemoved {
+			files = before
+		}
+		sc.LastActive = commit.Time
+		// Each host has its own manifest
+		_, rel := session.SplitHost(sc.path)
+		if m := files.manifest(sc.Host); m != nil {
+			if e, ok := m.Lookup(rel); ok {
+				sc.LastActive = e.ModTime
+			}
+		}
+		if !filter.InRange(sc.LastActive) {
+			continue
+		}
+		if sc.FirstPrompt, err = files.firstPrompt(sc.path); err != nil {
+			return err
+		}
+		sessions = append(sessions, sc)
+	}
+	run.Sessions, run.SessionsChanged = sessions, len(sessions)
+
+	if asJSON {
+		return writeJSON(out, run)
+	}
+
+	fmt.Fprintf(out, "Commit %s (%s) %s\n", commit.ShortHash(), commit.Time.Local().Format("2006-01-02 15:04"), commit.Subject)
+	fmt.Fprintf(out, "%d sessions changed, %d files changed, %s added\n", run.SessionsChanged, run.FilesChanged, formatSize(run.BytesAdded))
+	if len(sessions) == 0 {
+		return nil
+	}
+	fmt.Fprintln(out)
+	for _, sc := range sessions {
+		name := sc.Project + "/" + sc.Session
+		if sc.Host != "" {
+			name = sc.Host + ":" + name
+		}
+		fmt.Fprintf(out, "%-8s  %s (%s)\n", sc.Change, name, formatSize(sc.Size))
+		if sc.FirstPrompt != "" {
+			fmt.Fprintf(out, "          %q\n", truncatePrompt(sc.FirstPrompt, maxPromptWidth))
+		}
+	}
+	return nil
+}
+
+// truncatePrompt puts a prompt on one line of at most width runes.
+func truncatePrompt(prompt string, width int) string {
+	prompt = strings.Join(strings.Fields(prompt), " ")
+	runes := []rune(prompt)
+	if len(runes) <= width {
+		return prompt
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// revisionFiles lazily opens the tree and manifest of one revision.
+type revisionFiles struct {
+	dir, rev string
+
+	tree    *git.TreeFS
+	treeErr error
+	// manifests are keyed by host, "" for a backup not namespaced by host
+	manifests map[string]*manifest.Manifest
+}
+
+func (r *revisionFiles) open() (*git.TreeFS, error) {
+	if r.tree == nil && r.treeErr == nil {
+		r.tree, r.treeErr = git.NewTreeFS(r.dir, r.rev)
+	}
+	return r.tree, r.treeErr
+}
+
+// manifest returns the manifest of host committed in the revision, or nil.
+func (r *revisionFiles) manifest(host string) *manifest.Manifest {
+	if m, ok := r.manifests[host]; ok {
+		return m
+	}
+	var m *manifest.Manifest
+	if tree, err := r.open(); err == nil {
+		m, _ = manifest.Read(tree, filepath.Join(hostRoot(".", host), manifest.Path))
+	}
+	if r.manifests == nil {
+		r.manifests = map[string]*manifest.Manifest{}
+	}
+	r.manifests[host] = m
+	return m
+}
+
+func (r *revisionFiles) firstPrompt(name string) (string, error) {
+	tree, err := r.open()
+	if err != nil {
+		return "", err
+	}
+	f, err := tree.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", name, err)
+	}
+	defer f.Close()
+	prompt, err := session.FirstPrompt(f)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", name, err)
+	}
+	return prompt, nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "List snapshots of a CAS repository",
+	Long:  `List the snapshots stored in backup_dir with repository: cas, oldest first.`,
+	RunE:  runSnapshots,
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotsCmd)
+}
+
+func runSnapshots(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+
+	useCAS, err := casMode()
+	if err != nil {
+		return err
+	}
+	if !useCAS {
+		return fmt.Errorf("snapshots requires repository: %s", repositoryCAS)
+	}
+
+	dest, err := openBackupDir(viper.GetString("backup_dir"))
+	if err != nil {
+		return err
+	}
+	repo, err := openCASRepository(dest)
+	if err != nil {
+		return err
+	}
+	snapshots, err := repo.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Fprintln(out, "No snapshots.")
+		return nil
+	}
+	fmt.Fprintf(out, "%-8s  %-16s  %7s  %9s  %s\n", "ID", "TIME", "FILES", "SIZE", "WARNINGS")
+	for _, s := range snapshots {
+		fmt.Fprintf(out, "%-8s  %-16s  %7d  %9s  %d\n",
+			s.ShortID(), s.Time.Local().Format("2006-01-02 15:04"), len(s.Files), formatSize(s.Size()), len(s.Warnings))
+	}
+	return nil
+}
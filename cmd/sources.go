@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/config"
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+// backupSource is a directory backed up below Prefix of the backup's data root.
+type backupSource struct {
+	Name string
+	Dir  string
+	// Prefix is slash-separated, and empty for source_dir
+	Prefix string
+	Filter *sync.Filter
+}
+
+// backupDir returns the directory of the source below a backup data root.
+func (s backupSource) backupDir(root string) string {
+	return filepath.Join(root, filepath.FromSlash(s.Prefix))
+}
+
+// relPath returns a path of the source relative to the backup data root.
+func (s backupSource) relPath(rel string) string {
+	return filepath.Join(filepath.FromSlash(s.Prefix), rel)
+}
+
+// backupSources returns source_dir followed by the additional sources of
+// the config. source_dir is backed up to the data root itself, so it
+// excludes the destinations of the others.
+func backupSources() ([]backupSource, error) {
+	var configs []config.Source
+	if err := viper.UnmarshalKey("sources", &configs); err != nil {
+		return nil, fmt.Errorf("sources: %w", err)
+	}
+	configs, err := config.ResolveSources(configs, viper.GetStringSlice("include"))
+	if err != nil {
+		return nil, err
+	}
+
+	sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
+	if err != nil {
+		return nil, fmt.Errorf("expand source_dir: %w", err)
+	}
+	exclude := append(viper.GetStringSlice("exclude"), config.ProjectLocalDir)
+
+	sources := []backupSource{{Name: config.PrimarySource, Dir: sourceDir}}
+	for _, c := range configs {
+		dir, err := paths.ExpandHome(c.Root)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: expand root: %w", c.Name, err)
+		}
+		exclude = append(exclude, c.Dest)
+		sources = append(sources, backupSource{
+			Name:   c.Name,
+			Dir:    dir,
+			Prefix: c.Dest,
+			Filter: sync.NewFilter(c.Include).Exclude(c.Exclude),
+		})
+	}
+	sources[0].Filter = sync.NewFilter(viper.GetStringSlice("include")).Exclude(exclude)
+	return sources, nil
+}
+
+// checkSources rejects additional sources where they are not supported.
+func checkSources(useCAS bool) error {
+	var configs []config.Source
+	if useCAS && viper.UnmarshalKey("sources", &configs) == nil && len(configs) > 0 {
+		return fmt.Errorf("sources are not supported with repository: %s", repositoryCAS)
+	}
+	return nil
+}
+
+// sourceSync is the syncer of one source and its plan.
+type sourceSync struct {
+	source backupSource
+	syncer *sync.Syncer
+	plan   *sync.PlanResult
+}
+
+// planSources plans every syncer and returns their combined plan, with
+// paths relative to the backup data root.
+func planSources(ctx context.Context, runs []*sourceSync) (*sync.PlanResult, error) {
+	combined := &sync.PlanResult{}
+	for _, run := range runs {
+		plan, err := run.syncer.Plan(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", run.source.Name, err)
+		}
+		run.plan = plan
+		for _, item := range plan.Items {
+			item.RelPath = run.source.relPath(item.RelPath)
+			combined.Items = append(combined.Items, item)
+		}
+		for _, w := range plan.Warnings {
+			w.RelPath = run.source.relPath(w.RelPath)
+			combined.Warnings = append(combined.Warnings, w)
+		}
+	}
+	return combined, nil
+}
+
+// applySources applies the plans of planSources and returns the combined result.
+func applySources(ctx context.Context, runs []*sourceSync) (*sync.SyncResult, error) {
+	combined := &sync.SyncResult{}
+	for _, run := range runs {
+		result, err := run.syncer.Apply(ctx, run.plan)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", run.source.Name, err)
+		}
+		combined.CopiedCount += result.CopiedCount
+		combined.TotalBytes += result.TotalBytes
+		for _, item := range result.Items {
+			item.RelPath = run.source.relPath(item.RelPath)
+			combined.Items = append(combined.Items, item)
+		}
+		for _, e := range result.Errors {
+			e.RelPath = run.source.relPath(e.RelPath)
+			combined.Errors = append(combined.Errors, e)
+		}
+	}
+	return combined, nil
+}
+
+// errFound stops a walk once it has found what it looks for.
+var errFound = errors.New("found")
+
+// hasFiles reports whether dir holds any file. A missing dir holds none.
+// Object stores have no directories, only key prefixes, so Stat cannot
+// tell whether one exists.
+func hasFiles(fsys storage.FS, dir string) (bool, error) {
+	err := fsys.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return errFound
+		}
+		return nil
+	})
+	if errors.Is(err, errFound) {
+		return true, nil
+	}
+	return false, err
+}
+
+// sourceFilter returns the filter of source_dir.
+func sourceFilter() (*sync.Filter, error) {
+	sources, err := backupSources()
+	if err != nil {
+		return nil, err
+	}
+	return sources[0].Filter, nil
+}
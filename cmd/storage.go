@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/storage/s3"
+	"github.com/takoeight0821/ccbackup/internal/storage/webdav"
+)
+
+// backupLocation is where backup_dir points: a local directory
+// or a prefix in a remote store that git cannot run on.
+type backupLocation struct {
+	FS     storage.FS
+	Root   string
+	Remote bool
+}
+
+// openBackupDir resolves a backup_dir value to a backup location.
+func openBackupDir(raw string) (*backupLocation, error) {
+	if s3.IsURL(raw) {
+		bucket, prefix, err := s3.ParseURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &backupLocation{FS: s3.New(bucket, s3Config()), Root: prefix, Remote: true}, nil
+	}
+
+	if webdav.IsURL(raw) {
+		baseURL, err := webdav.ParseURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		fsys, err := webdav.New(baseURL, webdavConfig())
+		if err != nil {
+			return nil, err
+		}
+		return &backupLocation{FS: fsys, Root: "", Remote: true}, nil
+	}
+
+	dir, err := paths.ExpandHome(raw)
+	if err != nil {
+		return nil, fmt.Errorf("expand backup_dir: %w", err)
+	}
+	return &backupLocation{FS: storage.NewOSFS(), Root: dir}, nil
+}
+
+// s3Config reads the s3 section of the config,
+// falling back to the standard AWS environment variables.
+func s3Config() s3.Config {
+	return s3.Config{
+		Endpoint:  viper.GetString("s3.endpoint"),
+		Region:    firstNonEmpty(viper.GetString("s3.region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+		PathStyle: viper.GetBool("s3.path_style"),
+		Credentials: s3.Credentials{
+			AccessKeyID:     firstNonEmpty(viper.GetString("s3.access_key_id"), os.Getenv("AWS_ACCESS_KEY_ID")),
+			SecretAccessKey: firstNonEmpty(viper.GetString("s3.secret_access_key"), os.Getenv("AWS_SECRET_ACCESS_KEY")),
+			SessionToken:    firstNonEmpty(viper.GetString("s3.session_token"), os.Getenv("AWS_SESSION_TOKEN")),
+		},
+	}
+}
+
+// webdavConfig reads the webdav section of the config,
+// falling back to CCBACKUP_WEBDAV_USERNAME and CCBACKUP_WEBDAV_PASSWORD.
+func webdavConfig() webdav.Config {
+	return webdav.Config{
+		Username: firstNonEmpty(viper.GetString("webdav.username"), os.Getenv("CCBACKUP_WEBDAV_USERNAME")),
+		Password: firstNonEmpty(viper.GetString("webdav.password"), os.Getenv("CCBACKUP_WEBDAV_PASSWORD")),
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
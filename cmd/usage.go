@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/search"
+	"github.com/takoeight0821/ccbackup/internal/usage"
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report token usage and estimated cost",
+	Long: `Sum the token usage of assistant responses in projects/**/*.jsonl by project,
+model, day or session, and estimate its cost from a per-model price table.
+Transcripts are read from the source and, with a local git backup, from the
+backup history, so sessions Claude Code has since deleted are counted too.
+Prices in US dollars per million tokens can be added or overridden in
+usage.prices; models are matched by the longest model prefix.`,
+	Args: cobra.NoArgs,
+	RunE: runUsage,
+}
+
+func init() {
+	rootCmd.AddCommand(usageCmd)
+	addHistoryFilterFlags(usageCmd)
+	usageCmd.Flags().String("by", usage.ByProject, "break down by project, model, day or session")
+	usageCmd.Flags().String("format", "table", "output format (table, csv or json)")
+	usageCmd.Flags().Bool("source-only", false, "do not read transcripts from the backup history")
+}
+
+// usageReport is the JSON output of usage.
+type usageReport struct {
+	By    string      `json:"by"`
+	Rows  []usage.Row `json:"rows"`
+	Total usage.Row   `json:"total"`
+}
+
+func runUsage(cmd *cobra.Command, args []string) error {
+	verbose := viper.GetBool("verbose")
+	out := cmd.OutOrStdout()
+
+	filter, err := parseHistoryFilter(cmd)
+	if err != nil {
+		return err
+	}
+	by, _ := cmd.Flags().GetString("by")
+	format, _ := cmd.Flags().GetString("format")
+	switch format {
+	case "table", "csv", "json":
+	default:
+		return fmt.Errorf("unknown format %q, want table, csv or json", format)
+	}
+	sourceOnly, _ := cmd.Flags().GetBool("source-only")
+
+	var configs []usage.Price
+	if err := viper.UnmarshalKey("usage.prices", &configs); err != nil {
+		return fmt.Errorf("usage.prices: %w", err)
+	}
+	prices, err := usage.NewPriceTable(configs)
+	if err != nil {
+		return fmt.Errorf("usage.prices: %w", err)
+	}
+
+	sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
+	if err != nil {
+		return fmt.Errorf("expand source_dir: %w", err)
+	}
+	sources, err := liveTranscripts(sourceDir)
+	if err != nil {
+		return err
+	}
+	live := len(sources)
+	if !sourceOnly {
+		// Without a local git backup there is no history to add
+		g, err := openHistory("usage")
+		if err == nil {
+			_, err = g.ResolveCommit("HEAD")
+		}
+		if err == nil {
+			old, err := historyTranscripts(g, sources)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, old...)
+		} else if verbose {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Backup history not read: %v\n", err)
+		}
+	}
+
+	collector := usage.NewCollector()
+	for _, s := range sources {
+		if err := readUsage(collector, s); err != nil {
+			return fmt.Errorf("read %s: %w", s.Path, err)
+		}
+	}
+
+	var records []usage.Record
+	for _, r := range collector.Records {
+		if filter.Project != "" && !strings.Contains(r.Project, filter.Project) {
+			continue
+		}
+		if (!filter.Since.IsZero() || !filter.Until.IsZero()) && !filter.InRange(r.Time) {
+			continue
+		}
+		records = append(records, r)
+	}
+	rows, total, err := usage.Summarize(records, by, prices)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		return writeJSON(out, usageReport{By: by, Rows: rows, Total: total})
+	case "csv":
+		return writeUsageCSV(out, by, rows)
+	}
+
+	if len(rows) == 0 {
+		fmt.Fprintln(out, "No usage recorded.")
+		return nil
+	}
+	fmt.Fprintf(out, "%8s  %12s  %12s  %12s  %14s  %10s  %s\n", "MESSAGES", "INPUT", "OUTPUT", "CACHE WRITE", "CACHE READ", "COST", strings.ToUpper(by))
+	for _, r := range append(rows, total) {
+		fmt.Fprintf(out, "%8d  %12d  %12d  %12d  %14d  %10s  %s\n",
+			r.Messages, r.Input, r.Output, r.CacheWrite, r.CacheRead, formatCost(r), r.Key)
+	}
+	if total.Unpriced > 0 {
+		fmt.Fprintf(out, "\n* %d messages of models without a price are not included in the cost; add them to usage.prices.\n", total.Unpriced)
+	}
+	fmt.Fprintf(out, "\nRead %d transcripts from the source and %d from the backup history.\n", live, len(sources)-live)
+	return nil
+}
+
+// readUsage adds the usage of one transcript.
+func readUsage(c *usage.Collector, s search.Source) error {
+	r, err := s.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return c.Read(s.Path, r)
+}
+
+// formatCost prints an estimated cost, marked if some messages are unpriced.
+func formatCost(r usage.Row) string {
+	cost := fmt.Sprintf("$%.2f", r.Cost)
+	if r.Unpriced > 0 {
+		cost += "*"
+	}
+	return cost
+}
+
+func writeUsageCSV(out io.Writer, by string, rows []usage.Row) error {
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{by, "messages", "input_tokens", "output_tokens", "cache_write_tokens", "cache_read_tokens", "cost_usd", "unpriced_messages"})
+	for _, r := range rows {
+		_ = w.Write([]string{
+			r.Key,
+			strconv.Itoa(r.Messages),
+			strconv.FormatInt(r.Input, 10),
+			strconv.FormatInt(r.Output, 10),
+			strconv.FormatInt(r.CacheWrite, 10),
+			strconv.FormatInt(r.CacheRead, 10),
+			strconv.FormatFloat(r.Cost, 'f', 4, 64),
+			strconv.Itoa(r.Unpriced),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
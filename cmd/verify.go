@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/verify"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the backup is complete and readable",
+	Long: `Compare source_dir, the additional sources and the project-local files
+with the backup working tree and git HEAD by content hash, run git fsck,
+check LFS objects and validate every *.jsonl file. Sources whose root does
+not exist on this machine are not checked.
+Exits with an error if any check fails.`,
+	RunE: runVerify,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().Bool("restore-drill", false, "also restore the backup into a temp dir and compare")
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	verbose := viper.GetBool("verbose")
+	out := cmd.OutOrStdout()
+
+	sourceDir, err := paths.ExpandHome(viper.GetString("source_dir"))
+	if err != nil {
+		return fmt.Errorf("expand source_dir: %w", err)
+	}
+	backup, err := openBackupDir(viper.GetString("backup_dir"))
+	if err != nil {
+		return err
+	}
+	drill, _ := cmd.Flags().GetBool("restore-drill")
+
+	backupFS, backupRoot := backup.FS, backup.Root
+	useCAS, err := casMode()
+	if err != nil {
+		return err
+	}
+	if err := checkHostNamespace(useCAS); err != nil {
+		return err
+	}
+	if !useCAS {
+		if backupRoot, err = dataRoot(backup.Root); err != nil {
+			return err
+		}
+	}
+	if useCAS {
+		snap, snapFS, err := openCASSnapshot(backup, "")
+		if err != nil {
+			return err
+		}
+		if snap == nil {
+			return fmt.Errorf("verify failed: repository has no snapshots")
+		}
+		fmt.Fprintf(out, "Snapshot %s (%s)\n", snap.ShortID(), snap.Time.Local().Format("2006-01-02 15:04"))
+		backupFS, backupRoot = snapFS, "."
+	}
+
+	if err := checkSources(useCAS); err != nil {
+		return err
+	}
+	sources, err := backupSources()
+	if err != nil {
+		return err
+	}
+	opts := verify.Options{
+		SrcFS:        storage.NewOSFS(),
+		SrcDir:       sourceDir,
+		BackupFS:     backupFS,
+		BackupDir:    backupRoot,
+		Filter:       sources[0].Filter,
+		Git:          !backup.Remote && !useCAS,
+		GitDir:       backup.Root,
+		RestoreDrill: drill,
+	}
+	if !useCAS {
+		local, err := projectLocalSources(sourceDir)
+		if err != nil {
+			return err
+		}
+		for _, source := range append(sources[1:], local...) {
+			if _, err := os.Stat(source.Dir); os.IsNotExist(err) {
+				continue
+			}
+			opts.Sources = append(opts.Sources, verify.Source{
+				Dir:    source.Dir,
+				Prefix: source.Prefix,
+				Filter: source.Filter,
+			})
+		}
+	}
+	scanner, err := newSecretScanner()
+	if err != nil {
+		return err
+	}
+	if scanner != nil && scanner.Redacts() {
+		opts.Transform = scanner.Redact
+	}
+
+	report := verify.Run(context.Background(), opts)
+	printVerifyReport(out, report, verbose)
+
+	if n := report.Failed(); n > 0 {
+		return fmt.Errorf("verify failed: %d check(s) failed", n)
+	}
+	fmt.Fprintln(out, "\nBackup verified.")
+	return nil
+}
+
+// printVerifyReport prints one line per check followed by its problems.
+// Without verbose, at most maxProblems problems are listed per check.
+func printVerifyReport(out io.Writer, report *verify.Report, verbose bool) {
+	const maxProblems = 20
+	for _, c := range report.Checks {
+		line := fmt.Sprintf("%-4s  %s", c.Status, c.Name)
+		if c.Detail != "" {
+			line += " (" + c.Detail + ")"
+		}
+		fmt.Fprintln(out, line)
+
+		for i, p := range c.Problems {
+			if !verbose && i == maxProblems {
+				fmt.Fprintf(out, "      ... and %d more (use -v to list all)\n", len(c.Problems)-maxProblems)
+				break
+			}
+			fmt.Fprintf(out, "      %s\n", p)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/manifest"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+)
+
+// ManifestPath is where the manifest of hashes is stored inside an archive.
+const ManifestPath = manifest.Path
+
+// Epoch is the timestamp given to every archive entry,
+// the earliest time the zip format can represent.
+var Epoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Format is an archive container format.
+type Format string
+
+const (
+	FormatTarGz Format = "tar.gz"
+	FormatZip   Format = "zip"
+)
+
+// ParseFormat validates an archive format name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatTarGz, FormatZip:
+		return f, nil
+	case "tgz":
+		return FormatTarGz, nil
+	default:
+		return "", fmt.Errorf("unknown archive format %q (want tar.gz or zip)", s)
+	}
+}
+
+// File is a file to add to an archive.
+type File struct {
+	// RelPath is the slash-separated path inside the archive.
+	RelPath string
+	// Path is the name of the file in the source FS.
+	Path string
+	Size int64
+	Mode fs.FileMode
+}
+
+// Write writes files from fsys to w as a reproducible archive:
+// entries in the given order, timestamps set to Epoch, no owners,
+// and permissions reduced to 0644 or 0755. The manifest of hashes
+// is appended as the last entry and also returned.
+func Write(w io.Writer, format Format, fsys storage.FS, files []File) (*manifest.Manifest, error) {
+	var aw archiveWriter
+	switch format {
+	case FormatTarGz:
+		aw = newTarGzWriter(w)
+	case FormatZip:
+		aw = &zipWriter{zw: zip.NewWriter(w)}
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+
+	m := &manifest.Manifest{Version: manifest.Version, CreatedAt: Epoch}
+	for _, f := range files {
+		sum, err := addFile(aw, fsys, f)
+		if err != nil {
+			return nil, fmt.Errorf("add %s: %w", f.RelPath, err)
+		}
+		m.Files = append(m.Files, manifest.Entry{
+			Path:    f.RelPath,
+			Size:    f.Size,
+			SHA256:  sum,
+			ModTime: Epoch,
+			Mode:    manifest.FormatMode(normalizeMode(f.Mode)),
+		})
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+	dw, err := aw.create(ManifestPath, int64(len(data)), 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := aw.close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// addFile copies one file into the archive and returns its SHA-256.
+func addFile(aw archiveWriter, fsys storage.FS, f File) (string, error) {
+	r, err := fsys.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	w, err := aw.create(f.RelPath, f.Size, normalizeMode(f.Mode))
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return "", err
+	}
+	if n != f.Size {
+		return "", fmt.Errorf("size changed while archiving (%d != %d)", n, f.Size)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// normalizeMode keeps only the executable bit of the original permissions.
+func normalizeMode(mode fs.FileMode) fs.FileMode {
+	if mode&0100 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// archiveWriter abstracts over tar and zip output.
+type archiveWriter interface {
+	create(name string, size int64, mode fs.FileMode) (io.Writer, error)
+	close() error
+}
+
+type tarGzWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarGzWriter(w io.Writer) *tarGzWriter {
+	// A zero gzip header (no name, no mtime) keeps the output reproducible
+	gz := gzip.NewWriter(w)
+	return &tarGzWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (t *tarGzWriter) create(name string, size int64, mode fs.FileMode) (io.Writer, error) {
+	err := t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     int64(mode),
+		ModTime:  Epoch,
+		Format:   tar.FormatPAX,
+	})
+	return t.tw, err
+}
+
+func (t *tarGzWriter) close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) create(name string, size int64, mode fs.FileMode) (io.Writer, error) {
+	h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: Epoch}
+	h.SetMode(mode)
+	return z.zw.CreateHeader(h)
+}
+
+func (z *zipWriter) close() error {
+	return z.zw.Close()
+}
@@ -0,0 +1,199 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/takoeight0821/ccbackup/internal/manifest"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+)
+
+func writeTestFiles(t *testing.T, modTime time.Time) (storage.FS, []File) {
+	t.Helper()
+	fsys := storage.NewMemFS()
+	files := []File{
+		{RelPath: "history.jsonl", Path: "/src/history.jsonl", Size: 5, Mode: 0600},
+		{RelPath: "projects/p/session.jsonl", Path: "/src/projects/p/session.jsonl", Size: 7, Mode: 0755},
+	}
+	require.NoError(t, fsys.WriteFile(files[0].Path, strings.NewReader("hello"), 0600, modTime))
+	require.NoError(t, fsys.WriteFile(files[1].Path, strings.NewReader("session"), 0755, modTime))
+	return fsys, files
+}
+
+func TestWrite_Reproducible(t *testing.T) {
+	for _, format := range []Format{FormatTarGz, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			var first, second bytes.Buffer
+
+			fsys, files := writeTestFiles(t, time.Now())
+			_, err := Write(&first, format, fsys, files)
+			require.NoError(t, err)
+
+			fsys, files = writeTestFiles(t, time.Now().Add(-48*time.Hour))
+			_, err = Write(&second, format, fsys, files)
+			require.NoError(t, err)
+
+			assert.Equal(t, first.Bytes(), second.Bytes())
+		})
+	}
+}
+
+func TestWrite_TarGz(t *testing.T) {
+	fsys, files := writeTestFiles(t, time.Now())
+
+	var buf bytes.Buffer
+	m, err := Write(&buf, FormatTarGz, fsys, files)
+	require.NoError(t, err)
+	require.Len(t, m.Files, 2)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", m.Files[0].SHA256)
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, h.Name)
+		assert.True(t, h.ModTime.Equal(Epoch), h.Name)
+		assert.Equal(t, 0, h.Uid)
+		assert.Equal(t, "", h.Uname)
+
+		switch h.Name {
+		case "history.jsonl":
+			assert.Equal(t, int64(0644), h.Mode)
+		case "projects/p/session.jsonl":
+			assert.Equal(t, int64(0755), h.Mode)
+		case ManifestPath:
+			var embedded manifest.Manifest
+			require.NoError(t, json.NewDecoder(tr).Decode(&embedded))
+			assert.Equal(t, m.Files, embedded.Files)
+		}
+	}
+	assert.Equal(t, []string{"history.jsonl", "projects/p/session.jsonl", ManifestPath}, names)
+}
+
+func TestWrite_Zip(t *testing.T) {
+	fsys, files := writeTestFiles(t, time.Now())
+
+	var buf bytes.Buffer
+	_, err := Write(&buf, FormatZip, fsys, files)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 3)
+	assert.Equal(t, "history.jsonl", zr.File[0].Name)
+	assert.True(t, zr.File[0].Modified.Equal(Epoch))
+
+	rc, err := zr.File[1].Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "session", string(data))
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("tgz")
+	require.NoError(t, err)
+	assert.Equal(t, FormatTarGz, f)
+
+	_, err = ParseFormat("rar")
+	assert.Error(t, err)
+}
+
+func TestExtract_RoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatTarGz, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			fsys, files := writeTestFiles(t, time.Now())
+			name := filepath.Join(t.TempDir(), "out."+string(format))
+			f, err := os.Create(name)
+			require.NoError(t, err)
+			_, err = Write(f, format, fsys, files)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			dst := storage.NewMemFS()
+			require.NoError(t, Extract(name, format, dst, "/dst"))
+
+			data, err := storage.ReadFile(dst, "/dst/projects/p/session.jsonl")
+			require.NoError(t, err)
+			assert.Equal(t, "session", string(data))
+
+			info, err := dst.Stat("/dst/projects/p/session.jsonl")
+			require.NoError(t, err)
+			assert.Equal(t, fs.FileMode(0755), info.Mode().Perm())
+			assert.True(t, info.ModTime().Equal(Epoch))
+
+			_, err = dst.Stat("/dst/" + ManifestPath)
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+		})
+	}
+}
+
+func writeTarGz(t *testing.T, entries map[string]string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "test.tar.gz")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for path, body := range entries {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: path, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+	return name
+}
+
+func TestExtract_UnsafePath(t *testing.T) {
+	name := writeTarGz(t, map[string]string{"../escape.txt": "x"})
+	err := Extract(name, FormatTarGz, storage.NewMemFS(), "/dst")
+	assert.ErrorContains(t, err, "unsafe path")
+}
+
+func TestExtract_ManifestMismatch(t *testing.T) {
+	name := writeTarGz(t, map[string]string{
+		"a.txt":      "tampered",
+		ManifestPath: `{"version":1,"files":[{"path":"a.txt","size":8,"sha256":"00"}]}`,
+	})
+	err := Extract(name, FormatTarGz, storage.NewMemFS(), "/dst")
+	assert.ErrorContains(t, err, "hash mismatch")
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		want Format
+	}{
+		{"a.tar.gz", FormatTarGz},
+		{"a.TGZ", FormatTarGz},
+		{"a.zip", FormatZip},
+	}
+	for _, tt := range tests {
+		got, err := DetectFormat(tt.name)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+	_, err := DetectFormat("a.rar")
+	assert.Error(t, err)
+}
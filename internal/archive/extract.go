@@ -0,0 +1,171 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/manifest"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+)
+
+// DetectFormat infers the archive format from a file name.
+func DetectFormat(name string) (Format, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	default:
+		return "", fmt.Errorf("cannot detect archive format of %s (want .tar.gz, .tgz or .zip)", name)
+	}
+}
+
+// Extract unpacks the regular files of the archive at name into root on fsys,
+// keeping their modification times. Links and other special entries are skipped.
+// If the archive embeds a manifest, every listed file must match its hash.
+func Extract(name string, format Format, fsys storage.FS, root string) error {
+	x := &extractor{fsys: fsys, root: root, sums: map[string]string{}}
+
+	var err error
+	switch format {
+	case FormatTarGz:
+		err = x.tarGz(name)
+	case FormatZip:
+		err = x.zip(name)
+	default:
+		err = fmt.Errorf("unknown archive format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	return x.verify()
+}
+
+// extractor writes archive entries and records their hashes.
+type extractor struct {
+	fsys     storage.FS
+	root     string
+	sums     map[string]string
+	manifest *manifest.Manifest
+}
+
+func (x *extractor) tarGz(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := x.add(h.Name, tr, h.FileInfo().Mode(), h.ModTime); err != nil {
+			return err
+		}
+	}
+}
+
+func (x *extractor) zip(name string) error {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		err = x.add(f.Name, rc, f.Mode(), f.Modified)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add writes one entry, or decodes it if it is the embedded manifest.
+func (x *extractor) add(name string, r io.Reader, mode fs.FileMode, modTime time.Time) error {
+	rel, err := safeName(name)
+	if err != nil {
+		return err
+	}
+
+	if rel == ManifestPath {
+		var m manifest.Manifest
+		if err := json.NewDecoder(r).Decode(&m); err != nil {
+			return fmt.Errorf("read %s: %w", ManifestPath, err)
+		}
+		x.manifest = &m
+		return nil
+	}
+
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	h := sha256.New()
+	dst := filepath.Join(x.root, filepath.FromSlash(rel))
+	if err := x.fsys.WriteFile(dst, io.TeeReader(r, h), perm, modTime); err != nil {
+		return fmt.Errorf("extract %s: %w", rel, err)
+	}
+	x.sums[rel] = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// verify checks extracted files against the embedded manifest, if any.
+func (x *extractor) verify() error {
+	if x.manifest == nil {
+		return nil
+	}
+	for _, e := range x.manifest.Files {
+		sum, ok := x.sums[e.Path]
+		if !ok {
+			return fmt.Errorf("%s: listed in manifest but missing from archive", e.Path)
+		}
+		if sum != e.SHA256 {
+			return fmt.Errorf("%s: hash mismatch (manifest %s, archive %s)", e.Path, e.SHA256, sum)
+		}
+	}
+	return nil
+}
+
+// safeName rejects entry names that would escape the extraction root.
+func safeName(name string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "./"))
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("unsafe path in archive: %q", name)
+	}
+	return clean, nil
+}
@@ -0,0 +1,244 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/storage/s3"
+	"github.com/takoeight0821/ccbackup/internal/storage/s3/s3test"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+func randomData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func chunkAll(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	c := NewChunker(bytes.NewReader(data), 1<<10, 12, 16<<10)
+	var chunks [][]byte
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := randomData(1, 1<<20)
+	chunks := chunkAll(t, data)
+
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+	for i, c := range chunks {
+		assert.LessOrEqual(t, len(c), 16<<10)
+		if i < len(chunks)-1 {
+			assert.GreaterOrEqual(t, len(c), 1<<10)
+		}
+	}
+	assert.Greater(t, len(chunks), 64, "average chunk size is 4KiB")
+}
+
+func TestChunker_ContentDefined(t *testing.T) {
+	data := randomData(2, 256<<10)
+	shifted := append(randomData(3, 100), data...)
+
+	seen := map[string]bool{}
+	for _, c := range chunkAll(t, data) {
+		seen[string(c)] = true
+	}
+	chunks := chunkAll(t, shifted)
+	shared := 0
+	for _, c := range chunks {
+		if seen[string(c)] {
+			shared++
+		}
+	}
+	// Only the chunks around the insertion change
+	assert.GreaterOrEqual(t, shared, len(chunks)-2)
+}
+
+func TestChunker_Empty(t *testing.T) {
+	assert.Empty(t, chunkAll(t, nil))
+}
+
+func TestRepository_Chunks(t *testing.T) {
+	fsys := storage.NewMemFS()
+	_, err := Open(fsys, "/repo")
+	assert.ErrorIs(t, err, ErrNotRepository)
+
+	repo, err := Init(fsys, "/repo")
+	require.NoError(t, err)
+	repo.Compress = true
+
+	data := []byte(strings.Repeat(`{"type":"user","message":"hello"}`+"\n", 100))
+	id, added, err := repo.SaveChunk(data)
+	require.NoError(t, err)
+	assert.Greater(t, added, int64(0))
+	assert.Less(t, added, int64(len(data)), "compressed")
+
+	reopened, err := Open(fsys, "/repo")
+	require.NoError(t, err)
+	_, added, err = reopened.SaveChunk(data)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), added, "deduplicated")
+
+	loaded, err := reopened.LoadChunk(id)
+	require.NoError(t, err)
+	assert.Equal(t, data, loaded)
+
+	require.NoError(t, fsys.WriteFile(repo.chunkPath(id), bytes.NewReader([]byte{encodingRaw, 'x'}), 0644, time.Now()))
+	_, err = reopened.LoadChunk(id)
+	assert.ErrorContains(t, err, "hash mismatch")
+}
+
+func writeSource(t *testing.T, fsys storage.FS, name, content string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, fsys.WriteFile("/src/"+name, strings.NewReader(content), 0600, modTime))
+}
+
+func backup(t *testing.T, repo *Repository, src storage.FS, parent *Snapshot) (*Snapshot, *Stats) {
+	t.Helper()
+	listed, err := sync.List(src, "/src", sync.NewFilter([]string{"projects", "history.jsonl"}))
+	require.NoError(t, err)
+	snap, stats, err := repo.Backup(context.Background(), src, listed, parent, nil)
+	require.NoError(t, err)
+	return snap, stats
+}
+
+func TestRepository_Backup(t *testing.T) {
+	fsys := storage.NewMemFS()
+	repo, err := Init(fsys, "/repo")
+	require.NoError(t, err)
+
+	t1 := time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
+	writeSource(t, fsys, "history.jsonl", "{}\n", t1)
+	writeSource(t, fsys, "projects/p/s.jsonl", "{\"a\":1}\n", t1)
+
+	first, stats := backup(t, repo, fsys, nil)
+	assert.Equal(t, 2, stats.ChangedFiles)
+	assert.Equal(t, 2, stats.NewChunks)
+	require.Len(t, first.Files, 2)
+	assert.Equal(t, "0600", first.Files[0].Mode)
+
+	// Unchanged files are not re-read
+	second, stats := backup(t, repo, fsys, first)
+	assert.Equal(t, 0, stats.ChangedFiles)
+	assert.Equal(t, first.Files, second.Files)
+
+	// Changed and deleted files
+	t2 := t1.Add(time.Hour)
+	writeSource(t, fsys, "history.jsonl", "{}\n{}\n", t2)
+	require.NoError(t, fsys.Remove("/src/projects/p/s.jsonl"))
+	third, stats := backup(t, repo, fsys, second)
+	assert.Equal(t, 1, stats.ChangedFiles)
+	require.Len(t, third.Files, 2, "deleted files stay in the snapshot")
+
+	snapshots, err := repo.Snapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 3)
+
+	latest, err := repo.FindSnapshot("latest")
+	require.NoError(t, err)
+	assert.Equal(t, third.ID, latest.ID)
+	found, err := repo.FindSnapshot(first.ShortID())
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, found.ID)
+	_, err = repo.FindSnapshot("zzzz")
+	assert.Error(t, err)
+	_, err = repo.FindSnapshot("")
+	assert.ErrorContains(t, err, "ambiguous")
+
+	// Read an old version back through SnapshotFS
+	sfs := NewSnapshotFS(repo, found)
+	data, err := storage.ReadFile(sfs, "history.jsonl")
+	require.NoError(t, err)
+	assert.Equal(t, "{}\n", string(data))
+	info, err := sfs.Stat("history.jsonl")
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(t1))
+	assert.Equal(t, 0600, int(info.Mode().Perm()))
+}
+
+func TestRepository_BackupRedacted(t *testing.T) {
+	fsys := storage.NewMemFS()
+	repo, err := Init(fsys, "/repo")
+	require.NoError(t, err)
+	writeSource(t, fsys, "history.jsonl", "{\"key\":\"sk-secret\"}\n", time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC))
+	redact := func(relPath string, data []byte) ([]byte, error) {
+		return bytes.ReplaceAll(data, []byte("sk-secret"), []byte("***")), nil
+	}
+	listed, err := sync.List(fsys, "/src", sync.NewFilter([]string{"history.jsonl"}))
+	require.NoError(t, err)
+
+	first, stats, err := repo.Backup(context.Background(), fsys, listed, nil, redact)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.ChangedFiles)
+	require.Len(t, first.Files, 1)
+	assert.Equal(t, int64(len("{\"key\":\"***\"}\n")), first.Files[0].Size)
+
+	// The redacted copy is smaller, but the source has not changed
+	assert.Empty(t, Changed(listed.Items, first))
+	second, stats, err := repo.Backup(context.Background(), fsys, listed, first, redact)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.ChangedFiles)
+	assert.Equal(t, first.Files, second.Files)
+}
+
+func TestRepository_BackupLargeFileDedup(t *testing.T) {
+	fsys := storage.NewMemFS()
+	repo, err := Init(fsys, "/repo")
+	require.NoError(t, err)
+
+	t1 := time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
+	big := randomData(4, 4*DefaultMaxSize)
+	writeSource(t, fsys, "history.jsonl", string(big), t1)
+	first, stats := backup(t, repo, fsys, nil)
+	firstChunks := stats.NewChunks
+
+	// Appending only stores the tail
+	writeSource(t, fsys, "history.jsonl", string(big)+"{\"appended\":true}\n", t1.Add(time.Hour))
+	_, stats = backup(t, repo, fsys, first)
+	assert.Equal(t, 1, stats.ChangedFiles)
+	assert.LessOrEqual(t, stats.NewChunks, 2)
+	assert.Greater(t, firstChunks, 4)
+}
+
+func TestRepository_S3(t *testing.T) {
+	server := s3test.NewServer("bucket")
+	defer server.Close()
+	fsys := s3.New("bucket", s3.Config{
+		Endpoint:    server.URL,
+		PathStyle:   true,
+		Credentials: s3.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+	})
+
+	repo, err := Init(fsys, "claude")
+	require.NoError(t, err)
+	snapshots, err := repo.Snapshots()
+	require.NoError(t, err)
+	assert.Empty(t, snapshots)
+
+	src := storage.NewMemFS()
+	writeSource(t, src, "history.jsonl", "{}\n", time.Now())
+	snap, _ := backup(t, repo, src, nil)
+
+	latest, err := repo.FindSnapshot("latest")
+	require.NoError(t, err)
+	assert.Equal(t, snap.ID, latest.ID)
+	data, err := storage.ReadFile(NewSnapshotFS(repo, latest), "history.jsonl")
+	require.NoError(t, err)
+	assert.Equal(t, "{}\n", string(data))
+}
@@ -0,0 +1,102 @@
+package cas
+
+import (
+	"errors"
+	"io"
+)
+
+// Default chunk size limits. Boundaries fall on average every 1 MiB,
+// so appending to a large JSONL transcript only adds a chunk or two.
+const (
+	DefaultMinSize = 256 << 10
+	DefaultAvgBits = 20
+	DefaultMaxSize = 8 << 20
+)
+
+// gear maps each byte to a pseudo-random value for the rolling hash.
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	// splitmix64 with a fixed seed, so chunk boundaries are stable
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range table {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunker splits a stream into content-defined chunks using a gear
+// rolling hash, so an insertion only changes the chunks around it.
+type Chunker struct {
+	r    io.Reader
+	buf  []byte
+	n    int
+	eof  bool
+	min  int
+	max  int
+	mask uint64
+}
+
+// NewChunker creates a chunker with the given size limits.
+func NewChunker(r io.Reader, minSize, avgBits, maxSize int) *Chunker {
+	return &Chunker{
+		r:    r,
+		buf:  make([]byte, maxSize),
+		min:  minSize,
+		max:  maxSize,
+		mask: (uint64(1) << avgBits) - 1,
+	}
+}
+
+// Next returns the next chunk, or io.EOF after the last one.
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.n == 0 {
+		return nil, io.EOF
+	}
+
+	cut := c.boundary()
+	chunk := make([]byte, cut)
+	copy(chunk, c.buf[:cut])
+	c.n = copy(c.buf, c.buf[cut:c.n])
+	return chunk, nil
+}
+
+// fill reads until the buffer is full or the input is exhausted.
+func (c *Chunker) fill() error {
+	for !c.eof && c.n < len(c.buf) {
+		m, err := c.r.Read(c.buf[c.n:])
+		c.n += m
+		if errors.Is(err, io.EOF) {
+			c.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boundary returns the length of the next chunk in the buffer.
+func (c *Chunker) boundary() int {
+	if c.n <= c.min {
+		return c.n
+	}
+	var h uint64
+	// The hash only depends on the last 64 bytes, so start just before min
+	start := c.min - 64
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < c.n; i++ {
+		h = (h << 1) + gear[c.buf[i]]
+		if i+1 >= c.min && h&c.mask == 0 {
+			return i + 1
+		}
+	}
+	return c.n
+}
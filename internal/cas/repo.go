@@ -0,0 +1,441 @@
+package cas
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/manifest"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+// Repository layout, relative to the repository root.
+const (
+	configName   = "cas.json"
+	chunksDir    = "chunks"
+	snapshotsDir = "snapshots"
+)
+
+// Chunk encodings, stored as the first byte of every chunk object.
+const (
+	encodingRaw   byte = 0
+	encodingFlate byte = 1
+)
+
+// ErrNotRepository is returned by Open when root holds no CAS repository.
+var ErrNotRepository = errors.New("not a CAS repository")
+
+// Config is stored in the repository and fixes its chunking parameters,
+// which must stay the same for chunks to deduplicate across runs.
+type Config struct {
+	Version int `json:"version"`
+	MinSize int `json:"chunk_min_size"`
+	AvgBits int `json:"chunk_avg_bits"`
+	MaxSize int `json:"chunk_max_size"`
+}
+
+// Repository is a content-addressed store of deduplicated chunks and
+// snapshots on any storage.FS.
+type Repository struct {
+	FS   storage.FS
+	Root string
+	// Compress stores new chunks deflate-compressed when that makes them smaller.
+	Compress bool
+
+	cfg   Config
+	known map[string]bool
+}
+
+// Init creates a repository at root, or opens it if one already exists.
+func Init(fsys storage.FS, root string) (*Repository, error) {
+	r, err := Open(fsys, root)
+	if !errors.Is(err, ErrNotRepository) {
+		return r, err
+	}
+
+	cfg := Config{Version: 1, MinSize: DefaultMinSize, AvgBits: DefaultAvgBits, MaxSize: DefaultMaxSize}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := fsys.WriteFile(filepath.Join(root, configName), bytes.NewReader(data), 0644, time.Now()); err != nil {
+		return nil, fmt.Errorf("write %s: %w", configName, err)
+	}
+	return &Repository{FS: fsys, Root: root, cfg: cfg, known: map[string]bool{}}, nil
+}
+
+// Open opens an existing repository.
+func Open(fsys storage.FS, root string) (*Repository, error) {
+	data, err := storage.ReadFile(fsys, filepath.Join(root, configName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", root, ErrNotRepository)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", configName, err)
+	}
+	if cfg.Version != 1 {
+		return nil, fmt.Errorf("unsupported CAS repository version %d", cfg.Version)
+	}
+	return &Repository{FS: fsys, Root: root, cfg: cfg, known: map[string]bool{}}, nil
+}
+
+// chunkPath returns the name of a chunk object, fanned out by hash prefix.
+func (r *Repository) chunkPath(id string) string {
+	return filepath.Join(r.Root, chunksDir, id[:2], id)
+}
+
+// SaveChunk stores data under its SHA-256 unless it is already present,
+// and returns the ID and the number of bytes written.
+func (r *Repository) SaveChunk(data []byte) (string, int64, error) {
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+	if r.known[id] {
+		return id, 0, nil
+	}
+	if _, err := r.FS.Stat(r.chunkPath(id)); err == nil {
+		r.known[id] = true
+		return id, 0, nil
+	}
+
+	obj := append([]byte{encodingRaw}, data...)
+	if r.Compress {
+		var buf bytes.Buffer
+		buf.WriteByte(encodingFlate)
+		zw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			return "", 0, err
+		}
+		if buf.Len() < len(obj) {
+			obj = buf.Bytes()
+		}
+	}
+
+	if err := r.FS.WriteFile(r.chunkPath(id), bytes.NewReader(obj), 0644, time.Now()); err != nil {
+		return "", 0, fmt.Errorf("write chunk %s: %w", id, err)
+	}
+	r.known[id] = true
+	return id, int64(len(obj)), nil
+}
+
+// LoadChunk reads a chunk and checks it against its ID.
+func (r *Repository) LoadChunk(id string) ([]byte, error) {
+	if len(id) != sha256.Size*2 {
+		return nil, fmt.Errorf("invalid chunk id %q", id)
+	}
+	obj, err := storage.ReadFile(r.FS, r.chunkPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("read chunk %s: %w", id, err)
+	}
+	if len(obj) == 0 {
+		return nil, fmt.Errorf("chunk %s: empty object", id)
+	}
+
+	var data []byte
+	switch obj[0] {
+	case encodingRaw:
+		data = obj[1:]
+	case encodingFlate:
+		data, err = io.ReadAll(flate.NewReader(bytes.NewReader(obj[1:])))
+		if err != nil {
+			return nil, fmt.Errorf("chunk %s: %w", id, err)
+		}
+	default:
+		return nil, fmt.Errorf("chunk %s: unknown encoding %d", id, obj[0])
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != id {
+		return nil, fmt.Errorf("chunk %s: hash mismatch", id)
+	}
+	return data, nil
+}
+
+// File is a file in a snapshot: its manifest entry and the chunks
+// that make up its contents, in order.
+type File struct {
+	manifest.Entry
+	Chunks []string `json:"chunks"`
+}
+
+// Snapshot records the files of one backup run.
+type Snapshot struct {
+	// ID is the SHA-256 of the stored snapshot; it is not part of the JSON.
+	ID       string             `json:"-"`
+	Time     time.Time          `json:"time"`
+	Files    []File             `json:"files"`
+	Warnings []manifest.Warning `json:"warnings,omitempty"`
+}
+
+// ShortID returns the first 8 characters of the ID, as shown to users.
+func (s *Snapshot) ShortID() string {
+	if len(s.ID) < 8 {
+		return s.ID
+	}
+	return s.ID[:8]
+}
+
+// Size returns the total size of the snapshot's files.
+func (s *Snapshot) Size() int64 {
+	var total int64
+	for _, f := range s.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// SaveSnapshot stores a snapshot and sets its ID.
+func (r *Repository) SaveSnapshot(s *Snapshot) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	sum := sha256.Sum256(data)
+	s.ID = hex.EncodeToString(sum[:])
+
+	name := filepath.Join(r.Root, snapshotsDir, s.ID+".json")
+	if err := r.FS.WriteFile(name, bytes.NewReader(data), 0644, s.Time); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
+
+// Snapshots returns all snapshots, oldest first.
+func (r *Repository) Snapshots() ([]*Snapshot, error) {
+	dir := filepath.Join(r.Root, snapshotsDir)
+	var ids []string
+	err := r.FS.Walk(dir, func(p string, info fs.FileInfo, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			// No snapshots yet; object stores have no directories to find
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(p, ".json") {
+			ids = append(ids, strings.TrimSuffix(path.Base(filepath.ToSlash(p)), ".json"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+
+	snapshots := make([]*Snapshot, 0, len(ids))
+	for _, id := range ids {
+		s, err := r.loadSnapshot(id)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+func (r *Repository) loadSnapshot(id string) (*Snapshot, error) {
+	data, err := storage.ReadFile(r.FS, filepath.Join(r.Root, snapshotsDir, id+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot %s: %w", id, err)
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse snapshot %s: %w", id, err)
+	}
+	s.ID = id
+	return &s, nil
+}
+
+// FindSnapshot returns the snapshot whose ID starts with prefix,
+// or the newest snapshot for "latest". It returns nil, nil for
+// "latest" in an empty repository.
+func (r *Repository) FindSnapshot(prefix string) (*Snapshot, error) {
+	snapshots, err := r.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "latest" {
+		if len(snapshots) == 0 {
+			return nil, nil
+		}
+		return snapshots[len(snapshots)-1], nil
+	}
+
+	var found *Snapshot
+	for _, s := range snapshots {
+		if strings.HasPrefix(s.ID, prefix) {
+			if found != nil {
+				return nil, fmt.Errorf("snapshot ID %q is ambiguous", prefix)
+			}
+			found = s
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("snapshot %q not found", prefix)
+	}
+	return found, nil
+}
+
+// Stats summarizes a backup run.
+type Stats struct {
+	ChangedFiles int
+	NewChunks    int
+	// AddedBytes is the stored size of new chunks, after compression.
+	AddedBytes int64
+}
+
+// Changed returns the items whose size or modification time differ from parent.
+func Changed(items []sync.SyncItem, parent *Snapshot) []sync.SyncItem {
+	prev := parent.index()
+	var changed []sync.SyncItem
+	for _, item := range items {
+		old, ok := prev[filepath.ToSlash(item.RelPath)]
+		if !ok || !unchanged(old, item) {
+			changed = append(changed, item)
+		}
+	}
+	return changed
+}
+
+// index maps paths to files. It is safe to call on a nil snapshot.
+func (s *Snapshot) index() map[string]File {
+	files := map[string]File{}
+	if s != nil {
+		for _, f := range s.Files {
+			files[f.Path] = f
+		}
+	}
+	return files
+}
+
+// unchanged reports whether a source file still matches its snapshot entry.
+func unchanged(f File, item sync.SyncItem) bool {
+	size := f.Size
+	if f.SourceSize != nil {
+		size = *f.SourceSize
+	}
+	return size == item.Size && f.ModTime.Equal(item.ModTime)
+}
+
+// Backup stores the listed files, read from src, as a new snapshot.
+// Files whose size and modification time match parent reuse its chunks
+// without being read. Like a git backup, files that are gone from the
+// source stay in the snapshot. Walk warnings and per-file failures are
+// recorded as snapshot warnings; a failed file keeps its parent version.
+func (r *Repository) Backup(ctx context.Context, src storage.FS, listed *sync.PlanResult, parent *Snapshot,
+	transform func(relPath string, data []byte) ([]byte, error)) (*Snapshot, *Stats, error) {
+	prev := parent.index()
+	snap := &Snapshot{Time: time.Now().UTC()}
+	stats := &Stats{}
+	for _, w := range listed.Warnings {
+		snap.Warnings = append(snap.Warnings, manifest.Warning{Path: filepath.ToSlash(w.RelPath), Message: w.Err.Error()})
+	}
+
+	for _, item := range listed.Items {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		rel := filepath.ToSlash(item.RelPath)
+		old, hasOld := prev[rel]
+		delete(prev, rel)
+		if hasOld && unchanged(old, item) {
+			snap.Files = append(snap.Files, old)
+			continue
+		}
+
+		f, err := r.storeFile(src, item, transform, stats)
+		if err != nil {
+			snap.Warnings = append(snap.Warnings, manifest.Warning{Path: rel, Message: err.Error()})
+			if hasOld {
+				snap.Files = append(snap.Files, old)
+			}
+			continue
+		}
+		snap.Files = append(snap.Files, *f)
+		stats.ChangedFiles++
+	}
+	for _, old := range prev {
+		snap.Files = append(snap.Files, old)
+	}
+
+	sort.Slice(snap.Files, func(i, j int) bool { return snap.Files[i].Path < snap.Files[j].Path })
+	if err := r.SaveSnapshot(snap); err != nil {
+		return nil, nil, err
+	}
+	return snap, stats, nil
+}
+
+// storeFile chunks one file into the repository.
+func (r *Repository) storeFile(src storage.FS, item sync.SyncItem,
+	transform func(relPath string, data []byte) ([]byte, error), stats *Stats) (*File, error) {
+	rc, err := src.Open(item.SrcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var in io.Reader = rc
+	if transform != nil {
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = transform(item.RelPath, data); err != nil {
+			return nil, err
+		}
+		in = bytes.NewReader(data)
+	}
+
+	f := &File{Entry: manifest.Entry{
+		Path:    filepath.ToSlash(item.RelPath),
+		ModTime: item.ModTime.UTC(),
+		Mode:    manifest.FormatMode(item.Mode),
+	}}
+	h := sha256.New()
+	chunker := NewChunker(in, r.cfg.MinSize, r.cfg.AvgBits, r.cfg.MaxSize)
+	for {
+		chunk, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		h.Write(chunk)
+		f.Size += int64(len(chunk))
+
+		id, added, err := r.SaveChunk(chunk)
+		if err != nil {
+			return nil, err
+		}
+		if added > 0 {
+			stats.NewChunks++
+			stats.AddedBytes += added
+		}
+		f.Chunks = append(f.Chunks, id)
+	}
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+	if f.Size != item.Size {
+		size := item.Size
+		f.SourceSize = &size
+	}
+	return f, nil
+}
@@ -0,0 +1,99 @@
+package cas
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/storage"
+)
+
+// errReadOnly is returned by SnapshotFS write operations.
+var errReadOnly = errors.New("snapshot is read-only")
+
+// SnapshotFS is a read-only file system over the files of one snapshot.
+// Names are slash-separated paths relative to the snapshot root, and
+// files report the modification time and mode recorded at backup time.
+type SnapshotFS struct {
+	repo  *Repository
+	files map[string]File
+	tree  *storage.Tree
+}
+
+// NewSnapshotFS returns a file system view of snapshot s in repo.
+func NewSnapshotFS(repo *Repository, s *Snapshot) *SnapshotFS {
+	sfs := &SnapshotFS{repo: repo, files: map[string]File{}, tree: storage.NewTree()}
+	sfs.tree.DirModTime = s.Time
+	for _, f := range s.Files {
+		sfs.files[f.Path] = f
+		sfs.tree.Add(f.Path, storage.TreeFile{Size: f.Size, Mode: f.FileMode(), ModTime: f.ModTime})
+	}
+	return sfs
+}
+
+// Open returns a reader that loads the file's chunks one at a time.
+func (s *SnapshotFS) Open(name string) (io.ReadCloser, error) {
+	f, ok := s.files[storage.CleanName(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &chunkReader{repo: s.repo, chunks: f.Chunks}, nil
+}
+
+// Stat returns metadata for a file or directory in the snapshot.
+func (s *SnapshotFS) Stat(name string) (fs.FileInfo, error) {
+	return s.tree.Stat(name)
+}
+
+// Walk visits the snapshot under root in lexical order.
+func (s *SnapshotFS) Walk(root string, fn filepath.WalkFunc) error {
+	return s.tree.Walk(root, fn)
+}
+
+// ContentHash returns the SHA-256 recorded in the snapshot.
+func (s *SnapshotFS) ContentHash(name string) (algo, sum string, err error) {
+	f, ok := s.files[storage.CleanName(name)]
+	if !ok {
+		return "", "", &fs.PathError{Op: "hash", Path: name, Err: fs.ErrNotExist}
+	}
+	return "sha256", f.SHA256, nil
+}
+
+// WriteFile always fails; a snapshot cannot be modified.
+func (s *SnapshotFS) WriteFile(name string, r io.Reader, perm fs.FileMode, modTime time.Time) error {
+	return &fs.PathError{Op: "write", Path: name, Err: errReadOnly}
+}
+
+// Remove always fails; a snapshot cannot be modified.
+func (s *SnapshotFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: errReadOnly}
+}
+
+// chunkReader concatenates chunks, loading each when it is reached.
+type chunkReader struct {
+	repo   *Repository
+	chunks []string
+	cur    *bytes.Reader
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for c.cur == nil || c.cur.Len() == 0 {
+		if len(c.chunks) == 0 {
+			return 0, io.EOF
+		}
+		data, err := c.repo.LoadChunk(c.chunks[0])
+		if err != nil {
+			return 0, err
+		}
+		c.chunks = c.chunks[1:]
+		c.cur = bytes.NewReader(data)
+	}
+	return c.cur.Read(p)
+}
+
+func (c *chunkReader) Close() error {
+	return nil
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/takoeight0821/ccbackup/internal/paths"
+	"github.com/takoeight0821/ccbackup/internal/scan"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/storage/s3"
+	"github.com/takoeight0821/ccbackup/internal/storage/webdav"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+	"github.com/takoeight0821/ccbackup/internal/usage"
+)
+
+// CheckOptions selects the slower checks of Check.
+type CheckOptions struct {
+	// Matches walks the source directories for include patterns that match nothing.
+	Matches bool
+	// Explicit reports whether the config file or the environment sets a
+	// key, rather than its default. Without it, no key is.
+	Explicit func(key string) bool
+}
+
+// Check validates the effective settings: the values CheckKeys cannot
+// judge by type, the paths and, optionally, the include patterns.
+func Check(c *Config, opts CheckOptions) []Issue {
+	var issues []Issue
+	add := func(severity Severity, key, format string, args ...interface{}) {
+		issues = append(issues, Issue{Severity: severity, Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Repository != RepositoryGit && c.Repository != RepositoryCAS {
+		add(Error, "repository", "unknown repository %q, want %s or %s", c.Repository, RepositoryGit, RepositoryCAS)
+	}
+	if c.Secrets.BuiltinAction != "" {
+		if _, err := scan.ParseAction(c.Secrets.BuiltinAction); err != nil {
+			add(Error, "secrets.builtin_action", "%v", err)
+		}
+	}
+	if _, err := scan.CompileRules(scan.BuiltinRules(scan.ActionWarn), c.Secrets.Rules); err != nil {
+		add(Error, "secrets.rules", "%v", err)
+	}
+	if _, err := usage.NewPriceTable(c.Usage.Prices); err != nil {
+		add(Error, "usage.prices", "%v", err)
+	}
+
+	sourceDir, sourceOK := checkDir(c.SourceDir, "source_dir", "", add)
+	if sourceOK && opts.Matches {
+		for _, p := range unmatched(sourceDir, c.Include) {
+			add(Warning, "include", "%q matches nothing in %s", p, c.SourceDir)
+		}
+	}
+
+	if !s3.IsURL(c.BackupDir) && !webdav.IsURL(c.BackupDir) {
+		backupDir, _ := checkDir(c.BackupDir, "backup_dir", ", run 'ccbackup init --exec'", add)
+		if backupDir != "" && sourceDir != "" && within(backupDir, sourceDir) {
+			add(Error, "backup_dir", "%s is inside source_dir %s", c.BackupDir, c.SourceDir)
+		}
+	}
+
+	// project_local is enabled by default, which CAS users did not ask for
+	if c.Repository == RepositoryCAS && c.ProjectLocal.Enabled && opts.Explicit != nil && opts.Explicit("project_local.enabled") {
+		add(Warning, "project_local.enabled", "is not supported with repository: %s, set it to false", RepositoryCAS)
+	}
+
+	sources, err := ResolveSources(c.Sources, c.Include)
+	if err != nil {
+		add(Error, "sources", "%v", err)
+	}
+	for _, s := range sources {
+		key := "sources." + s.Name
+		root, ok := checkDir(s.Root, key+".root", "", add)
+		if !ok || !opts.Matches {
+			continue
+		}
+		for _, p := range unmatched(root, s.Include) {
+			add(Warning, key+".include", "%q matches nothing in %s", p, s.Root)
+		}
+	}
+	return issues
+}
+
+// checkDir expands a directory setting and reports it if it is missing,
+// with hint, or not a directory. It returns the expanded path, and whether
+// it exists.
+func checkDir(dir, key, hint string, add func(Severity, string, string, ...interface{})) (string, bool) {
+	if dir == "" {
+		add(Error, key, "is not set")
+		return "", false
+	}
+	expanded, err := paths.ExpandHome(dir)
+	if err != nil {
+		add(Error, key, "%v", err)
+		return "", false
+	}
+	info, err := os.Stat(expanded)
+	switch {
+	case os.IsNotExist(err):
+		add(Warning, key, "%s does not exist%s", dir, hint)
+		return expanded, false
+	case err != nil:
+		add(Error, key, "%v", err)
+		return expanded, false
+	case !info.IsDir():
+		add(Error, key, "%s is not a directory", dir)
+		return expanded, false
+	}
+	return expanded, true
+}
+
+// within reports whether dir is parent or one of its subdirectories,
+// following symbolic links.
+func within(dir, parent string) bool {
+	resolve := func(p string) string {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if real, err := filepath.EvalSymlinks(p); err == nil {
+			p = real
+		}
+		return p
+	}
+	rel, err := filepath.Rel(resolve(parent), resolve(dir))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// unmatched returns the patterns that match no file under root.
+func unmatched(root string, patterns []string) []string {
+	listed, err := sync.List(storage.NewOSFS(), root, sync.NewFilter(patterns))
+	if err != nil {
+		return nil
+	}
+	var missing []string
+	for _, p := range patterns {
+		filter := sync.NewFilter([]string{p})
+		found := false
+		for _, item := range listed.Items {
+			if filter.ShouldInclude(item.RelPath) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,79 @@
+// Package config defines the typed ccbackup configuration and checks
+// config files and effective settings against it.
+package config
+
+import (
+	"github.com/takoeight0821/ccbackup/internal/scan"
+	"github.com/takoeight0821/ccbackup/internal/usage"
+)
+
+// Config is the schema of config.yaml. Keys are the mapstructure tags.
+type Config struct {
+	Version       int          `mapstructure:"version"`
+	SourceDir     string       `mapstructure:"source_dir"`
+	BackupDir     string       `mapstructure:"backup_dir"`
+	Include       []string     `mapstructure:"include"`
+	Exclude       []string     `mapstructure:"exclude"`
+	LFSPatterns   []string     `mapstructure:"lfs_patterns"`
+	Repository    string       `mapstructure:"repository"`
+	HostNamespace bool         `mapstructure:"host_namespace"`
+	HostID        string       `mapstructure:"host_id"`
+	Sources       []Source     `mapstructure:"sources"`
+	ProjectLocal  ProjectLocal `mapstructure:"project_local"`
+	CAS           CAS          `mapstructure:"cas"`
+	S3            S3           `mapstructure:"s3"`
+	WebDAV        WebDAV       `mapstructure:"webdav"`
+	Secrets       Secrets      `mapstructure:"secrets"`
+	Search        Search       `mapstructure:"search"`
+	Usage         Usage        `mapstructure:"usage"`
+}
+
+// ProjectLocal configures the backup of Claude files kept in the projects.
+type ProjectLocal struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Include []string `mapstructure:"include"`
+}
+
+// CAS configures repository: cas.
+type CAS struct {
+	Compression bool `mapstructure:"compression"`
+}
+
+// S3 configures s3:// backup directories.
+type S3 struct {
+	Endpoint        string `mapstructure:"endpoint"`
+	Region          string `mapstructure:"region"`
+	PathStyle       bool   `mapstructure:"path_style"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	SessionToken    string `mapstructure:"session_token"`
+}
+
+// WebDAV configures webdav:// backup directories.
+type WebDAV struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// Secrets configures the secret scan of backup.
+type Secrets struct {
+	Enabled       bool              `mapstructure:"enabled"`
+	BuiltinAction string            `mapstructure:"builtin_action"`
+	Rules         []scan.RuleConfig `mapstructure:"rules"`
+}
+
+// Search configures the search index.
+type Search struct {
+	Index string `mapstructure:"index"`
+}
+
+// Usage configures the usage report.
+type Usage struct {
+	Prices []usage.Price `mapstructure:"prices"`
+}
+
+// Repository modes.
+const (
+	RepositoryGit = "git"
+	RepositoryCAS = "cas"
+)
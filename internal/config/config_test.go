@@ -0,0 +1,398 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v3"
+)
+
+func parse(t *testing.T, doc string) map[string]interface{} {
+	t.Helper()
+	var raw map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(doc), &raw))
+	return raw
+}
+
+func TestCheckKeys(t *testing.T) {
+	raw := parse(t, `
+source_dir: ~/.claude
+Backup_Dir: ~/claude-backup
+include: [projects]
+host_namespace: true
+sources:
+  - profile: codex
+    exclude: [auth.json]
+secrets:
+  rules:
+    - name: token
+      pattern: tok_[a-z]+
+usage:
+  prices:
+    - model: claude
+      input: 3
+      output: 15.5
+`)
+	assert.Empty(t, CheckKeys(raw))
+}
+
+func TestCheckKeys_Unknown(t *testing.T) {
+	raw := parse(t, `
+incldue: [projects]
+backup-dir: /tmp/x
+sources:
+  - profile: codex
+    rot: ~/.codex
+secrets:
+  colour: red
+`)
+	issues := CheckKeys(raw)
+	require.Len(t, issues, 4)
+	assert.Equal(t, Issue{Severity: Error, Key: "backup-dir", Message: "unknown key, did you mean backup_dir?"}, issues[0])
+	assert.Equal(t, "incldue", issues[1].Key)
+	assert.Contains(t, issues[1].Message, "did you mean include?")
+	assert.Equal(t, Issue{Severity: Error, Key: "secrets.colour", Message: "unknown key"}, issues[2])
+	assert.Equal(t, "sources[0].rot", issues[3].Key)
+	assert.Contains(t, issues[3].Message, "did you mean root?")
+}
+
+func TestCheckKeys_WrongType(t *testing.T) {
+	raw := parse(t, `
+include: projects
+host_namespace: "yes"
+project_local: [CLAUDE.md]
+usage:
+  prices:
+    - model: claude
+      input: cheap
+`)
+	issues := CheckKeys(raw)
+	require.Len(t, issues, 4)
+	assert.Equal(t, "host_namespace", issues[0].Key)
+	assert.Equal(t, `want true or false, got string "yes"`, issues[0].Message)
+	assert.Equal(t, "include", issues[1].Key)
+	assert.Equal(t, `want a list, got string "projects"`, issues[1].Message)
+	assert.Equal(t, "project_local", issues[2].Key)
+	assert.Equal(t, "want a mapping, got a list", issues[2].Message)
+	assert.Equal(t, "usage.prices[0].input", issues[3].Key)
+	assert.Len(t, Errors(issues), 4)
+}
+
+func TestCheck(t *testing.T) {
+	source := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "projects"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "projects", "a.jsonl"), []byte("{}\n"), 0644))
+
+	c := &Config{
+		SourceDir:  source,
+		BackupDir:  filepath.Join(t.TempDir(), "backup"),
+		Include:    []string{"projects", "plans"},
+		Repository: RepositoryGit,
+	}
+	issues := Check(c, CheckOptions{})
+	require.Len(t, issues, 1)
+	assert.Equal(t, Warning, issues[0].Severity)
+	assert.Equal(t, "backup_dir", issues[0].Key)
+	assert.Contains(t, issues[0].Message, "run 'ccbackup init --exec'")
+
+	// Include patterns are only walked on request
+	issues = Check(c, CheckOptions{Matches: true})
+	require.Len(t, issues, 2)
+	assert.Equal(t, Issue{Severity: Warning, Key: "include", Message: `"plans" matches nothing in ` + source}, issues[0])
+
+	c.BackupDir = filepath.Join(source, "backup")
+	require.NoError(t, os.Mkdir(c.BackupDir, 0755))
+	c.Repository = "svn"
+	c.Secrets.BuiltinAction = "shred"
+	issues = Errors(Check(c, CheckOptions{}))
+	require.Len(t, issues, 3)
+	assert.Equal(t, "repository", issues[0].Key)
+	assert.Equal(t, "secrets.builtin_action", issues[1].Key)
+	assert.Equal(t, "backup_dir", issues[2].Key)
+	assert.Contains(t, issues[2].Message, "is inside source_dir")
+
+	c.Repository = RepositoryCAS
+	c.ProjectLocal.Enabled = true
+	warning := Issue{Severity: Warning, Key: "project_local.enabled",
+		Message: "is not supported with repository: cas, set it to false"}
+	assert.NotContains(t, Check(c, CheckOptions{}), warning)
+	issues = Check(c, CheckOptions{Explicit: func(key string) bool { return key == "project_local.enabled" }})
+	assert.Contains(t, issues, warning)
+}
+
+func TestCheck_Sources(t *testing.T) {
+	c := &Config{
+		SourceDir:  t.TempDir(),
+		BackupDir:  "s3://bucket/backup",
+		Repository: RepositoryGit,
+		Sources: []Source{
+			{Name: "home", Root: filepath.Join(t.TempDir(), "missing"), Include: []string{".claude.json"}, Dest: "home"},
+		},
+	}
+	issues := Check(c, CheckOptions{})
+	require.Len(t, issues, 1)
+	assert.Equal(t, Warning, issues[0].Severity)
+	assert.Equal(t, "sources.home.root", issues[0].Key)
+
+	c.Sources = append(c.Sources, Source{Name: "other", Root: "/", Include: []string{"x"}, Dest: "home/x"})
+	issues = Check(c, CheckOptions{})
+	require.Len(t, issues, 1)
+	assert.Equal(t, Error, issues[0].Severity)
+	assert.Contains(t, issues[0].Message, "source other: dest home/x overlaps source home")
+
+	c.Sources = c.Sources[:1]
+	c.Include = []string{"home"}
+	issues = Check(c, CheckOptions{})
+	require.Len(t, issues, 1)
+	assert.Equal(t, Error, issues[0].Severity)
+	assert.Contains(t, issues[0].Message, `source home: dest home overlaps "home" of source_dir's include`)
+}
+
+func TestResolveSources(t *testing.T) {
+	include := []string{"projects", "plans/", "history.jsonl", "*.md", "usage-data/daily"}
+	sources, err := ResolveSources([]Source{
+		{Profile: "codex", Exclude: []string{"auth.json"}},
+		{Name: "home", Root: "~", Include: []string{".claude.json"}, Dest: "./home/"},
+	}, include)
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	assert.Equal(t, "codex", sources[0].Name)
+	assert.Equal(t, "~/.codex", sources[0].Root)
+	assert.Equal(t, "codex", sources[0].Dest)
+	assert.Equal(t, []string{"auth.json"}, sources[0].Exclude)
+	assert.Equal(t, "home", sources[1].Dest)
+
+	for _, tt := range []struct {
+		source Source
+		err    string
+	}{
+		{Source{Root: "~", Include: []string{"a"}, Dest: "a"}, "name is required"},
+		{Source{Name: PrimarySource, Root: "~", Include: []string{"a"}, Dest: "a"}, "duplicate name"},
+		{Source{Name: "a", Include: []string{"a"}, Dest: "a"}, "root is required"},
+		{Source{Name: "a", Root: "~", Dest: "a"}, "include is required"},
+		{Source{Name: "a", Root: "~", Include: []string{"a"}, Dest: "../a"}, "must be a directory inside backup_dir"},
+		{Source{Name: "a", Root: "~", Include: []string{"a"}, Dest: "hosts/a"}, "is reserved"},
+		{Source{Profile: "cursor"}, "unknown profile"},
+		// source_dir would leave out its own files below these dests
+		{Source{Name: "a", Root: "~", Include: []string{"a"}, Dest: "projects"}, `dest projects overlaps "projects" of source_dir's include`},
+		{Source{Name: "a", Root: "~", Include: []string{"a"}, Dest: "projects/a"}, `overlaps "projects"`},
+		{Source{Name: "a", Root: "~", Include: []string{"a"}, Dest: "plans"}, `overlaps "plans/"`},
+		{Source{Name: "a", Root: "~", Include: []string{"a"}, Dest: "history.jsonl"}, `overlaps "history.jsonl"`},
+		{Source{Name: "a", Root: "~", Include: []string{"a"}, Dest: "notes.md"}, `overlaps "*.md"`},
+		{Source{Name: "a", Root: "~", Include: []string{"a"}, Dest: "usage-data"}, `overlaps "usage-data/daily"`},
+	} {
+		_, err := ResolveSources([]Source{tt.source}, include)
+		assert.ErrorContains(t, err, tt.err)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	doc, err := ParseDocument([]byte(`# ccbackup
+backup_dir: "~/claude-backup" # synced
+include:
+  - projects # transcripts
+  - plans
+secrets:
+  enabled: true
+`))
+	require.NoError(t, err)
+
+	old, changed, err := doc.Set("Backup_Dir", "~/elsewhere")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "~/claude-backup", old)
+	_, changed, err = doc.Set("secrets.enabled", "true")
+	require.NoError(t, err)
+	assert.False(t, changed)
+	_, _, err = doc.Set("host_namespace", "1")
+	require.NoError(t, err)
+	_, _, err = doc.Set("cas.compression", "maybe")
+	assert.ErrorContains(t, err, "want true or false")
+	_, _, err = doc.Set("include", "projects")
+	assert.ErrorContains(t, err, "include is a list")
+	_, _, err = doc.Set("secrets.enabld", "false")
+	assert.ErrorContains(t, err, "did you mean enabled?")
+
+	changed, err = doc.Add("include", "todos", nil)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = doc.Add("include", "plans", nil)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	changed, err = doc.Remove("include", "plans", nil)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	_, err = doc.Add("secrets.enabled", "x", nil)
+	assert.ErrorContains(t, err, "not a list of strings")
+
+	// A list the file does not set starts from the one in effect
+	changed, err = doc.Add("project_local.include", "AGENTS.md", []string{"CLAUDE.md"})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	data, err := doc.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, `# ccbackup
+backup_dir: "~/elsewhere" # synced
+include:
+  - projects # transcripts
+  - todos
+secrets:
+  enabled: true
+host_namespace: true
+project_local:
+  include:
+    - CLAUDE.md
+    - AGENTS.md
+`, string(data))
+
+	doc, err = ParseDocument(nil)
+	require.NoError(t, err)
+	_, _, err = doc.Set("source_dir", "~/.claude")
+	require.NoError(t, err)
+	data, err = doc.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, "source_dir: ~/.claude\n", string(data))
+
+	_, err = ParseDocument([]byte("- a\n"))
+	assert.ErrorContains(t, err, "not a mapping")
+}
+
+func TestExplain(t *testing.T) {
+	s, ok := Explain("include", []Value{
+		{Layer: LayerFile, Source: "config.yaml", Value: []interface{}{"projects"}},
+		{Layer: LayerDefault, Value: []string{"projects", "plans"}},
+		{Layer: LayerEnv, Source: "CCBACKUP_INCLUDE", Value: "todos"},
+	})
+	require.True(t, ok)
+	assert.Equal(t, "include", s.Key)
+	assert.Equal(t, LayerEnv, s.Layer)
+	assert.Equal(t, "todos", s.Value.Value)
+	require.Len(t, s.Overridden, 2)
+	assert.Equal(t, LayerFile, s.Overridden[0].Layer)
+	assert.Equal(t, LayerDefault, s.Overridden[1].Layer)
+
+	_, ok = Explain("host_id", nil)
+	assert.False(t, ok)
+}
+
+func TestSetting_Mask(t *testing.T) {
+	s, ok := Explain("s3.secret_access_key", []Value{
+		{Layer: LayerDefault, Value: ""},
+		{Layer: LayerFile, Source: "config.yaml", Value: "file-secret"},
+		{Layer: LayerEnv, Source: "CCBACKUP_S3.SECRET_ACCESS_KEY", Value: "env-secret"},
+	})
+	require.True(t, ok)
+	s = s.Mask()
+	assert.Equal(t, "****", s.Value.Value)
+	require.Len(t, s.Overridden, 2)
+	assert.Equal(t, "****", s.Overridden[0].Value)
+	// An unset credential still shows as unset
+	assert.Equal(t, "", s.Overridden[1].Value)
+
+	s, ok = Explain("host_id", []Value{{Layer: LayerFile, Value: "laptop"}})
+	require.True(t, ok)
+	assert.Equal(t, "laptop", s.Mask().Value.Value)
+}
+
+func TestKeys(t *testing.T) {
+	keys := Keys()
+	assert.Equal(t, "version", keys[0])
+	assert.Contains(t, keys, "secrets.builtin_action")
+	assert.Contains(t, keys, "sources")
+	assert.NotContains(t, keys, "secrets")
+	for _, key := range keys {
+		_, err := KeyType(key)
+		assert.NoError(t, err, key)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	raw := parse(t, "Secrets:\n  Enabled: false\ninclude: [a]\n")
+	v, ok := Lookup(raw, "secrets.enabled")
+	require.True(t, ok)
+	assert.Equal(t, false, v)
+	_, ok = Lookup(raw, "include.a")
+	assert.False(t, ok)
+	_, ok = Lookup(nil, "include")
+	assert.False(t, ok)
+}
+
+func TestMigrate(t *testing.T) {
+	require.Equal(t, CurrentVersion, migrations[len(migrations)-1].Version)
+
+	doc, err := ParseDocument([]byte("# mine\ninclude:\n  - projects\n  - usage-data\n"))
+	require.NoError(t, err)
+	from, applied, err := Migrate(doc)
+	require.NoError(t, err)
+	assert.Equal(t, 1, from)
+	assert.Equal(t, []string{"add usage-data and stats-cache.json to include"}, applied)
+	data, err := doc.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, "# mine\nversion: 2\ninclude:\n  - projects\n  - usage-data\n  - stats-cache.json\n", string(data))
+
+	// Files without include get the new defaults anyway
+	doc, err = ParseDocument([]byte("backup_dir: /b\n"))
+	require.NoError(t, err)
+	_, applied, err = Migrate(doc)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	data, err = doc.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, "version: 2\nbackup_dir: /b\n", string(data))
+
+	doc, err = ParseDocument([]byte("version: 0\n"))
+	require.NoError(t, err)
+	_, _, err = Migrate(doc)
+	assert.ErrorContains(t, err, "want a positive integer")
+}
+
+func TestMigrate_Rename(t *testing.T) {
+	list := []Migration{
+		{Version: 2, Description: "rename secrets.action", Apply: renameKey("secrets.action", "secrets.builtin_action")},
+		{Version: 3, Description: "move search_index", Apply: renameKey("search_index", "search.index")},
+	}
+	doc, err := ParseDocument([]byte("version: 2\nsearch_index: ~/idx # fast\nsecrets:\n  action: redact\n  enabled: true\n"))
+	require.NoError(t, err)
+	from, applied, err := migrate(doc, list)
+	require.NoError(t, err)
+	assert.Equal(t, 2, from)
+	assert.Equal(t, []string{"move search_index"}, applied)
+	data, err := doc.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, "version: 3\nsecrets:\n  action: redact\n  enabled: true\nsearch:\n  index: ~/idx # fast\n", string(data))
+
+	doc, err = ParseDocument([]byte("secrets:\n  action: redact\n  enabled: true\n"))
+	require.NoError(t, err)
+	_, applied, err = migrate(doc, list)
+	require.NoError(t, err)
+	assert.Len(t, applied, 1)
+	data, err = doc.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, "version: 3\nsecrets:\n  builtin_action: redact\n  enabled: true\n", string(data))
+
+	doc, err = ParseDocument([]byte("search_index: a\nsearch:\n  index: b\n"))
+	require.NoError(t, err)
+	_, _, err = migrate(doc, list)
+	assert.ErrorContains(t, err, "both are set")
+
+	doc, err = ParseDocument([]byte("version: 4\n"))
+	require.NoError(t, err)
+	_, _, err = migrate(doc, list)
+	assert.ErrorContains(t, err, "config version 4 is newer than 3")
+}
+
+func TestCheckVersion(t *testing.T) {
+	assert.Empty(t, CheckVersion(parse(t, "version: 2\n")))
+	issues := CheckVersion(parse(t, "include: [a]\n"))
+	require.Len(t, issues, 1)
+	assert.Equal(t, Warning, issues[0].Severity)
+	issues = CheckVersion(parse(t, "version: 9\n"))
+	require.Len(t, issues, 1)
+	assert.Equal(t, Error, issues[0].Severity)
+	assert.Empty(t, CheckVersion(parse(t, "version: two\n")))
+	assert.Len(t, CheckKeys(parse(t, "version: two\n")), 1)
+}
@@ -0,0 +1,327 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// KeyType returns the schema type of a dotted key such as secrets.enabled.
+func KeyType(key string) (reflect.Type, error) {
+	t := reflect.TypeOf(Config{})
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		if t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("unknown key %s: %s is not a mapping", key, strings.Join(parts[:i], "."))
+		}
+		fields := schemaFields(t)
+		ft, ok := fields[strings.ToLower(part)]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %s%s", key, suggest(part, fields))
+		}
+		t = ft
+	}
+	return t, nil
+}
+
+// IsStringList reports whether the key is a list of strings, such as include.
+func IsStringList(key string) bool {
+	t, err := KeyType(key)
+	return err == nil && t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String
+}
+
+// Document is a config file kept as a YAML node tree, so that edits keep
+// its comments and the order of its keys.
+type Document struct {
+	root *yaml.Node
+}
+
+// ParseDocument parses a config file. An empty file is an empty mapping.
+func ParseDocument(data []byte) (*Document, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if root.Kind == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config is not a mapping")
+	}
+	return &Document{root: &root}, nil
+}
+
+// Bytes encodes the document.
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Set sets a scalar key to value, parsed as the key's type. It returns
+// the previous value in the file, "" if the file did not set the key, and
+// whether the value changed.
+func (d *Document) Set(key, value string) (string, bool, error) {
+	t, err := KeyType(key)
+	if err != nil {
+		return "", false, err
+	}
+	var tag string
+	switch t.Kind() {
+	case reflect.String:
+		tag = "!!str"
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", false, fmt.Errorf("%s: want true or false, got %q", key, value)
+		}
+		tag, value = "!!bool", strconv.FormatBool(b)
+	case reflect.Int:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", false, fmt.Errorf("%s: want an integer, got %q", key, value)
+		}
+		tag = "!!int"
+	case reflect.Float64:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", false, fmt.Errorf("%s: want a number, got %q", key, value)
+		}
+		tag = "!!float"
+	case reflect.Slice:
+		return "", false, fmt.Errorf("%s is a list, use 'ccbackup config add' or 'ccbackup config remove'", key)
+	default:
+		return "", false, fmt.Errorf("%s is a mapping, set its keys instead", key)
+	}
+
+	node, err := d.lookup(key)
+	if err != nil {
+		return "", false, err
+	}
+	old := ""
+	if node.Kind == yaml.ScalarNode {
+		old = node.Value
+		if node.Value == value && node.Tag == tag {
+			return old, false, nil
+		}
+	}
+	style := node.Style
+	if node.Kind != yaml.ScalarNode || tag != "!!str" {
+		style = 0
+	}
+	*node = yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Style: style,
+		HeadComment: node.HeadComment, LineComment: node.LineComment, FootComment: node.FootComment}
+	return old, true, nil
+}
+
+// Add appends value to a list key unless the list has it already. If the
+// file does not set the key, the list starts from current, the value in
+// effect. It reports whether the list changed.
+func (d *Document) Add(key, value string, current []string) (bool, error) {
+	list, err := d.list(key, current)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range list.Content {
+		if n.Value == value {
+			return false, nil
+		}
+	}
+	list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	return true, nil
+}
+
+// Remove deletes value from a list key, starting from current like Add.
+// It reports whether the list changed.
+func (d *Document) Remove(key, value string, current []string) (bool, error) {
+	list, err := d.list(key, current)
+	if err != nil {
+		return false, err
+	}
+	kept := list.Content[:0]
+	for _, n := range list.Content {
+		if n.Value != value {
+			kept = append(kept, n)
+		}
+	}
+	removed := len(kept) < len(list.Content)
+	list.Content = kept
+	return removed, nil
+}
+
+// list returns the sequence node of a list key, created from current if
+// the file does not set it.
+func (d *Document) list(key string, current []string) (*yaml.Node, error) {
+	if _, err := KeyType(key); err != nil {
+		return nil, err
+	}
+	if !IsStringList(key) {
+		return nil, fmt.Errorf("%s is not a list of strings", key)
+	}
+	node, err := d.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	switch node.Kind {
+	case yaml.SequenceNode:
+	case 0:
+		*node = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, v := range current {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v})
+		}
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			*node = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", HeadComment: node.HeadComment, LineComment: node.LineComment}
+			break
+		}
+		fallthrough
+	default:
+		return nil, fmt.Errorf("%s is not a list in the config file", key)
+	}
+	for _, n := range node.Content {
+		if n.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%s is not a list of strings in the config file", key)
+		}
+	}
+	return node, nil
+}
+
+// Has reports whether the file sets a dotted key.
+func (d *Document) Has(key string) bool {
+	_, i := d.find(key)
+	return i >= 0
+}
+
+// Rename moves the value of key from to key to, keeping its comments. It
+// reports whether the file set from; it fails if the file sets both.
+func (d *Document) Rename(from, to string) (bool, error) {
+	parent, i := d.find(from)
+	if i < 0 {
+		return false, nil
+	}
+	if d.Has(to) {
+		return false, fmt.Errorf("cannot rename %s to %s: both are set", from, to)
+	}
+	name, value := parent.Content[i], parent.Content[i+1]
+	fromDir, _ := splitKey(from)
+	toDir, toName := splitKey(to)
+	if strings.EqualFold(fromDir, toDir) {
+		// Renamed in place, so the key keeps its position
+		name.Value = toName
+		return true, nil
+	}
+	parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+	node, err := d.lookup(to)
+	if err != nil {
+		return false, err
+	}
+	*node = *value
+	// Carry the comments of the old key over to the new one
+	if parent, j := d.find(to); j >= 0 {
+		parent.Content[j].HeadComment, parent.Content[j].LineComment = name.HeadComment, name.LineComment
+	}
+	return true, nil
+}
+
+// Version returns the version of the config file. Files without a version
+// field are version 1, the format before versions were added.
+func (d *Document) Version() (int, error) {
+	parent, i := d.find("version")
+	if i < 0 {
+		return 1, nil
+	}
+	v, err := strconv.Atoi(parent.Content[i+1].Value)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("version: want a positive integer, got %q", parent.Content[i+1].Value)
+	}
+	return v, nil
+}
+
+// setVersion sets the version field, adding it as the first key.
+func (d *Document) setVersion(v int) {
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(v)}
+	if parent, i := d.find("version"); i >= 0 {
+		parent.Content[i+1] = value
+		return
+	}
+	root := d.root.Content[0]
+	name := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	// A comment heading the file stays on top
+	if len(root.Content) > 0 {
+		name.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{name, value}, root.Content...)
+}
+
+// splitKey splits a dotted key into the key of its mapping and its name.
+func splitKey(key string) (string, string) {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// find returns the mapping holding a dotted key and the index of the key
+// in it, or -1 if the file does not set the key.
+func (d *Document) find(key string) (*yaml.Node, int) {
+	node := d.root.Content[0]
+	parts := strings.Split(key, ".")
+	for n, part := range parts {
+		if node.Kind != yaml.MappingNode {
+			return nil, -1
+		}
+		i := -1
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if strings.EqualFold(node.Content[j].Value, part) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, -1
+		}
+		if n == len(parts)-1 {
+			return node, i
+		}
+		node = node.Content[i+1]
+	}
+	return nil, -1
+}
+
+// lookup returns the value node of a dotted key, matching keys
+// case-insensitively. Missing mappings are added, and a missing key gets
+// a node of kind 0 for the caller to fill.
+func (d *Document) lookup(key string) (*yaml.Node, error) {
+	node := d.root.Content[0]
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		if node.Kind == 0 {
+			*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s is not a mapping in the config file", strings.Join(parts[:i], "."))
+		}
+		var next *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if strings.EqualFold(node.Content[j].Value, part) {
+				next = node.Content[j+1]
+				break
+			}
+		}
+		if next == nil {
+			next = &yaml.Node{}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, next)
+		}
+		node = next
+	}
+	return node, nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import "fmt"
+
+// CurrentVersion is the version of config files this ccbackup writes.
+const CurrentVersion = 2
+
+// Migration upgrades a config file from the version before Version to
+// Version. Apply reports whether it changed the file.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(*Document) (bool, error)
+}
+
+// migrations upgrade config files, oldest first. Append a migration and
+// raise CurrentVersion whenever a default changes in a way existing files
+// should follow, or a key is renamed.
+var migrations = []Migration{
+	{
+		Version:     2,
+		Description: "add usage-data and stats-cache.json to include",
+		Apply:       addIncludes("usage-data", "stats-cache.json"),
+	},
+}
+
+// Migrate upgrades doc to CurrentVersion. It returns the version doc had and
+// the descriptions of the migrations that changed it.
+func Migrate(doc *Document) (int, []string, error) {
+	return migrate(doc, migrations)
+}
+
+func migrate(doc *Document, list []Migration) (int, []string, error) {
+	from, err := doc.Version()
+	if err != nil {
+		return 0, nil, err
+	}
+	latest := list[len(list)-1].Version
+	if from > latest {
+		return from, nil, fmt.Errorf("config version %d is newer than %d, the latest this ccbackup supports", from, latest)
+	}
+	var applied []string
+	for _, m := range list {
+		if m.Version <= from {
+			continue
+		}
+		changed, err := m.Apply(doc)
+		if err != nil {
+			return from, nil, fmt.Errorf("migrate to version %d: %w", m.Version, err)
+		}
+		if changed {
+			applied = append(applied, m.Description)
+		}
+	}
+	if from < latest {
+		doc.setVersion(latest)
+	}
+	return from, applied, nil
+}
+
+// CheckVersion reports a config file whose version is not CurrentVersion.
+func CheckVersion(raw map[string]interface{}) []Issue {
+	version := 1
+	if v, ok := Lookup(raw, "version"); ok {
+		n, ok := v.(int)
+		if !ok {
+			// CheckKeys reports the type
+			return nil
+		}
+		if n < 1 {
+			return []Issue{{Severity: Error, Key: "version", Message: fmt.Sprintf("want a positive integer, got %d", n)}}
+		}
+		version = n
+	}
+	switch {
+	case version > CurrentVersion:
+		return []Issue{{Severity: Error, Key: "version", Message: fmt.Sprintf("%d is newer than %d, the latest this ccbackup supports", version, CurrentVersion)}}
+	case version < CurrentVersion:
+		return []Issue{{Severity: Warning, Key: "version", Message: fmt.Sprintf("%d is older than %d, run 'ccbackup config migrate'", version, CurrentVersion)}}
+	}
+	return nil
+}
+
+// addIncludes returns a migration that adds new default patterns to
+// include, if the file sets include. Files that do not set it already get
+// the new defaults.
+func addIncludes(patterns ...string) func(*Document) (bool, error) {
+	return func(d *Document) (bool, error) {
+		if !d.Has("include") {
+			return false, nil
+		}
+		changed := false
+		for _, p := range patterns {
+			added, err := d.Add("include", p, nil)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || added
+		}
+		return changed, nil
+	}
+}
+
+// renameKey returns a migration that renames a key.
+func renameKey(from, to string) func(*Document) (bool, error) {
+	return func(d *Document) (bool, error) {
+		return d.Rename(from, to)
+	}
+}
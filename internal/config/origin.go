@@ -0,0 +1,135 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Layer is where a setting came from. Later layers override earlier ones.
+type Layer string
+
+const (
+	LayerDefault Layer = "default"
+	LayerFile    Layer = "file"
+	LayerEnv     Layer = "env"
+	LayerFlag    Layer = "flag"
+)
+
+// Layers lists the layers from the lowest precedence to the highest.
+var Layers = []Layer{LayerDefault, LayerFile, LayerEnv, LayerFlag}
+
+// Value is the value a layer gives a key. Source names where in the layer
+// it is: the config file, the environment variable or the flag.
+type Value struct {
+	Layer  Layer       `json:"layer" yaml:"layer"`
+	Source string      `json:"source,omitempty" yaml:"source,omitempty"`
+	Value  interface{} `json:"value" yaml:"value"`
+}
+
+// Setting is the value of a key in effect, and the values of lower layers
+// it overrides, the nearest first.
+type Setting struct {
+	Key        string `json:"key" yaml:"key"`
+	Value      `yaml:",inline"`
+	Overridden []Value `json:"overridden,omitempty" yaml:"overridden,omitempty"`
+}
+
+// Explain picks the value in effect among the values of a key, one per
+// layer at most. It reports false if no layer sets the key.
+func Explain(key string, values []Value) (Setting, bool) {
+	rank := func(l Layer) int {
+		for i, layer := range Layers {
+			if l == layer {
+				return i
+			}
+		}
+		return -1
+	}
+	ordered := append([]Value(nil), values...)
+	sort.SliceStable(ordered, func(i, j int) bool { return rank(ordered[i].Layer) > rank(ordered[j].Layer) })
+	if len(ordered) == 0 {
+		return Setting{Key: key}, false
+	}
+	return Setting{Key: key, Value: ordered[0], Overridden: ordered[1:]}, true
+}
+
+// secretKeys are the keys whose values are credentials.
+var secretKeys = map[string]bool{
+	"s3.secret_access_key": true,
+	"s3.session_token":     true,
+	"webdav.password":      true,
+}
+
+// IsSecret reports whether a dotted key holds a credential.
+func IsSecret(key string) bool {
+	return secretKeys[strings.ToLower(key)]
+}
+
+// Mask replaces the values of a secret key with ****, keeping empty
+// values so that an unset credential still shows as unset.
+func (s Setting) Mask() Setting {
+	if !IsSecret(s.Key) {
+		return s
+	}
+	mask := func(v Value) Value {
+		if v.Value != nil && v.Value != "" {
+			v.Value = "****"
+		}
+		return v
+	}
+	s.Value = mask(s.Value)
+	var overridden []Value
+	for _, v := range s.Overridden {
+		overridden = append(overridden, mask(v))
+	}
+	s.Overridden = overridden
+	return s
+}
+
+// Keys returns the dotted keys of the settings in the schema, in the order
+// of Config. Lists and their items are one setting.
+func Keys() []string {
+	return leafKeys("", reflect.TypeOf(Config{}))
+}
+
+func leafKeys(prefix string, t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("mapstructure")
+		if name == "" {
+			continue
+		}
+		key := joinKey(prefix, name)
+		if f.Type.Kind() == reflect.Struct {
+			keys = append(keys, leafKeys(key, f.Type)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Lookup returns the value of a dotted key in a parsed config file,
+// matching keys case-insensitively.
+func Lookup(raw map[string]interface{}, key string) (interface{}, bool) {
+	var v interface{} = raw
+	for _, part := range strings.Split(key, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		found := false
+		for name, child := range m {
+			if strings.EqualFold(name, part) {
+				v, found = child, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return v, true
+}
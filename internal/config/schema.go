@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Severity tells whether an issue makes a config invalid.
+type Severity string
+
+const (
+	// Error issues make backup and restore refuse to run.
+	Error Severity = "error"
+	// Warning issues are reported but do not stop anything.
+	Warning Severity = "warning"
+)
+
+// Issue is a problem found in a config.
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Key      string   `json:"key"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Key, i.Message)
+}
+
+// Errors returns the issues of severity Error.
+func Errors(issues []Issue) []Issue {
+	var errs []Issue
+	for _, i := range issues {
+		if i.Severity == Error {
+			errs = append(errs, i)
+		}
+	}
+	return errs
+}
+
+// CheckKeys compares a parsed config file with the schema of Config and
+// reports unknown keys and values of the wrong type. Keys are matched
+// case-insensitively, as viper does.
+func CheckKeys(raw map[string]interface{}) []Issue {
+	return checkValue("", raw, reflect.TypeOf(Config{}))
+}
+
+func checkValue(key string, v interface{}, t reflect.Type) []Issue {
+	if v == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return wrongType(key, v, "a mapping")
+		}
+		fields := schemaFields(t)
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var issues []Issue
+		for _, name := range names {
+			child := joinKey(key, name)
+			ft, ok := fields[strings.ToLower(name)]
+			if !ok {
+				issues = append(issues, Issue{Severity: Error, Key: child, Message: "unknown key" + suggest(name, fields)})
+				continue
+			}
+			issues = append(issues, checkValue(child, m[name], ft)...)
+		}
+		return issues
+	case reflect.Slice:
+		list, ok := v.([]interface{})
+		if !ok {
+			return wrongType(key, v, "a list")
+		}
+		var issues []Issue
+		for i, e := range list {
+			issues = append(issues, checkValue(fmt.Sprintf("%s[%d]", key, i), e, t.Elem())...)
+		}
+		return issues
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			return wrongType(key, v, "a string")
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			return wrongType(key, v, "true or false")
+		}
+	case reflect.Int:
+		if _, ok := v.(int); !ok {
+			return wrongType(key, v, "an integer")
+		}
+	case reflect.Float64:
+		switch v.(type) {
+		case int, int64, uint64, float64:
+		default:
+			return wrongType(key, v, "a number")
+		}
+	}
+	return nil
+}
+
+// schemaFields returns the field types of a config struct by lowercase key.
+func schemaFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name := f.Tag.Get("mapstructure"); name != "" {
+			fields[name] = f.Type
+		}
+	}
+	return fields
+}
+
+func wrongType(key string, v interface{}, want string) []Issue {
+	return []Issue{{Severity: Error, Key: key, Message: fmt.Sprintf("want %s, got %s", want, describe(v))}}
+}
+
+// describe names the YAML type of a decoded value.
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case bool:
+		return fmt.Sprintf("%t", v)
+	case map[string]interface{}:
+		return "a mapping"
+	case []interface{}:
+		return "a list"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func joinKey(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// suggest returns a hint naming the known key closest to an unknown one.
+func suggest(name string, fields map[string]reflect.Type) string {
+	norm := strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+	best, bestDist := "", 3
+	for known := range fields {
+		d := editDistance(norm, known)
+		if d < bestDist || d == bestDist && known < best {
+			best, bestDist = known, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/takoeight0821/ccbackup/internal/profile"
+	"github.com/takoeight0821/ccbackup/internal/session"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+// ProjectLocalDir is the backup directory of the Claude files kept in the
+// projects themselves, one directory per project.
+const ProjectLocalDir = "project-local"
+
+// PrimarySource names source_dir among the sources.
+const PrimarySource = "source_dir"
+
+// reservedDirs are the backup directories ccbackup uses itself.
+var reservedDirs = []string{".git", ".ccbackup", session.HostsDir, ProjectLocalDir}
+
+// Source is an entry of sources: a directory backed up below Dest of the backup.
+type Source struct {
+	Name    string   `mapstructure:"name"`
+	Profile string   `mapstructure:"profile"`
+	Root    string   `mapstructure:"root"`
+	Include []string `mapstructure:"include"`
+	Exclude []string `mapstructure:"exclude"`
+	Dest    string   `mapstructure:"dest"`
+}
+
+// WithProfile fills the fields s leaves unset from its profile, if it has
+// one. The profile's name is the default name and dest.
+func (s Source) WithProfile() (Source, error) {
+	if s.Profile == "" {
+		return s, nil
+	}
+	p, err := profile.Lookup(s.Profile)
+	if err != nil {
+		return s, err
+	}
+	if s.Name == "" {
+		s.Name = p.Name
+	}
+	if s.Root == "" {
+		s.Root = p.Root
+	}
+	if len(s.Include) == 0 {
+		s.Include = p.Include
+	}
+	if s.Dest == "" {
+		s.Dest = p.Name
+	}
+	return s, nil
+}
+
+// ResolveSources applies profiles and checks that every source is complete
+// and has its own dest. Dests are returned cleaned and slash-separated.
+// include is source_dir's include patterns: source_dir leaves out the
+// dests, so a dest must not hold the files they back up.
+func ResolveSources(sources []Source, include []string) ([]Source, error) {
+	resolved := make([]Source, 0, len(sources))
+	seen := map[string]bool{PrimarySource: true}
+	for i, s := range sources {
+		s, err := s.WithProfile()
+		if err != nil {
+			return nil, fmt.Errorf("sources[%d]: %w", i, err)
+		}
+		if s.Name == "" {
+			return nil, fmt.Errorf("sources[%d]: name is required", i)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("sources[%d]: duplicate name %q", i, s.Name)
+		}
+		seen[s.Name] = true
+		if s.Root == "" {
+			return nil, fmt.Errorf("source %s: root is required", s.Name)
+		}
+		if len(s.Include) == 0 {
+			return nil, fmt.Errorf("source %s: include is required", s.Name)
+		}
+		if s.Dest, err = cleanDest(s.Dest); err != nil {
+			return nil, fmt.Errorf("source %s: %w", s.Name, err)
+		}
+		if pattern, ok := includedBy(s.Dest, include); ok {
+			return nil, fmt.Errorf("source %s: dest %s overlaps %q of source_dir's include", s.Name, s.Dest, pattern)
+		}
+		for _, other := range resolved {
+			if s.Dest == other.Dest || strings.HasPrefix(s.Dest, other.Dest+"/") || strings.HasPrefix(other.Dest, s.Dest+"/") {
+				return nil, fmt.Errorf("source %s: dest %s overlaps source %s", s.Name, s.Dest, other.Name)
+			}
+		}
+		resolved = append(resolved, s)
+	}
+	return resolved, nil
+}
+
+// includedBy returns the include pattern that matches dest or a path
+// below it.
+func includedBy(dest string, include []string) (string, bool) {
+	for _, pattern := range include {
+		p := strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if sync.NewFilter([]string{p}).ShouldInclude(dest) ||
+			(!strings.Contains(p, "*") && strings.HasPrefix(p, dest+"/")) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// cleanDest checks that dest is a relative directory of the backup that
+// ccbackup does not use itself, and returns it cleaned.
+func cleanDest(dest string) (string, error) {
+	if dest == "" {
+		return "", fmt.Errorf("dest is required")
+	}
+	clean := path.Clean(filepath.ToSlash(dest))
+	top, _, _ := strings.Cut(clean, "/")
+	if path.IsAbs(clean) || filepath.IsAbs(dest) || clean == "." || top == ".." {
+		return "", fmt.Errorf("dest %q must be a directory inside backup_dir", dest)
+	}
+	for _, dir := range reservedDirs {
+		if top == dir {
+			return "", fmt.Errorf("dest %q is reserved", dest)
+		}
+	}
+	return clean, nil
+}
@@ -0,0 +1,73 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Blob is one stored version of a file.
+type Blob struct {
+	Path   string
+	Object string
+}
+
+// TreeBlobs returns the files of rev under the given paths.
+func (g *Git) TreeBlobs(rev string, paths ...string) ([]Blob, error) {
+	args := append([]string{"ls-tree", "-r", "-z", "--full-tree", rev, "--"}, paths...)
+	out, err := g.output(args...)
+	if err != nil {
+		return nil, fmt.Errorf("ls-tree %s: %w", rev, err)
+	}
+	var blobs []Blob
+	for _, line := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		meta, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		blobs = append(blobs, Blob{Path: name, Object: fields[2]})
+	}
+	return blobs, nil
+}
+
+// DeletedBlobs returns the last version of every file under the given paths
+// that was deleted on HEAD's history, newest deletion first.
+// A file deleted more than once is reported once.
+func (g *Git) DeletedBlobs(paths ...string) ([]Blob, error) {
+	args := append([]string{"log", "--diff-filter=D", "--raw", "--no-renames", "--no-abbrev", "-z", "--format=%H", "HEAD", "--"}, paths...)
+	out, err := g.output(args...)
+	if err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+
+	// <commit> NUL NL :<old mode> <new mode> <old object> <new object> D NUL <path> NUL ...
+	var blobs []Blob
+	seen := map[string]bool{}
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i+1 < len(fields); i++ {
+		meta := strings.TrimPrefix(fields[i], "\n")
+		if !strings.HasPrefix(meta, ":") {
+			continue
+		}
+		name := fields[i+1]
+		i++
+		parts := strings.Fields(meta)
+		if len(parts) != 5 || seen[name] {
+			continue
+		}
+		seen[name] = true
+		blobs = append(blobs, Blob{Path: name, Object: parts[2]})
+	}
+	return blobs, nil
+}
+
+// OpenBlob streams a blob through the filters configured for its path,
+// so LFS pointers are smudged when git-lfs is installed.
+func (g *Git) OpenBlob(b Blob) (io.ReadCloser, error) {
+	return catFile(g.Dir, "--filters", "--path="+b.Path, b.Object)
+}
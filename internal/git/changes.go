@@ -0,0 +1,120 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Change statuses reported by Changes.
+const (
+	Added    = "A"
+	Modified = "M"
+	Deleted  = "D"
+)
+
+// Change is a file changed by one commit.
+type Change struct {
+	Path   string
+	Status string
+	// OldSize and NewSize are the blob sizes before and after the commit,
+	// zero when the file did not exist.
+	OldSize int64
+	NewSize int64
+}
+
+// zeroHash is the object name git reports for a missing side of a change.
+const zeroHash = "0000000000000000000000000000000000000000"
+
+// Changes returns the files changed by rev relative to its first parent,
+// or every file if rev is a root commit. Renames are reported as a
+// deletion and an addition.
+func (g *Git) Changes(rev string) ([]Change, error) {
+	out, err := g.output("diff-tree", "-r", "-z", "--raw", "--no-renames", "--no-commit-id", "--root", rev+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("diff-tree %s: %w", rev, err)
+	}
+
+	// :<old mode> <new mode> <old object> <new object> <status> NUL <path> NUL
+	type raw struct {
+		Change
+		oldObj, newObj string
+	}
+	var changes []raw
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 {
+			return nil, fmt.Errorf("unexpected diff-tree output %q", fields[i])
+		}
+		if meta[0] == "160000" || meta[1] == "160000" {
+			continue // submodules have no blob
+		}
+		status := meta[4][:1]
+		if status != Added && status != Deleted {
+			status = Modified
+		}
+		changes = append(changes, raw{
+			Change: Change{Path: fields[i+1], Status: status},
+			oldObj: meta[2],
+			newObj: meta[3],
+		})
+	}
+
+	var objects []string
+	for _, c := range changes {
+		objects = append(objects, c.oldObj, c.newObj)
+	}
+	sizes, err := g.blobSizes(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Change, len(changes))
+	for i, c := range changes {
+		c.OldSize, c.NewSize = sizes[c.oldObj], sizes[c.newObj]
+		result[i] = c.Change
+	}
+	return result, nil
+}
+
+// blobSizes returns the size of each object, skipping zeroHash.
+func (g *Git) blobSizes(objects []string) (map[string]int64, error) {
+	var in bytes.Buffer
+	for _, obj := range objects {
+		if obj != zeroHash {
+			fmt.Fprintln(&in, obj)
+		}
+	}
+	sizes := map[string]int64{}
+	if in.Len() == 0 {
+		return sizes, nil
+	}
+
+	cmd := exec.Command("git", "cat-file", "--batch-check=%(objectname) %(objectsize)")
+	cmd.Dir = g.Dir
+	cmd.Stdin = &in
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cat-file: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		name, size, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cat-file: %s missing", name)
+		}
+		sizes[name] = n
+	}
+	return sizes, scanner.Err()
+}
@@ -63,6 +63,11 @@ func (g *Git) HasChanges() (bool, error) {
 	return strings.TrimSpace(string(output)) != "", nil
 }
 
+// Fsck checks the connectivity and validity of the object database.
+func (g *Git) Fsck() error {
+	return g.run("fsck", "--no-progress")
+}
+
 // run executes a git command.
 func (g *Git) run(args ...string) error {
 	cmd := exec.Command("git", args...)
@@ -1,10 +1,16 @@
 package git
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -158,3 +164,329 @@ func TestLFS_DryRun(t *testing.T) {
 	_, err = os.Stat(filepath.Join(dir, ".gitattributes"))
 	assert.True(t, os.IsNotExist(err))
 }
+
+func TestTreeFS(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGit(dir)
+	require.NoError(t, g.Init())
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "projects", "p"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "projects", "p", "s.jsonl"), []byte("v1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "history.jsonl"), []byte("h"), 0644))
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("first"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "projects", "p", "s.jsonl"), []byte("v2 longer"), 0644))
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("second"))
+
+	tree, err := NewTreeFS(dir, "HEAD~1")
+	require.NoError(t, err)
+
+	info, err := tree.Stat("projects/p/s.jsonl")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), info.Size())
+	assert.Equal(t, tree.ModTime(), info.ModTime())
+
+	r, err := tree.Open("projects/p/s.jsonl")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "v1", string(data))
+
+	var files []string
+	require.NoError(t, tree.Walk(".", func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"history.jsonl", "projects/p/s.jsonl"}, files)
+
+	// Blob ids tell unchanged files apart without reading them
+	head, err := NewTreeFS(dir, "HEAD")
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name string
+		same bool
+	}{{"history.jsonl", true}, {"projects/p/s.jsonl", false}} {
+		algo, old, err := tree.ContentHash(c.name)
+		require.NoError(t, err)
+		assert.Equal(t, "git", algo)
+		_, cur, err := head.ContentHash(c.name)
+		require.NoError(t, err)
+		assert.Equal(t, c.same, old == cur, c.name)
+	}
+
+	_, err = tree.Stat("missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, _, err = tree.ContentHash("missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Error(t, tree.WriteFile("x", strings.NewReader(""), 0644, time.Now()))
+
+	_, err = NewTreeFS(dir, "no-such-rev")
+	assert.Error(t, err)
+}
+
+func TestTreeFS_LFSPointer(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGit(dir)
+	require.NoError(t, g.Init())
+
+	// A pointer committed as is, and its object in the local LFS store
+	content := strings.Repeat("snapshot data\n", 200)
+	oid := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))
+	objects := filepath.Join(dir, ".git", "lfs", "objects", oid[0:2], oid[2:4])
+	require.NoError(t, os.MkdirAll(objects, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(objects, oid), []byte(content), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.bin"), []byte(pointer), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "small.txt"), []byte("version 1\n"), 0644))
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("lfs"))
+
+	tree, err := NewTreeFS(dir, "HEAD")
+	require.NoError(t, err)
+
+	// Stat and Open agree on the real content
+	info, err := tree.Stat("big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size())
+	r, err := tree.Open("big.bin")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, content, string(data))
+
+	info, err = tree.Stat("small.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), info.Size())
+
+	// A missing object is an error, not the pointer text
+	require.NoError(t, os.Remove(filepath.Join(objects, oid)))
+	_, err = tree.Open("big.bin")
+	assert.ErrorContains(t, err, "not in the local store")
+}
+
+// commitAt writes content to file and commits it with the given date.
+func commitAt(t *testing.T, g *Git, content string, date time.Time) {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_DATE", date.Format(time.RFC3339))
+	t.Setenv("GIT_COMMITTER_DATE", date.Format(time.RFC3339))
+	require.NoError(t, os.WriteFile(filepath.Join(g.Dir, "history.jsonl"), []byte(content), 0644))
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("Backup "+date.Format("2006-01-02 15:04")))
+}
+
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	return strings.TrimSpace(string(out))
+}
+
+func TestGit_HistoryAndRewrite(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGit(dir)
+	require.NoError(t, g.Init())
+
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		commitAt(t, g, strings.Repeat("x", i+1), base.Add(time.Duration(i)*time.Hour))
+	}
+	hashes := strings.Fields(gitOutput(t, dir, "rev-list", "--reverse", "HEAD"))
+	require.Len(t, hashes, 5)
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		require.NoError(t, cmd.Run())
+	}
+	run("tag", "light", hashes[1])
+	run("tag", "-a", "-m", "keep me", "annotated", hashes[2])
+
+	commits, err := g.History()
+	require.NoError(t, err)
+	require.Len(t, commits, 5)
+	assert.Equal(t, hashes[0], commits[0].Hash)
+	assert.True(t, commits[0].Time.Equal(base))
+	assert.Equal(t, "Backup 2024-01-15 10:00", commits[0].Subject)
+	assert.Equal(t, []string{"light"}, commits[1].Tags)
+	assert.Equal(t, []string{"annotated"}, commits[2].Tags)
+
+	keep := []Commit{commits[1], commits[2], commits[4]}
+	var trees []string
+	for _, c := range keep {
+		trees = append(trees, gitOutput(t, dir, "rev-parse", c.Hash+"^{tree}"))
+	}
+	require.NoError(t, g.RewriteHistory(keep))
+	require.NoError(t, g.GC())
+
+	rewritten, err := g.History()
+	require.NoError(t, err)
+	require.Len(t, rewritten, 3)
+	for i, c := range rewritten {
+		assert.True(t, c.Time.Equal(keep[i].Time))
+		assert.Equal(t, keep[i].Subject, c.Subject)
+		assert.Equal(t, keep[i].Tags, c.Tags)
+		assert.Equal(t, trees[i], gitOutput(t, dir, "rev-parse", c.Hash+"^{tree}"))
+	}
+	assert.Equal(t, "keep me", gitOutput(t, dir, "tag", "-l", "--format=%(contents:subject)", "annotated"))
+
+	// Dropped commits are gone after gc
+	cmd := exec.Command("git", "cat-file", "-e", hashes[3])
+	cmd.Dir = dir
+	assert.Error(t, cmd.Run())
+
+	// The working tree is still clean
+	changed, err := g.HasChanges()
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestGit_RewriteHistoryKeepsHead(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGit(dir)
+	require.NoError(t, g.Init())
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	commitAt(t, g, "a", base)
+	commitAt(t, g, "b", base.Add(time.Hour))
+
+	commits, err := g.History()
+	require.NoError(t, err)
+	assert.ErrorContains(t, g.RewriteHistory(commits[:1]), "must be kept")
+}
+
+func TestGit_RewriteHistoryIsAtomic(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGit(dir)
+	require.NoError(t, g.Init())
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		commitAt(t, g, strings.Repeat("x", i+1), base.Add(time.Duration(i)*time.Hour))
+	}
+	hashes := strings.Fields(gitOutput(t, dir, "rev-list", "--reverse", "HEAD"))
+	cmd := exec.Command("git", "tag", "keep", hashes[0])
+	cmd.Dir = dir
+	require.NoError(t, cmd.Run())
+
+	// A locked tag fails the update, and the branch must not move either
+	lock := filepath.Join(dir, ".git", "refs", "tags", "keep.lock")
+	require.NoError(t, os.WriteFile(lock, nil, 0644))
+	commits, err := g.History()
+	require.NoError(t, err)
+	assert.ErrorContains(t, g.RewriteHistory([]Commit{commits[0], commits[2]}), "update refs")
+	assert.Equal(t, hashes[2], gitOutput(t, dir, "rev-parse", "HEAD"))
+	assert.Equal(t, hashes[0], gitOutput(t, dir, "rev-parse", "keep"))
+
+	require.NoError(t, os.Remove(lock))
+	require.NoError(t, g.RewriteHistory([]Commit{commits[0], commits[2]}))
+	rewritten, err := g.History()
+	require.NoError(t, err)
+	require.Len(t, rewritten, 2)
+	assert.Equal(t, []string{"keep"}, rewritten[0].Tags)
+}
+
+func TestGit_ResolveCommitAndCommitBefore(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGit(dir)
+	require.NoError(t, g.Init())
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	commitAt(t, g, "a", base)
+	commitAt(t, g, "b", base.Add(2*time.Hour))
+	hashes := strings.Fields(gitOutput(t, dir, "rev-list", "--reverse", "HEAD"))
+	gitOutput(t, dir, "tag", "-a", "-m", "first", "v1", hashes[0])
+
+	c, err := g.ResolveCommit("v1")
+	require.NoError(t, err)
+	assert.Equal(t, hashes[0], c.Hash)
+	assert.True(t, c.Time.Equal(base))
+	assert.Equal(t, "Backup 2024-01-15 10:00", c.Subject)
+
+	c, err = g.CommitBefore(base.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, hashes[0], c.Hash)
+
+	c, err = g.CommitBefore(base.Add(2 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, hashes[1], c.Hash)
+
+	_, err = g.CommitBefore(base.Add(-time.Hour))
+	assert.ErrorContains(t, err, "no backup at or before")
+	_, err = g.ResolveCommit("no-such-rev")
+	assert.Error(t, err)
+}
+
+func TestGit_Changes(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGit(dir)
+	require.NoError(t, g.Init())
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	write("a.jsonl", "a")
+	write("p/b.jsonl", "bb")
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("first"))
+
+	changes, err := g.Changes("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Path: "a.jsonl", Status: Added, NewSize: 1},
+		{Path: "p/b.jsonl", Status: Added, NewSize: 2},
+	}, changes)
+
+	write("a.jsonl", "aaa")
+	require.NoError(t, os.Remove(filepath.Join(dir, "p", "b.jsonl")))
+	write("c.jsonl", "c")
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("second"))
+
+	changes, err = g.Changes("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Path: "a.jsonl", Status: Modified, OldSize: 1, NewSize: 3},
+		{Path: "c.jsonl", Status: Added, NewSize: 1},
+		{Path: "p/b.jsonl", Status: Deleted, OldSize: 2},
+	}, changes)
+}
+
+func TestGit_Blobs(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGit(dir)
+	require.NoError(t, g.Init())
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "projects", "p"), 0755))
+	for _, name := range []string{"a.jsonl", "b.jsonl"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "projects", "p", name), []byte(name), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "history.jsonl"), []byte("h"), 0644))
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("first"))
+	require.NoError(t, os.Remove(filepath.Join(dir, "projects", "p", "a.jsonl")))
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("second"))
+
+	head, err := g.TreeBlobs("HEAD", "projects")
+	require.NoError(t, err)
+	require.Len(t, head, 1)
+	assert.Equal(t, "projects/p/b.jsonl", head[0].Path)
+
+	deleted, err := g.DeletedBlobs("projects")
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "projects/p/a.jsonl", deleted[0].Path)
+
+	r, err := g.OpenBlob(deleted[0])
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "a.jsonl", string(data))
+}
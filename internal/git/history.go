@@ -0,0 +1,281 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit is a commit on the backup branch.
+type Commit struct {
+	Hash    string
+	Time    time.Time
+	Subject string
+	// Tags are the names of tags pointing at the commit.
+	Tags []string
+}
+
+// ShortHash returns the abbreviated commit hash.
+func (c Commit) ShortHash() string {
+	if len(c.Hash) < 7 {
+		return c.Hash
+	}
+	return c.Hash[:7]
+}
+
+// History returns the commits reachable from HEAD, oldest first.
+// It fails if the history contains merges, since backups are linear.
+func (g *Git) History() ([]Commit, error) {
+	merges, err := g.output("rev-list", "--min-parents=2", "--max-count=1", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(merges)) > 0 {
+		return nil, fmt.Errorf("history is not linear: %s is a merge", strings.TrimSpace(string(merges)))
+	}
+
+	tags, err := g.tagsByCommit()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := g.output("log", "--reverse", "-z", commitFormat, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, rec := range strings.Split(string(out), "\x00") {
+		rec = strings.TrimPrefix(rec, "\n")
+		if rec == "" {
+			continue
+		}
+		c, err := parseCommit(rec)
+		if err != nil {
+			return nil, err
+		}
+		c.Tags = tags[c.Hash]
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// commitFormat is the git log format parsed by parseCommit.
+const commitFormat = "--format=%H%x1f%ct%x1f%s"
+
+// parseCommit parses one record written with commitFormat.
+func parseCommit(rec string) (Commit, error) {
+	fields := strings.SplitN(strings.TrimSpace(rec), "\x1f", 3)
+	if len(fields) != 3 {
+		return Commit{}, fmt.Errorf("unexpected git log output %q", rec)
+	}
+	secs, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return Commit{}, fmt.Errorf("parse commit time: %w", err)
+	}
+	return Commit{Hash: fields[0], Time: time.Unix(secs, 0), Subject: fields[2]}, nil
+}
+
+// ResolveCommit returns the commit named by rev, such as a hash or tag.
+func (g *Git) ResolveCommit(rev string) (Commit, error) {
+	out, err := g.output("log", "-1", commitFormat, "--end-of-options", rev+"^{commit}", "--")
+	if err != nil {
+		return Commit{}, fmt.Errorf("resolve %s: %w", rev, err)
+	}
+	return parseCommit(string(out))
+}
+
+// CommitBefore returns the newest commit on HEAD made at or before t.
+func (g *Git) CommitBefore(t time.Time) (Commit, error) {
+	out, err := g.output("log", "-1", commitFormat, "--before="+t.Format(time.RFC3339), "HEAD", "--")
+	if err != nil {
+		return Commit{}, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return Commit{}, fmt.Errorf("no backup at or before %s", t.Format("2006-01-02 15:04"))
+	}
+	return parseCommit(string(out))
+}
+
+// tagsByCommit maps commit hashes to the tags that point at them.
+func (g *Git) tagsByCommit() (map[string][]string, error) {
+	out, err := g.output("for-each-ref", "--format=%(objectname) %(*objectname) %(refname:short)", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 2: // lightweight: <commit> <name>
+			tags[fields[0]] = append(tags[fields[0]], fields[1])
+		case 3: // annotated: <tag> <commit> <name>
+			tags[fields[1]] = append(tags[fields[1]], fields[2])
+		}
+	}
+	return tags, nil
+}
+
+// RewriteHistory replaces the current branch with a linear history of only
+// the kept commits, oldest first. Each kept commit keeps its own tree,
+// author, committer and message, so it still records the same snapshot.
+// The newest commit must be kept, which leaves the working tree unchanged.
+// Tags on kept commits are moved to the rewritten commits.
+func (g *Git) RewriteHistory(keep []Commit) error {
+	if len(keep) == 0 {
+		return fmt.Errorf("no commits to keep")
+	}
+	if g.DryRun {
+		return nil
+	}
+
+	head, err := g.output("rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	oldHead := strings.TrimSpace(string(head))
+	if keep[len(keep)-1].Hash != oldHead {
+		return fmt.Errorf("the newest commit %s must be kept", oldHead)
+	}
+	branch, err := g.output("symbolic-ref", "-q", "HEAD")
+	if err != nil {
+		return fmt.Errorf("HEAD is not on a branch: %w", err)
+	}
+
+	rewritten := map[string]string{}
+	parent := ""
+	for _, c := range keep {
+		hash, err := g.recommit(c.Hash, parent)
+		if err != nil {
+			return fmt.Errorf("rewrite %s: %w", c.ShortHash(), err)
+		}
+		rewritten[c.Hash] = hash
+		parent = hash
+	}
+
+	// Move the branch and the tags in one transaction, so a failure
+	// leaves no tag on the old history
+	var updates strings.Builder
+	fmt.Fprintf(&updates, "update %s %s %s\n", strings.TrimSpace(string(branch)), parent, oldHead)
+	for _, c := range keep {
+		for _, tag := range c.Tags {
+			ref := "refs/tags/" + tag
+			old, err := g.output("rev-parse", ref)
+			if err != nil {
+				return fmt.Errorf("move tag %s: %w", tag, err)
+			}
+			target, err := g.retag(ref, rewritten[c.Hash])
+			if err != nil {
+				return fmt.Errorf("move tag %s: %w", tag, err)
+			}
+			fmt.Fprintf(&updates, "update %s %s %s\n", ref, target, strings.TrimSpace(string(old)))
+		}
+	}
+	if _, err := g.input(updates.String(), "update-ref", "-m", "ccbackup prune-history", "--stdin"); err != nil {
+		return fmt.Errorf("update refs: %w", err)
+	}
+	return nil
+}
+
+// recommit writes a copy of commit with a new parent and returns its hash.
+// Headers other than tree, author and committer, such as signatures, are dropped.
+func (g *Git) recommit(hash, parent string) (string, error) {
+	raw, err := g.output("cat-file", "commit", hash)
+	if err != nil {
+		return "", err
+	}
+	header, message, _ := strings.Cut(string(raw), "\n\n")
+
+	var b strings.Builder
+	for _, line := range strings.Split(header, "\n") {
+		switch {
+		case strings.HasPrefix(line, "tree "):
+			b.WriteString(line + "\n")
+			if parent != "" {
+				b.WriteString("parent " + parent + "\n")
+			}
+		case strings.HasPrefix(line, "author "), strings.HasPrefix(line, "committer "):
+			b.WriteString(line + "\n")
+		}
+	}
+	b.WriteString("\n" + message)
+	return g.hashObject("commit", b.String())
+}
+
+// retag returns the object the tag ref should point at to tag commit:
+// commit itself, or for an annotated tag a copy of the tag object with
+// its original message and tagger.
+func (g *Git) retag(ref, commit string) (string, error) {
+	kind, err := g.output("cat-file", "-t", ref)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(string(kind)) != "tag" {
+		return commit, nil
+	}
+
+	raw, err := g.output("cat-file", "tag", ref)
+	if err != nil {
+		return "", err
+	}
+	header, message, _ := strings.Cut(string(raw), "\n\n")
+	var b strings.Builder
+	b.WriteString("object " + commit + "\ntype commit\n")
+	for _, line := range strings.Split(header, "\n") {
+		if strings.HasPrefix(line, "tag ") || strings.HasPrefix(line, "tagger ") {
+			b.WriteString(line + "\n")
+		}
+	}
+	b.WriteString("\n" + message)
+	return g.hashObject("tag", b.String())
+}
+
+// hashObject writes a raw object of the given type and returns its hash.
+func (g *Git) hashObject(kind, content string) (string, error) {
+	out, err := g.input(content, "hash-object", "-t", kind, "-w", "--stdin")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// input runs a git command with stdin and returns its standard output.
+func (g *Git) input(stdin string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.Dir
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// GC expires the reflog and collects unreachable objects, so commits
+// dropped by RewriteHistory are removed from disk.
+func (g *Git) GC() error {
+	if g.DryRun {
+		return nil
+	}
+	if err := g.run("reflog", "expire", "--expire=now", "--all"); err != nil {
+		return err
+	}
+	return g.run("gc", "--prune=now", "--quiet")
+}
+
+// output runs a git command and returns its standard output.
+func (g *Git) output(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -3,6 +3,7 @@ package git
 import (
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
@@ -33,6 +34,24 @@ func (l *LFS) Track(pattern string) error {
 	return l.run("track", pattern)
 }
 
+// Available reports whether git-lfs is installed.
+func (l *LFS) Available() bool {
+	return exec.Command("git", "lfs", "version").Run() == nil
+}
+
+// Fsck checks that the LFS objects referenced by HEAD are present and intact.
+func (l *LFS) Fsck() error {
+	return l.run("fsck")
+}
+
+// Prune deletes local LFS objects that are no longer referenced.
+func (l *LFS) Prune() error {
+	if l.DryRun {
+		return nil
+	}
+	return l.run("prune")
+}
+
 // run executes a git-lfs command.
 func (l *LFS) run(args ...string) error {
 	lfsArgs := append([]string{"lfs"}, args...)
@@ -44,3 +63,40 @@ func (l *LFS) run(args ...string) error {
 	}
 	return nil
 }
+
+// maxPointerSize bounds the size of a Git LFS pointer file.
+const maxPointerSize = 1024
+
+// lfsPointer is the object a Git LFS pointer file stands for.
+type lfsPointer struct {
+	OID  string
+	Size int64
+}
+
+// parsePointer parses a Git LFS pointer file.
+func parsePointer(data []byte) (lfsPointer, bool) {
+	var p lfsPointer
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) < 3 || lines[0] != "version https://git-lfs.github.com/spec/v1" {
+		return p, false
+	}
+	hasSize := false
+	for _, line := range lines[1:] {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok || len(oid) != 64 || strings.Trim(oid, "0123456789abcdef") != "" {
+				return p, false
+			}
+			p.OID = oid
+		case "size":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return p, false
+			}
+			p.Size, hasSize = n, true
+		}
+	}
+	return p, p.OID != "" && hasSize
+}
@@ -0,0 +1,249 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/storage"
+)
+
+// errReadOnly is returned by TreeFS write operations.
+var errReadOnly = errors.New("git revision is read-only")
+
+// TreeFS is a read-only file system over the tree of one commit.
+// Names are slash-separated paths relative to the repository root.
+// Every file reports the commit time as its modification time.
+// Git LFS pointers are resolved from the local LFS store, so files
+// report and read their real content.
+type TreeFS struct {
+	Dir string
+	Rev string
+
+	tree    *storage.Tree
+	modTime time.Time
+	blobs   map[string]string
+	lfs     map[string]lfsPointer
+	lfsDir  string
+}
+
+// NewTreeFS loads the tree of rev in the repository at dir.
+func NewTreeFS(dir, rev string) (*TreeFS, error) {
+	t := &TreeFS{Dir: dir, Rev: rev, tree: storage.NewTree(), blobs: map[string]string{}, lfs: map[string]lfsPointer{}}
+
+	out, err := t.output("show", "-s", "--format=%ct", rev+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", rev, err)
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", rev, err)
+	}
+	t.modTime = time.Unix(secs, 0)
+	t.tree.DirModTime = t.modTime
+
+	out, err = t.output("ls-tree", "-r", "-l", "-z", "--full-tree", rev)
+	if err != nil {
+		return nil, fmt.Errorf("ls-tree %s: %w", rev, err)
+	}
+	// Blobs small enough to be LFS pointers, by object
+	small := map[string][]string{}
+	for _, line := range strings.Split(string(out), "\x00") {
+		if line == "" {
+			continue
+		}
+		// <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] != "blob" {
+			continue
+		}
+		mode := fs.FileMode(0644)
+		if fields[0] == "100755" {
+			mode = 0755
+		}
+		size, _ := strconv.ParseInt(fields[3], 10, 64)
+		t.tree.Add(name, storage.TreeFile{Size: size, Mode: mode, ModTime: t.modTime})
+		t.blobs[storage.CleanName(name)] = fields[2]
+		if size <= maxPointerSize {
+			small[fields[2]] = append(small[fields[2]], name)
+		}
+	}
+	if err := t.resolvePointers(small); err != nil {
+		return nil, fmt.Errorf("read LFS pointers of %s: %w", rev, err)
+	}
+	return t, nil
+}
+
+// resolvePointers records the LFS pointers among the blobs and reports the
+// size of the files they point to.
+func (t *TreeFS) resolvePointers(blobs map[string][]string) error {
+	if len(blobs) == 0 {
+		return nil
+	}
+	var in bytes.Buffer
+	for obj := range blobs {
+		fmt.Fprintln(&in, obj)
+	}
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = t.Dir
+	cmd.Stdin = &in
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("cat-file: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// <object> SP <type> SP <size> LF <contents> LF
+	r := bufio.NewReader(bytes.NewReader(out))
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fmt.Errorf("cat-file: unexpected output %q", header)
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("cat-file: unexpected output %q", header)
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		p, ok := parsePointer(data[:size])
+		if !ok {
+			continue
+		}
+		for _, name := range blobs[fields[0]] {
+			f, _ := t.tree.File(name)
+			f.Size = p.Size
+			t.tree.Add(name, f)
+			t.lfs[storage.CleanName(name)] = p
+		}
+	}
+
+	if len(t.lfs) > 0 {
+		out, err := t.output("rev-parse", "--git-path", "lfs/objects")
+		if err != nil {
+			return err
+		}
+		t.lfsDir = strings.TrimSpace(string(out))
+		if !filepath.IsAbs(t.lfsDir) {
+			t.lfsDir = filepath.Join(t.Dir, t.lfsDir)
+		}
+	}
+	return nil
+}
+
+// ModTime returns the commit time of the revision.
+func (t *TreeFS) ModTime() time.Time {
+	return t.modTime
+}
+
+// Open streams a blob, or for an LFS pointer the object it points to.
+func (t *TreeFS) Open(name string) (io.ReadCloser, error) {
+	if _, ok := t.tree.File(name); !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	clean := storage.CleanName(name)
+	if p, ok := t.lfs[clean]; ok {
+		f, err := os.Open(filepath.Join(t.lfsDir, p.OID[0:2], p.OID[2:4], p.OID))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: LFS object %s is not in the local store, run 'git lfs fetch'", name, p.OID)
+		}
+		return f, err
+	}
+	return catFile(t.Dir, "blob", t.Rev+":"+clean)
+}
+
+// catFile streams the output of git cat-file with args.
+func catFile(dir string, args ...string) (io.ReadCloser, error) {
+	cmd := exec.Command("git", append([]string{"cat-file"}, args...)...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &blobReader{ReadCloser: stdout, cmd: cmd, stderr: &stderr}, nil
+}
+
+// Stat returns metadata for a file or directory in the tree.
+func (t *TreeFS) Stat(name string) (fs.FileInfo, error) {
+	return t.tree.Stat(name)
+}
+
+// ContentHash returns the id of a file's blob, which for an LFS file is
+// the blob of its pointer. Equal ids mean equal contents.
+func (t *TreeFS) ContentHash(name string) (algo, sum string, err error) {
+	id, ok := t.blobs[storage.CleanName(name)]
+	if !ok {
+		return "", "", &fs.PathError{Op: "hash", Path: name, Err: fs.ErrNotExist}
+	}
+	return "git", id, nil
+}
+
+// Walk visits the tree under root in lexical order.
+func (t *TreeFS) Walk(root string, fn filepath.WalkFunc) error {
+	return t.tree.Walk(root, fn)
+}
+
+// WriteFile always fails; a commit cannot be modified.
+func (t *TreeFS) WriteFile(name string, r io.Reader, perm fs.FileMode, modTime time.Time) error {
+	return &fs.PathError{Op: "write", Path: name, Err: errReadOnly}
+}
+
+// Remove always fails; a commit cannot be modified.
+func (t *TreeFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: errReadOnly}
+}
+
+func (t *TreeFS) output(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = t.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// blobReader waits for git to exit when the blob has been read.
+type blobReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (b *blobReader) Close() error {
+	io.Copy(io.Discard, b.ReadCloser)
+	if err := b.cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(b.stderr.String()))
+	}
+	return nil
+}
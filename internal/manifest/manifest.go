@@ -0,0 +1,280 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+// Version is the manifest format version written by this build.
+const Version = 1
+
+// Path is where a backup stores its manifest, relative to the backup root.
+const Path = ".ccbackup/manifest.json"
+
+// Entry describes one backed-up file.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"mtime"`
+	// Mode is the octal permission bits of the source file, e.g. "0644".
+	Mode string `json:"mode,omitempty"`
+	// SourceSize is the size of the source file when the backed-up
+	// contents, such as a redacted copy, have another size.
+	SourceSize *int64 `json:"source_size,omitempty"`
+}
+
+// FileMode parses Mode, defaulting to 0644.
+func (e Entry) FileMode() fs.FileMode {
+	m, err := strconv.ParseUint(e.Mode, 8, 32)
+	if err != nil || m == 0 {
+		return 0644
+	}
+	return fs.FileMode(m).Perm()
+}
+
+// FormatMode formats permission bits for Entry.Mode.
+func FormatMode(mode fs.FileMode) string {
+	return fmt.Sprintf("%04o", uint32(mode.Perm()))
+}
+
+// Warning records a file that could not be backed up.
+type Warning struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Manifest records the state of a backup at one point in time.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []Entry   `json:"files"`
+	Warnings  []Warning `json:"warnings,omitempty"`
+
+	index map[string]int
+}
+
+// Build walks root in fsys and records every file accepted by filter.
+// Stored hashes are used when fsys provides them. Entries of prev, if not nil,
+// are reused for files whose size and modification time are unchanged,
+// and keep their recorded metadata for files whose content is unchanged.
+func Build(fsys storage.FS, root string, filter *sync.Filter, prev *Manifest) (*Manifest, error) {
+	listed, err := sync.List(fsys, root, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(listed.Warnings) > 0 {
+		w := listed.Warnings[0]
+		return nil, fmt.Errorf("%s: %w", w.RelPath, w.Err)
+	}
+
+	m := &Manifest{Version: Version, CreatedAt: time.Now().UTC()}
+	for _, item := range listed.Items {
+		rel := filepath.ToSlash(item.RelPath)
+		old, hasOld := prev.Lookup(rel)
+		if hasOld && old.Size == item.Size && old.ModTime.Equal(item.ModTime) {
+			m.Files = append(m.Files, old)
+			continue
+		}
+
+		sum, err := fileSHA256(fsys, item.SrcPath)
+		if err != nil {
+			return nil, fmt.Errorf("hash %s: %w", item.RelPath, err)
+		}
+		e := Entry{
+			Path:    rel,
+			Size:    item.Size,
+			SHA256:  sum,
+			ModTime: item.ModTime.UTC(),
+			Mode:    FormatMode(item.Mode),
+		}
+		if hasOld && old.SHA256 == sum {
+			// Same content with new metadata, e.g. after a fresh clone
+			e.ModTime, e.Mode = old.ModTime, old.Mode
+		}
+		m.Files = append(m.Files, e)
+	}
+
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return m, nil
+}
+
+// Lookup returns the entry for a slash-separated path.
+// It is safe to call on a nil manifest.
+func (m *Manifest) Lookup(path string) (Entry, bool) {
+	if m == nil {
+		return Entry{}, false
+	}
+	if m.index == nil {
+		m.index = make(map[string]int, len(m.Files))
+		for i, e := range m.Files {
+			m.index[e.Path] = i
+		}
+	}
+	i, ok := m.index[path]
+	if !ok {
+		return Entry{}, false
+	}
+	return m.Files[i], true
+}
+
+// Sub returns the entries and warnings below a slash-separated directory,
+// with paths relative to it. It is safe to call on a nil manifest.
+func (m *Manifest) Sub(dir string) *Manifest {
+	if m == nil {
+		return nil
+	}
+	sub := &Manifest{Version: m.Version, CreatedAt: m.CreatedAt}
+	for _, e := range m.Files {
+		if rest, ok := strings.CutPrefix(e.Path, dir+"/"); ok {
+			e.Path = rest
+			sub.Files = append(sub.Files, e)
+		}
+	}
+	for _, w := range m.Warnings {
+		if rest, ok := strings.CutPrefix(w.Path, dir+"/"); ok {
+			w.Path = rest
+			sub.Warnings = append(sub.Warnings, w)
+		}
+	}
+	return sub
+}
+
+// Merge adds the entries and warnings of other below a slash-separated directory.
+func (m *Manifest) Merge(dir string, other *Manifest) {
+	for _, e := range other.Files {
+		e.Path = path.Join(dir, e.Path)
+		m.Files = append(m.Files, e)
+	}
+	for _, w := range other.Warnings {
+		w.Path = path.Join(dir, w.Path)
+		m.Warnings = append(m.Warnings, w)
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	m.index = nil
+}
+
+// UseSource replaces the modification time and mode of every entry with
+// those of the source file it was copied from, which git does not preserve.
+// Paths in skip, such as files that failed to copy, are left unchanged.
+func (m *Manifest) UseSource(items []sync.SyncItem, skip []sync.SyncError) {
+	skipped := make(map[string]bool, len(skip))
+	for _, e := range skip {
+		skipped[filepath.ToSlash(e.RelPath)] = true
+	}
+	for _, item := range items {
+		rel := filepath.ToSlash(item.RelPath)
+		if _, ok := m.Lookup(rel); !ok || skipped[rel] {
+			continue
+		}
+		e := &m.Files[m.index[rel]]
+		e.ModTime = item.ModTime.UTC()
+		e.Mode = FormatMode(item.Mode)
+		e.SourceSize = nil
+		if item.Size != e.Size {
+			size := item.Size
+			e.SourceSize = &size
+		}
+	}
+}
+
+// AddWarnings records per-file errors of a backup run.
+func (m *Manifest) AddWarnings(errs []sync.SyncError) {
+	for _, e := range errs {
+		m.Warnings = append(m.Warnings, Warning{Path: filepath.ToSlash(e.RelPath), Message: e.Err.Error()})
+	}
+}
+
+// Metadata returns the recorded mode and modification time of a file,
+// if the manifest lists it with the given size. It matches sync.Syncer.Metadata.
+func (m *Manifest) Metadata(relPath string, size int64) (fs.FileMode, time.Time, bool) {
+	e, ok := m.Lookup(filepath.ToSlash(relPath))
+	if !ok || e.Size != size {
+		return 0, time.Time{}, false
+	}
+	return e.FileMode(), e.ModTime, true
+}
+
+// Recorded returns the size and modification time of the source a file
+// was copied from, if the manifest lists it with the given size and the
+// copy, such as a redacted one, differs in size from its source.
+// It matches sync.Syncer.Recorded and is safe to call on a nil manifest.
+func (m *Manifest) Recorded(relPath string, size int64) (sync.FileInfo, bool) {
+	e, ok := m.Lookup(filepath.ToSlash(relPath))
+	if !ok || e.Size != size || e.SourceSize == nil {
+		return sync.FileInfo{}, false
+	}
+	return sync.FileInfo{Size: *e.SourceSize, ModTime: e.ModTime}, true
+}
+
+// Write stores the manifest as indented JSON.
+func (m *Manifest) Write(fsys storage.FS, name string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	return fsys.WriteFile(name, bytes.NewReader(data), 0644, m.CreatedAt)
+}
+
+// Read loads a manifest.
+func Read(fsys storage.FS, name string) (*Manifest, error) {
+	data, err := storage.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return &m, nil
+}
+
+// SnapshotName returns the name of a snapshot manifest under dir for time t.
+func SnapshotName(dir string, t time.Time) string {
+	return filepath.Join(dir, ".ccbackup", "snapshots", t.UTC().Format("20060102T150405Z")+".json")
+}
+
+// Latest reads the newest snapshot manifest under dir, or returns an error
+// satisfying errors.Is(err, fs.ErrNotExist) if there is none.
+func Latest(fsys storage.FS, dir string) (*Manifest, error) {
+	var latest string
+	err := fsys.Walk(filepath.Dir(SnapshotName(dir, time.Time{})), func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Names sort by the time they were written
+		if !info.IsDir() && strings.HasSuffix(path, ".json") && path > latest {
+			latest = path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest == "" {
+		return nil, fs.ErrNotExist
+	}
+	return Read(fsys, latest)
+}
+
+// fileSHA256 returns the stored SHA-256 of a file or computes it.
+func fileSHA256(fsys storage.FS, name string) (string, error) {
+	if hasher, ok := fsys.(storage.Hasher); ok {
+		if algo, sum, err := hasher.ContentHash(name); err == nil && algo == "sha256" && sum != "" {
+			return sum, nil
+		}
+	}
+	return storage.HashFile(fsys, name, "sha256")
+}
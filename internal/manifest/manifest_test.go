@@ -0,0 +1,139 @@
+package manifest
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+func TestBuildWriteRead(t *testing.T) {
+	fsys := storage.NewMemFS()
+	modTime := time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
+
+	for name, content := range map[string]string{
+		"/backup/history.jsonl":          "hello",
+		"/backup/projects/p/s.jsonl":     "world",
+		"/backup/debug/ignored.txt":      "x",
+		"/backup/.ccbackup/old.json":     "{}",
+		"/backup/projects/p/.DS_Store":   "junk",
+		"/backup/projects/p/sub/t.jsonl": "",
+	} {
+		require.NoError(t, fsys.WriteFile(name, strings.NewReader(content), 0644, modTime))
+	}
+
+	m, err := Build(fsys, "/backup", sync.NewFilter([]string{"projects", "history.jsonl"}), nil)
+	require.NoError(t, err)
+
+	require.Len(t, m.Files, 3)
+	assert.Equal(t, "history.jsonl", m.Files[0].Path)
+	assert.Equal(t, "projects/p/s.jsonl", m.Files[1].Path)
+	assert.Equal(t, "projects/p/sub/t.jsonl", m.Files[2].Path)
+	assert.Equal(t, int64(5), m.Files[0].Size)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", m.Files[0].SHA256)
+	assert.True(t, m.Files[0].ModTime.Equal(modTime))
+
+	name := SnapshotName("/backup", m.CreatedAt)
+	assert.Equal(t, filepath.Join("/backup", ".ccbackup", "snapshots"), filepath.Dir(name))
+	require.NoError(t, m.Write(fsys, name))
+
+	read, err := Read(fsys, name)
+	require.NoError(t, err)
+	assert.Equal(t, Version, read.Version)
+	assert.Equal(t, m.Files, read.Files)
+}
+
+func TestBuild_Prev(t *testing.T) {
+	fsys := storage.NewMemFS()
+	cloned := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	original := time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
+	require.NoError(t, fsys.WriteFile("/backup/a.jsonl", strings.NewReader("hello"), 0644, original))
+	require.NoError(t, fsys.WriteFile("/backup/b.jsonl", strings.NewReader("hello"), 0644, cloned))
+	require.NoError(t, fsys.WriteFile("/backup/c.jsonl", strings.NewReader("changed"), 0644, cloned))
+
+	prev := &Manifest{Files: []Entry{
+		// Same size and mtime: reused without hashing
+		{Path: "a.jsonl", Size: 5, SHA256: "stale", ModTime: original, Mode: "0600"},
+		// Same content after a fresh clone: keeps the recorded metadata
+		{Path: "b.jsonl", Size: 5, SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", ModTime: original, Mode: "0600"},
+		// Changed content: recorded anew
+		{Path: "c.jsonl", Size: 5, SHA256: "old", ModTime: original, Mode: "0600"},
+	}}
+
+	m, err := Build(fsys, "/backup", sync.NewFilter([]string{"*.jsonl"}), prev)
+	require.NoError(t, err)
+	require.Len(t, m.Files, 3)
+
+	assert.Equal(t, "stale", m.Files[0].SHA256)
+	assert.True(t, m.Files[1].ModTime.Equal(original))
+	assert.Equal(t, "0600", m.Files[1].Mode)
+	assert.True(t, m.Files[2].ModTime.Equal(cloned))
+	assert.Equal(t, "0644", m.Files[2].Mode)
+}
+
+func TestManifest_UseSourceAndMetadata(t *testing.T) {
+	backupTime := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	sourceTime := time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
+	m := &Manifest{Files: []Entry{
+		{Path: "history.jsonl", Size: 5, ModTime: backupTime, Mode: "0644"},
+		{Path: "projects/p/s.jsonl", Size: 3, ModTime: backupTime, Mode: "0644"},
+	}}
+
+	m.UseSource([]sync.SyncItem{
+		{RelPath: "history.jsonl", ModTime: sourceTime, Mode: 0600},
+		{RelPath: filepath.Join("projects", "p", "s.jsonl"), ModTime: sourceTime, Mode: 0600},
+		{RelPath: "missing.jsonl", ModTime: sourceTime, Mode: 0600},
+	}, []sync.SyncError{{RelPath: filepath.Join("projects", "p", "s.jsonl"), Err: errors.New("permission denied")}})
+	m.AddWarnings([]sync.SyncError{{RelPath: filepath.Join("projects", "p", "s.jsonl"), Err: errors.New("permission denied")}})
+
+	mode, modTime, ok := m.Metadata("history.jsonl", 5)
+	require.True(t, ok)
+	assert.Equal(t, "0600", m.Files[0].Mode)
+	assert.Equal(t, 0600, int(mode))
+	assert.True(t, modTime.Equal(sourceTime))
+
+	_, modTime, ok = m.Metadata(filepath.Join("projects", "p", "s.jsonl"), 3)
+	require.True(t, ok)
+	assert.True(t, modTime.Equal(backupTime), "failed copies keep their metadata")
+
+	_, _, ok = m.Metadata("history.jsonl", 6)
+	assert.False(t, ok, "size mismatch")
+
+	assert.Equal(t, []Warning{{Path: "projects/p/s.jsonl", Message: "permission denied"}}, m.Warnings)
+
+	var nilManifest *Manifest
+	_, ok = nilManifest.Lookup("history.jsonl")
+	assert.False(t, ok)
+}
+
+func TestManifest_SubAndMerge(t *testing.T) {
+	m := &Manifest{Files: []Entry{
+		{Path: "history.jsonl", Size: 5},
+		{Path: "projects/p/s.jsonl", Size: 3},
+	}}
+	home := &Manifest{
+		Files:    []Entry{{Path: ".claude.json", Size: 7}},
+		Warnings: []Warning{{Path: ".claude.json.bak", Message: "permission denied"}},
+	}
+
+	m.Merge("home", home)
+	require.Len(t, m.Files, 3)
+	assert.Equal(t, "home/.claude.json", m.Files[1].Path)
+	_, ok := m.Lookup("home/.claude.json")
+	assert.True(t, ok)
+	assert.Equal(t, []Warning{{Path: "home/.claude.json.bak", Message: "permission denied"}}, m.Warnings)
+
+	sub := m.Sub("home")
+	assert.Equal(t, home.Files, sub.Files)
+	assert.Equal(t, home.Warnings, sub.Warnings)
+	assert.Empty(t, m.Sub("proj").Files)
+
+	var nilManifest *Manifest
+	assert.Nil(t, nilManifest.Sub("home"))
+}
@@ -0,0 +1,94 @@
+// Package profile describes the data directories of AI coding CLIs that
+// ccbackup knows how to back up.
+package profile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transcript formats.
+const (
+	// FormatClaudeCode is one JSON object per message, in projects/<project>/<session>.jsonl.
+	FormatClaudeCode = "claude-code-jsonl"
+	// FormatCodex is one JSON event per line, in sessions/YYYY/MM/DD/rollout-*.jsonl.
+	FormatCodex = "codex-jsonl"
+	// FormatGeminiCLI is one JSON document per checkpoint, in tmp/<project hash>/chats/.
+	FormatGeminiCLI = "gemini-cli-json"
+)
+
+// Profile is the layout of one CLI's data directory.
+type Profile struct {
+	Name string
+	// Root is the default data directory; ~ is the home directory.
+	Root string
+	// Include lists the patterns worth backing up. Credentials are left out.
+	Include []string
+	// Transcripts lists the patterns of Include that hold session transcripts,
+	// and Format is how they are written. Both are descriptive only: search,
+	// diff, usage and export-session read the Claude Code transcripts of
+	// source_dir, not those of other profiles.
+	Transcripts []string
+	Format      string
+}
+
+// Profile names.
+const (
+	ClaudeCode = "claude-code"
+	Codex      = "codex"
+	GeminiCLI  = "gemini-cli"
+)
+
+var profiles = []Profile{
+	{
+		Name:        ClaudeCode,
+		Root:        "~/.claude",
+		Include:     []string{"projects", "history.jsonl", "plans", "todos", "usage-data", "stats-cache.json"},
+		Transcripts: []string{"projects"},
+		Format:      FormatClaudeCode,
+	},
+	{
+		Name:        Codex,
+		Root:        "~/.codex",
+		Include:     []string{"sessions", "history.jsonl", "AGENTS.md", "prompts"},
+		Transcripts: []string{"sessions"},
+		Format:      FormatCodex,
+	},
+	{
+		Name:        GeminiCLI,
+		Root:        "~/.gemini",
+		Include:     []string{"tmp", "GEMINI.md", "commands"},
+		Transcripts: []string{"tmp"},
+		Format:      FormatGeminiCLI,
+	},
+}
+
+// All returns the built-in profiles, Claude Code first.
+func All() []Profile {
+	all := make([]Profile, len(profiles))
+	for i, p := range profiles {
+		all[i] = p.clone()
+	}
+	return all
+}
+
+// Lookup returns the profile with the given name.
+func Lookup(name string) (Profile, error) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p.clone(), nil
+		}
+	}
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.Name
+	}
+	return Profile{}, fmt.Errorf("unknown profile %q, want one of %s", name, strings.Join(names, ", "))
+}
+
+// clone copies p so callers cannot modify the built-in lists.
+func (p Profile) clone() Profile {
+	p.Include = append([]string(nil), p.Include...)
+	p.Transcripts = append([]string(nil), p.Transcripts...)
+	return p
+}
@@ -0,0 +1,40 @@
+package profile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	p, err := Lookup(Codex)
+	require.NoError(t, err)
+	assert.Equal(t, "~/.codex", p.Root)
+	assert.Equal(t, FormatCodex, p.Format)
+	assert.Contains(t, p.Include, "sessions")
+
+	// Callers get their own copy of the lists
+	p.Include[0] = "changed"
+	p, err = Lookup(Codex)
+	require.NoError(t, err)
+	assert.Equal(t, "sessions", p.Include[0])
+
+	_, err = Lookup("cursor")
+	assert.ErrorContains(t, err, "want one of claude-code, codex, gemini-cli")
+}
+
+func TestAll(t *testing.T) {
+	all := All()
+	require.Len(t, all, 3)
+	assert.Equal(t, ClaudeCode, all[0].Name)
+	for _, p := range all {
+		assert.NotEmpty(t, p.Include, p.Name)
+		for _, pattern := range p.Transcripts {
+			assert.Contains(t, p.Include, pattern, p.Name)
+		}
+		for _, pattern := range p.Include {
+			assert.NotContains(t, []string{"auth.json", "oauth_creds.json", ".credentials.json"}, pattern, p.Name)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package remap moves Claude Code projects to other working directories,
+// for restoring a backup on a machine where the code lives elsewhere.
+package remap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// maxLine bounds the length of a transcript line.
+const maxLine = 64 << 20
+
+// Rule maps the directory From, and everything below it, to To.
+type Rule struct {
+	From string
+	To   string
+}
+
+// ParseRule parses a FROM=TO rule.
+func ParseRule(s string) (Rule, error) {
+	from, to, ok := strings.Cut(s, "=")
+	from, to = trimSeparator(from), trimSeparator(to)
+	if !ok || from == "" || to == "" {
+		return Rule{}, fmt.Errorf("invalid mapping %q, want FROM=TO", s)
+	}
+	return Rule{From: from, To: to}, nil
+}
+
+// trimSeparator removes trailing path separators except from a root.
+func trimSeparator(p string) string {
+	trimmed := strings.TrimRight(p, `/\`)
+	if trimmed == "" {
+		return p
+	}
+	return trimmed
+}
+
+// EncodeProject returns the directory name Claude Code stores the sessions
+// of a working directory under: every character other than an ASCII letter
+// or digit becomes '-'.
+func EncodeProject(cwd string) string {
+	b := []byte(cwd)
+	for i, c := range b {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			b[i] = '-'
+		}
+	}
+	return string(b)
+}
+
+// Mapper applies rules to working directories, project directories and
+// the transcripts that record them.
+type Mapper struct {
+	rules []Rule
+	// cwds maps project directory names to the working directory they encode
+	cwds map[string]string
+}
+
+// New returns a mapper for rules. The first matching rule wins.
+func New(rules []Rule) *Mapper {
+	return &Mapper{rules: rules, cwds: map[string]string{}}
+}
+
+// MapPath maps an absolute path if a rule's From is the path or one of its
+// parent directories. Separators of the rest of the path are converted to
+// the style of To, so Windows paths can be mapped to Unix paths and back.
+func (m *Mapper) MapPath(p string) (string, bool) {
+	for _, r := range m.rules {
+		if p == r.From {
+			return r.To, true
+		}
+		if !strings.HasPrefix(p, r.From) {
+			continue
+		}
+		rest := p[len(r.From):]
+		if strings.HasSuffix(r.From, "/") || strings.HasSuffix(r.From, `\`) {
+			// A root such as / or C:\ keeps its separator
+			rest = p[len(r.From)-1:]
+		} else if rest[0] != '/' && rest[0] != '\\' {
+			continue
+		}
+		if windowsStyle(r.To) {
+			rest = strings.ReplaceAll(rest, "/", `\`)
+		} else {
+			rest = strings.ReplaceAll(rest, `\`, "/")
+		}
+		return trimSeparator(r.To) + rest, true
+	}
+	return "", false
+}
+
+// windowsStyle reports whether p is a Windows path such as C:\src.
+func windowsStyle(p string) bool {
+	return strings.Contains(p, `\`) || len(p) >= 2 && p[1] == ':'
+}
+
+// AddProject records the working directory of a project directory, as read
+// from its transcripts. It is ignored if it does not encode to dir.
+func (m *Mapper) AddProject(dir, cwd string) {
+	if EncodeProject(cwd) == dir {
+		m.cwds[dir] = cwd
+	}
+}
+
+// ProjectDir returns the new name of a project directory. The working
+// directory recorded with AddProject is mapped if known. Otherwise the
+// encoded rules are matched against the name, which cannot tell a '-' in a
+// directory name from a path separator.
+func (m *Mapper) ProjectDir(dir string) (string, bool) {
+	if cwd, ok := m.cwds[dir]; ok {
+		mapped, ok := m.MapPath(cwd)
+		if !ok {
+			return "", false
+		}
+		return EncodeProject(mapped), true
+	}
+	for _, r := range m.rules {
+		from := EncodeProject(r.From)
+		if dir == from || strings.HasPrefix(dir, from+"-") {
+			return EncodeProject(trimSeparator(r.To)) + dir[len(from):], true
+		}
+	}
+	return "", false
+}
+
+// RelPath maps a slash-separated path relative to the Claude directory,
+// renaming the project directory of files under projects/.
+func (m *Mapper) RelPath(rel string) string {
+	parts := strings.SplitN(rel, "/", 3)
+	if len(parts) < 3 || parts[0] != "projects" {
+		return rel
+	}
+	dir, ok := m.ProjectDir(parts[1])
+	if !ok {
+		return rel
+	}
+	return path.Join(parts[0], dir, parts[2])
+}
+
+// pathFields are the transcript and history fields that hold a working directory.
+var pathFields = []string{"cwd", "project"}
+
+// Rewrite maps the cwd fields of transcript lines and the project fields
+// of history.jsonl in JSONL data. Lines are edited in place, so the rest
+// of each line is kept byte for byte. It returns the number of changed lines.
+func (m *Mapper) Rewrite(data []byte) ([]byte, int) {
+	var out bytes.Buffer
+	changed := 0
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		data = data[len(line):]
+
+		newLine := m.rewriteLine(line)
+		if !bytes.Equal(newLine, line) {
+			changed++
+		}
+		out.Write(newLine)
+	}
+	return out.Bytes(), changed
+}
+
+func (m *Mapper) rewriteLine(line []byte) []byte {
+	if !bytes.Contains(line, []byte(`"cwd"`)) && !bytes.Contains(line, []byte(`"project"`)) {
+		return line
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return line
+	}
+	for _, name := range pathFields {
+		var value string
+		if raw, ok := fields[name]; !ok || json.Unmarshal(raw, &value) != nil {
+			continue
+		}
+		mapped, ok := m.MapPath(value)
+		if !ok {
+			continue
+		}
+		old := append([]byte(`"`+name+`":`), fields[name]...)
+		line = bytes.ReplaceAll(line, old, append([]byte(`"`+name+`":`), marshalString(mapped)...))
+	}
+	return line
+}
+
+// marshalString encodes s the way JSON.stringify does, without escaping HTML.
+func marshalString(s string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// Transform rewrites JSONL files; it has the signature of sync.Syncer.Transform.
+func (m *Mapper) Transform(relPath string, data []byte) ([]byte, error) {
+	if path.Ext(relPath) != ".jsonl" {
+		return data, nil
+	}
+	data, _ = m.Rewrite(data)
+	return data, nil
+}
+
+// FirstCWD returns the first cwd field of a transcript, or "" if it has none.
+func FirstCWD(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	for scanner.Scan() {
+		if !bytes.Contains(scanner.Bytes(), []byte(`"cwd"`)) {
+			continue
+		}
+		var rec struct {
+			CWD string `json:"cwd"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err == nil && rec.CWD != "" {
+			return rec.CWD, nil
+		}
+	}
+	return "", scanner.Err()
+}
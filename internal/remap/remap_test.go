@@ -0,0 +1,98 @@
+package remap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("/Users/alice/src/=/home/alice/work")
+	require.NoError(t, err)
+	assert.Equal(t, Rule{From: "/Users/alice/src", To: "/home/alice/work"}, r)
+
+	for _, s := range []string{"", "/a", "=/b", "/a="} {
+		_, err := ParseRule(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestEncodeProject(t *testing.T) {
+	assert.Equal(t, "-Users-alice-src-app", EncodeProject("/Users/alice/src/app"))
+	assert.Equal(t, "-home-alice--config-my-app", EncodeProject("/home/alice/.config/my_app"))
+	assert.Equal(t, "C--Users-alice-src", EncodeProject(`C:\Users\alice\src`))
+}
+
+func TestMapPath(t *testing.T) {
+	m := New([]Rule{
+		{From: "/Users/alice/src", To: "/home/alice/work"},
+		{From: `C:\src`, To: "/home/alice/win"},
+		{From: "/opt", To: `D:\opt`},
+	})
+	for in, want := range map[string]string{
+		"/Users/alice/src":         "/home/alice/work",
+		"/Users/alice/src/app":     "/home/alice/work/app",
+		`C:\src\tool\cli`:          "/home/alice/win/tool/cli",
+		"/opt/app/bin":             `D:\opt\app\bin`,
+		"/Users/alice/src-old/app": "",
+		"/var/tmp":                 "",
+	} {
+		got, ok := m.MapPath(in)
+		assert.Equal(t, want != "", ok, in)
+		assert.Equal(t, want, got, in)
+	}
+}
+
+func TestProjectDir(t *testing.T) {
+	m := New([]Rule{{From: "/Users/alice/src", To: "/home/alice/work"}})
+
+	// Without a known cwd the encoded rule is matched against the name
+	dir, ok := m.ProjectDir("-Users-alice-src-app")
+	require.True(t, ok)
+	assert.Equal(t, "-home-alice-work-app", dir)
+
+	// With the cwd, a '-' in a directory name is not taken for a separator
+	m.AddProject("-Users-alice-src-old-app", "/Users/alice/src-old/app")
+	_, ok = m.ProjectDir("-Users-alice-src-old-app")
+	assert.False(t, ok)
+
+	m.AddProject("-Users-alice-src-my-app", "/Users/alice/src/my.app")
+	dir, ok = m.ProjectDir("-Users-alice-src-my-app")
+	require.True(t, ok)
+	assert.Equal(t, "-home-alice-work-my-app", dir)
+
+	assert.Equal(t, "projects/-home-alice-work-app/s1.jsonl", m.RelPath("projects/-Users-alice-src-app/s1.jsonl"))
+	assert.Equal(t, "history.jsonl", m.RelPath("history.jsonl"))
+	assert.Equal(t, "projects/-var-tmp/s1.jsonl", m.RelPath("projects/-var-tmp/s1.jsonl"))
+}
+
+func TestRewrite(t *testing.T) {
+	m := New([]Rule{{From: "/Users/alice/src", To: "/home/alice/work"}})
+	data := strings.Join([]string{
+		`{"type":"user","cwd":"/Users/alice/src/app","message":{"content":"run <tests>"}}`,
+		`{"type":"summary","summary":"x"}`,
+		`{"display":"fix","project":"/Users/alice/src/app"}`,
+		`{"type":"user","cwd":"/var/tmp"}`,
+		`not json "cwd"`,
+	}, "\n")
+
+	got, changed := m.Rewrite([]byte(data))
+	assert.Equal(t, 2, changed)
+	assert.Equal(t, strings.Join([]string{
+		`{"type":"user","cwd":"/home/alice/work/app","message":{"content":"run <tests>"}}`,
+		`{"type":"summary","summary":"x"}`,
+		`{"display":"fix","project":"/home/alice/work/app"}`,
+		`{"type":"user","cwd":"/var/tmp"}`,
+		`not json "cwd"`,
+	}, "\n"), string(got))
+
+	out, err := m.Transform("todos/a.json", []byte(`{"cwd":"/Users/alice/src"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"cwd":"/Users/alice/src"}`, string(out))
+
+	cwd, err := FirstCWD(strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "/Users/alice/src/app", cwd)
+}
@@ -0,0 +1,80 @@
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Unlimited keeps one snapshot for every period.
+const Unlimited = -1
+
+// Policy says how many periods of each size keep a snapshot.
+// Within a period the newest snapshot is kept. Zero disables a rule.
+type Policy struct {
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// Empty reports whether no rule is enabled.
+func (p Policy) Empty() bool {
+	return p.Hourly == 0 && p.Daily == 0 && p.Weekly == 0 && p.Monthly == 0
+}
+
+// rule is one bucketing rule of a policy.
+type rule struct {
+	name  string
+	count int
+	key   func(time.Time) string
+}
+
+func (p Policy) rules() []rule {
+	return []rule{
+		{"hourly", p.Hourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{"daily", p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{"monthly", p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+}
+
+// Apply returns, for each snapshot time, the reasons to keep it.
+// A snapshot with no reasons should be dropped. The newest snapshot
+// is always kept as "latest".
+func (p Policy) Apply(times []time.Time) [][]string {
+	reasons := make([][]string, len(times))
+	if len(times) == 0 {
+		return reasons
+	}
+
+	// Visit snapshots newest first so each period keeps its newest one
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return times[order[a]].After(times[order[b]]) })
+
+	reasons[order[0]] = append(reasons[order[0]], "latest")
+	for _, r := range p.rules() {
+		if r.count == 0 {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, i := range order {
+			if r.count != Unlimited && len(seen) >= r.count {
+				break
+			}
+			key := r.key(times[i])
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			reasons[i] = append(reasons[i], r.name)
+		}
+	}
+	return reasons
+}
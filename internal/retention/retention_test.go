@@ -0,0 +1,61 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Apply(t *testing.T) {
+	base := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	times := []time.Time{
+		base.AddDate(0, -2, 0),      // 0: January
+		base.AddDate(0, 0, -8),      // 1: previous week
+		base.AddDate(0, 0, -1),      // 2: yesterday
+		base.Add(-90 * time.Minute), // 3: 10:30
+		base.Add(-30 * time.Minute), // 4: 11:30, newest of its hour
+		base.Add(-45 * time.Minute), // 5: 11:15
+		base,                        // 6: latest
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   [][]string
+	}{
+		{
+			name:   "hourly",
+			policy: Policy{Hourly: 2},
+			want:   [][]string{nil, nil, nil, nil, {"hourly"}, nil, {"latest", "hourly"}},
+		},
+		{
+			name:   "daily and monthly",
+			policy: Policy{Daily: 2, Monthly: Unlimited},
+			want: [][]string{
+				{"monthly"}, nil, {"daily"}, nil, nil, nil,
+				{"latest", "daily", "monthly"},
+			},
+		},
+		{
+			name:   "weekly",
+			policy: Policy{Weekly: 3},
+			want:   [][]string{{"weekly"}, {"weekly"}, nil, nil, nil, nil, {"latest", "weekly"}},
+		},
+		{
+			name:   "empty keeps latest",
+			policy: Policy{},
+			want:   [][]string{nil, nil, nil, nil, nil, nil, {"latest"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.Apply(times))
+		})
+	}
+}
+
+func TestPolicy_Empty(t *testing.T) {
+	assert.True(t, Policy{}.Empty())
+	assert.False(t, Policy{Monthly: Unlimited}.Empty())
+}
@@ -0,0 +1,116 @@
+package scan
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Action decides what happens to a file when a rule matches.
+type Action string
+
+const (
+	// ActionWarn reports the finding and backs up the file unchanged.
+	ActionWarn Action = "warn"
+	// ActionRedact replaces the match with a marker in the backup copy.
+	ActionRedact Action = "redact"
+	// ActionBlock refuses the backup while the finding is present.
+	ActionBlock Action = "block"
+)
+
+// ParseAction validates an action name from config.
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case ActionWarn, ActionRedact, ActionBlock:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown action %q (want warn, redact or block)", s)
+	}
+}
+
+// Rule is a named secret detector.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Action  Action
+}
+
+// RuleConfig is the config representation of a custom rule.
+type RuleConfig struct {
+	Name    string `mapstructure:"name"`
+	Pattern string `mapstructure:"pattern"`
+	Action  string `mapstructure:"action"`
+}
+
+// builtinPatterns are detectors for common credential formats.
+// Patterns must not match '"', nor begin or end inside a backslash escape,
+// so that redaction keeps JSON valid. They may span lines, as a PEM block
+// in a plain file does.
+var builtinPatterns = []struct {
+	name    string
+	pattern string
+}{
+	{"aws-access-key-id", `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{"github-token", `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`},
+	{"anthropic-api-key", `\bsk-ant-[A-Za-z0-9_-]{20,}`},
+	{"openai-api-key", `\bsk-(?:proj-)?[A-Za-z0-9_-]{32,}`},
+	{"slack-token", `\bxox[abposr]-[A-Za-z0-9-]{10,}`},
+	{"google-api-key", `\bAIza[0-9A-Za-z_-]{35}`},
+	{"stripe-key", `\b[rs]k_live_[0-9A-Za-z]{24,}`},
+	{"private-key", `-----BEGIN [A-Z ]*PRIVATE KEY-----[^"]*?-----END [A-Z ]*PRIVATE KEY-----`},
+	{"bearer-token", `\b[Bb]earer [A-Za-z0-9._~+/-]{20,}=*`},
+}
+
+// BuiltinRules returns the built-in detectors with the given action.
+func BuiltinRules(action Action) []Rule {
+	rules := make([]Rule, 0, len(builtinPatterns))
+	for _, p := range builtinPatterns {
+		rules = append(rules, Rule{
+			Name:    p.name,
+			Pattern: regexp.MustCompile(p.pattern),
+			Action:  action,
+		})
+	}
+	return rules
+}
+
+// CompileRules converts custom rule configs into rules.
+// A config whose name matches a built-in rule and has no pattern
+// overrides that rule's action instead of adding a new rule.
+func CompileRules(builtin []Rule, configs []RuleConfig) ([]Rule, error) {
+	rules := append([]Rule(nil), builtin...)
+	for i, c := range configs {
+		action := ActionWarn
+		if c.Action != "" {
+			a, err := ParseAction(c.Action)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d (%s): %w", i, c.Name, err)
+			}
+			action = a
+		}
+
+		if c.Pattern == "" {
+			found := false
+			for j := range rules {
+				if rules[j].Name == c.Name {
+					rules[j].Action = action
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("rule %d (%s): pattern is required", i, c.Name)
+			}
+			continue
+		}
+
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, c.Name, err)
+		}
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("custom-%d", i)
+		}
+		rules = append(rules, Rule{Name: name, Pattern: re, Action: action})
+	}
+	return rules, nil
+}
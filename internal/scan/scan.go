@@ -0,0 +1,164 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// sniffLen is how much of a file is inspected to detect binary content.
+const sniffLen = 8000
+
+// Finding is a single rule match in a file.
+type Finding struct {
+	RelPath string
+	Line    int
+	Rule    string
+	Action  Action
+	Match   string
+}
+
+// Masked returns the match with its middle hidden, safe to print.
+func (f Finding) Masked() string {
+	return Mask(f.Match)
+}
+
+// Mask hides all but the first and last four characters of a secret.
+func Mask(s string) string {
+	if len(s) <= 12 {
+		return "****"
+	}
+	return s[:4] + "****" + s[len(s)-4:]
+}
+
+// Report collects findings for a set of files.
+type Report struct {
+	Findings []Finding
+}
+
+// Blocked returns the findings whose rule action is block.
+func (r *Report) Blocked() []Finding {
+	var blocked []Finding
+	for _, f := range r.Findings {
+		if f.Action == ActionBlock {
+			blocked = append(blocked, f)
+		}
+	}
+	return blocked
+}
+
+// Scanner matches file contents against secret rules.
+type Scanner struct {
+	Rules []Rule
+}
+
+// NewScanner creates a new Scanner.
+func NewScanner(rules []Rule) *Scanner {
+	return &Scanner{Rules: rules}
+}
+
+// Redacts reports whether any rule redacts, that is whether Redact can
+// change a file.
+func (s *Scanner) Redacts() bool {
+	for _, rule := range s.Rules {
+		if rule.Action == ActionRedact {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan returns the findings in data, ordered by the line they start on.
+// The whole of data is matched at once, so that multi-line secrets are
+// found. Binary content is skipped.
+func (s *Scanner) Scan(relPath string, data []byte) []Finding {
+	if isBinary(data) {
+		return nil
+	}
+
+	var findings []Finding
+	for _, rule := range s.Rules {
+		line, offset := 1, 0
+		for _, m := range rule.Pattern.FindAllIndex(data, -1) {
+			line += bytes.Count(data[offset:m[0]], []byte("\n"))
+			offset = m[0]
+			findings = append(findings, Finding{
+				RelPath: relPath,
+				Line:    line,
+				Rule:    rule.Name,
+				Action:  rule.Action,
+				Match:   string(data[m[0]:m[1]]),
+			})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+// ScanFiles scans the given files, keyed by relative path to absolute path.
+func (s *Scanner) ScanFiles(files map[string]string) (*Report, error) {
+	relPaths := make([]string, 0, len(files))
+	for relPath := range files {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+
+	report := &Report{}
+	for _, relPath := range relPaths {
+		data, err := os.ReadFile(files[relPath])
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", relPath, err)
+		}
+		report.Findings = append(report.Findings, s.Scan(relPath, data)...)
+	}
+	return report, nil
+}
+
+// Redact replaces every match of a redact rule with a marker.
+// For JSONL files each line is redacted and checked to still be valid JSON
+// afterwards, so a custom pattern cannot silently corrupt a transcript.
+// Other files are redacted whole, like Scan matches them.
+func (s *Scanner) Redact(relPath string, data []byte) ([]byte, error) {
+	if isBinary(data) {
+		return data, nil
+	}
+	if filepath.Ext(relPath) != ".jsonl" {
+		return s.redact(data), nil
+	}
+
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	for i, line := range lines {
+		redacted := s.redact(line)
+		if bytes.Equal(redacted, line) {
+			continue
+		}
+		if json.Valid(bytes.TrimSpace(line)) && !json.Valid(bytes.TrimSpace(redacted)) {
+			return nil, fmt.Errorf("line %d: redaction would produce invalid JSON", i+1)
+		}
+		lines[i] = redacted
+	}
+	return bytes.Join(lines, nil), nil
+}
+
+// redact replaces the matches of the redact rules in data.
+func (s *Scanner) redact(data []byte) []byte {
+	for _, rule := range s.Rules {
+		if rule.Action != ActionRedact {
+			continue
+		}
+		marker := []byte("[REDACTED:" + rule.Name + "]")
+		data = rule.Pattern.ReplaceAllLiteral(data, marker)
+	}
+	return data
+}
+
+// isBinary reports whether data looks like a binary file.
+func isBinary(data []byte) bool {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,127 @@
+package search
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Roles of indexed blocks.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleTool marks tool inputs and outputs.
+	RoleTool = "tool"
+)
+
+// Block is a searchable part of a transcript message.
+type Block struct {
+	Role string
+	// Tool is the tool name of a tool input or output, if known.
+	Tool string
+	Text string
+}
+
+type transcriptLine struct {
+	Type      string    `json:"type"`
+	IsMeta    bool      `json:"isMeta"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"message"`
+}
+
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+}
+
+// parseLine returns the searchable blocks of a transcript line and its time.
+// toolNames, if not nil, records the names of tool uses and supplies them
+// for tool results, which only refer to the use by ID.
+func parseLine(line []byte, toolNames map[string]string) ([]Block, time.Time) {
+	var rec transcriptLine
+	if err := json.Unmarshal(line, &rec); err != nil || rec.IsMeta {
+		return nil, time.Time{}
+	}
+	if rec.Type != RoleUser && rec.Type != RoleAssistant {
+		return nil, time.Time{}
+	}
+
+	var text string
+	if err := json.Unmarshal(rec.Message.Content, &text); err == nil {
+		if strings.TrimSpace(text) == "" {
+			return nil, rec.Timestamp
+		}
+		return []Block{{Role: rec.Type, Text: text}}, rec.Timestamp
+	}
+
+	var content []contentBlock
+	if err := json.Unmarshal(rec.Message.Content, &content); err != nil {
+		return nil, rec.Timestamp
+	}
+	var blocks []Block
+	for _, c := range content {
+		switch c.Type {
+		case "text":
+			if strings.TrimSpace(c.Text) != "" {
+				blocks = append(blocks, Block{Role: rec.Type, Text: c.Text})
+			}
+		case "tool_use":
+			if toolNames != nil {
+				toolNames[c.ID] = c.Name
+			}
+			blocks = append(blocks, Block{Role: RoleTool, Tool: c.Name, Text: jsonText(c.Input)})
+		case "tool_result":
+			var tool string
+			if toolNames != nil {
+				tool = toolNames[c.ToolUseID]
+				delete(toolNames, c.ToolUseID)
+			}
+			blocks = append(blocks, Block{Role: RoleTool, Tool: tool, Text: jsonText(c.Content)})
+		}
+	}
+	return blocks, rec.Timestamp
+}
+
+// jsonText joins the string values of a JSON document, such as tool input
+// or the text blocks of a tool result, in a stable order.
+func jsonText(raw json.RawMessage) string {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+	var parts []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case string:
+			parts = append(parts, v)
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]any:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if k == "type" || k == "id" || k == "tool_use_id" {
+					continue
+				}
+				walk(v[k])
+			}
+		}
+	}
+	walk(v)
+	return strings.Join(parts, "\n")
+}
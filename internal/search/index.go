@@ -0,0 +1,392 @@
+// Package search maintains a full-text index over session transcripts.
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/session"
+)
+
+// Version is the index format version; indexes of other versions are rebuilt.
+const Version = 1
+
+// Doc is an indexed block of a transcript line.
+type Doc struct {
+	// Offset and Length locate the line in the file.
+	Offset int64
+	Length int32
+	// Block is the position of the block among those of the line.
+	Block int16
+	Role  string
+	Tool  string
+	Time  time.Time
+}
+
+// File is the index of one transcript.
+type File struct {
+	// Path is slash-separated and relative to the Claude directory.
+	Path string
+	// Object is the git blob of a transcript found only in the backup
+	// history, or empty for a live file.
+	Object  string
+	Size    int64
+	ModTime time.Time
+	// Indexed is the length of the indexed prefix, which ends with a
+	// complete line; Tail is the hash of that last line.
+	Indexed int64
+	Tail    string
+	TailLen int64
+
+	Docs     []Doc
+	Postings map[string][]int32
+	// PendingTools maps the IDs of tool uses without a result yet to tool names.
+	PendingTools map[string]string
+}
+
+// Project returns the project directory of the transcript.
+func (f *File) Project() string {
+	_, rel := session.SplitHost(f.Path)
+	parts := strings.Split(rel, "/")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// Index maps source keys to indexed files.
+type Index struct {
+	Version int
+	Files   map[string]*File
+}
+
+// New returns an empty index.
+func New() *Index {
+	return &Index{Version: Version, Files: map[string]*File{}}
+}
+
+// Load reads an index, returning an empty one if the file does not exist
+// or was written by another version.
+func Load(name string) (*Index, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ix Index
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&ix); err != nil || ix.Version != Version {
+		return New(), nil
+	}
+	if ix.Files == nil {
+		ix.Files = map[string]*File{}
+	}
+	return &ix, nil
+}
+
+// Save writes the index atomically. It is readable only by the owner since
+// it holds transcript text.
+func (ix *Index) Save(name string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := gob.NewEncoder(w).Encode(ix); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Source is a transcript to index.
+type Source struct {
+	// Key identifies the source across updates.
+	Key     string
+	Path    string
+	Object  string
+	Size    int64
+	ModTime time.Time
+	Open    func() (io.ReadCloser, error)
+}
+
+// UpdateStats counts the files changed by Update.
+type UpdateStats struct {
+	Added   int
+	Updated int
+	Removed int
+}
+
+// Update brings the index in line with sources, which are either all live
+// files or, if history is set, all files found only in the backup history.
+// Files of the same kind that are no longer listed are removed.
+// Live files that grew by appending are indexed from where they left off.
+func (ix *Index) Update(sources []Source, history bool) (UpdateStats, error) {
+	var stats UpdateStats
+	listed := make(map[string]bool, len(sources))
+	for _, s := range sources {
+		listed[s.Key] = true
+		old := ix.Files[s.Key]
+		if old != nil && old.Size == s.Size && old.ModTime.Equal(s.ModTime) {
+			continue
+		}
+
+		f, err := ix.index(s, old)
+		if err != nil {
+			return stats, fmt.Errorf("index %s: %w", s.Path, err)
+		}
+		ix.Files[s.Key] = f
+		if old == nil {
+			stats.Added++
+		} else {
+			stats.Updated++
+		}
+	}
+
+	for key, f := range ix.Files {
+		if (f.Object != "") == history && !listed[key] {
+			delete(ix.Files, key)
+			stats.Removed++
+		}
+	}
+	return stats, nil
+}
+
+// index indexes s, continuing from old if s still starts with its indexed prefix.
+func (ix *Index) index(s Source, old *File) (*File, error) {
+	r, err := s.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if old != nil && s.Object == "" && s.Size >= old.Indexed {
+		if ok, err := sameTail(r, old); err != nil {
+			return nil, err
+		} else if ok {
+			f := *old
+			f.Size, f.ModTime = s.Size, s.ModTime
+			// gob decodes empty maps as nil
+			if f.Postings == nil {
+				f.Postings = map[string][]int32{}
+			}
+			if f.PendingTools == nil {
+				f.PendingTools = map[string]string{}
+			}
+			return &f, f.read(r)
+		}
+		// Not an append: start over
+		r.Close()
+		if r, err = s.Open(); err != nil {
+			return nil, err
+		}
+		defer r.Close()
+	}
+
+	f := &File{
+		Path:         s.Path,
+		Object:       s.Object,
+		Size:         s.Size,
+		ModTime:      s.ModTime,
+		Postings:     map[string][]int32{},
+		PendingTools: map[string]string{},
+	}
+	return f, f.read(r)
+}
+
+// sameTail consumes the indexed prefix of r and reports whether it ends
+// with the line the index was built from.
+func sameTail(r io.Reader, f *File) (bool, error) {
+	if _, err := io.CopyN(io.Discard, r, f.Indexed-f.TailLen); err != nil {
+		return false, ignoreEOF(err)
+	}
+	tail := make([]byte, f.TailLen)
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return false, ignoreEOF(err)
+	}
+	return hashLine(tail) == f.Tail, nil
+}
+
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+	return err
+}
+
+func hashLine(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// read indexes the complete lines of r, which is positioned at f.Indexed.
+// A trailing line without a newline is left for the next update.
+func (f *File) read(r io.Reader) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			f.addLine(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (f *File) addLine(line []byte) {
+	blocks, t := parseLine(bytes.TrimSpace(line), f.PendingTools)
+	for i, b := range blocks {
+		id := int32(len(f.Docs))
+		f.Docs = append(f.Docs, Doc{
+			Offset: f.Indexed,
+			Length: int32(len(line)),
+			Block:  int16(i),
+			Role:   b.Role,
+			Tool:   b.Tool,
+			Time:   t,
+		})
+		for _, term := range uniqueTokens(b.Text) {
+			f.Postings[term] = append(f.Postings[term], id)
+		}
+	}
+	f.Indexed += int64(len(line))
+	f.Tail, f.TailLen = hashLine(line), int64(len(line))
+}
+
+// Query selects blocks containing every term of Text.
+type Query struct {
+	Text string
+	// Project matches project directories containing it.
+	Project string
+	Role    string
+	Tool    string
+	Since   time.Time
+	Until   time.Time
+	// History includes files found only in the backup history.
+	History bool
+}
+
+// Hit is a block matching a query.
+type Hit struct {
+	Key  string
+	File *File
+	Doc  Doc
+}
+
+// Search returns the blocks matching q, newest first.
+func (ix *Index) Search(q Query) []Hit {
+	terms := uniqueTokens(q.Text)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	var hits []Hit
+	for key, f := range ix.Files {
+		if f.Object != "" && !q.History {
+			continue
+		}
+		if q.Project != "" && !strings.Contains(f.Project(), q.Project) {
+			continue
+		}
+		for _, id := range f.match(terms) {
+			d := f.Docs[id]
+			if q.Role != "" && d.Role != q.Role {
+				continue
+			}
+			if q.Tool != "" && !strings.EqualFold(d.Tool, q.Tool) {
+				continue
+			}
+			if (!q.Since.IsZero() && d.Time.Before(q.Since)) || (!q.Until.IsZero() && d.Time.After(q.Until)) {
+				continue
+			}
+			hits = append(hits, Hit{Key: key, File: f, Doc: d})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if !a.Doc.Time.Equal(b.Doc.Time) {
+			return a.Doc.Time.After(b.Doc.Time)
+		}
+		if a.File.Path != b.File.Path {
+			return a.File.Path < b.File.Path
+		}
+		return a.Doc.Offset < b.Doc.Offset || (a.Doc.Offset == b.Doc.Offset && a.Doc.Block < b.Doc.Block)
+	})
+	return hits
+}
+
+// match intersects the postings of terms, which are sorted by construction.
+func (f *File) match(terms []string) []int32 {
+	result := f.Postings[terms[0]]
+	for _, term := range terms[1:] {
+		if len(result) == 0 {
+			return nil
+		}
+		next := f.Postings[term]
+		var both []int32
+		for i, j := 0, 0; i < len(result) && j < len(next); {
+			switch {
+			case result[i] == next[j]:
+				both = append(both, result[i])
+				i++
+				j++
+			case result[i] < next[j]:
+				i++
+			default:
+				j++
+			}
+		}
+		result = both
+	}
+	return result
+}
+
+// ReadBlock returns the block of d from r, the transcript it was indexed from.
+func ReadBlock(r io.Reader, d Doc) (Block, error) {
+	if _, err := io.CopyN(io.Discard, r, d.Offset); err != nil {
+		return Block{}, err
+	}
+	line := make([]byte, d.Length)
+	if _, err := io.ReadFull(r, line); err != nil {
+		return Block{}, err
+	}
+	blocks, _ := parseLine(bytes.TrimSpace(line), nil)
+	if int(d.Block) >= len(blocks) {
+		return Block{}, fmt.Errorf("transcript changed since it was indexed")
+	}
+	b := blocks[d.Block]
+	b.Tool = d.Tool
+	return b, nil
+}
@@ -0,0 +1,133 @@
+package search
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokens(t *testing.T) {
+	assert.Equal(t, []string{"fix", "the", "flaky_test", "42"}, Tokens("Fix the flaky_test #42!"))
+	assert.Equal(t, []string{"テス", "スト", "トを", "を修", "修正"}, Tokens("テストを修正"))
+	assert.Equal(t, []string{"go", "テス", "スト"}, Tokens("goテスト"))
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("a ", 50) + "Flaky test fixed"
+	snippet := Snippet(text, "flaky", 30)
+	assert.True(t, strings.HasPrefix(snippet, "..."))
+	assert.Contains(t, snippet, "Flaky test")
+	assert.Equal(t, "short", Snippet("short", "x", 30))
+}
+
+const (
+	userLine     = `{"type":"user","timestamp":"2024-09-01T10:00:00Z","message":{"role":"user","content":"Fix the flaky test"}}`
+	toolUseLine  = `{"type":"assistant","timestamp":"2024-09-01T10:01:00Z","message":{"role":"assistant","content":[{"type":"text","text":"Running the tests"},{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"go test ./..."}}]}}`
+	toolDoneLine = `{"type":"user","timestamp":"2024-09-01T10:02:00Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok  example/pkg"}]}}`
+)
+
+func TestParseLine(t *testing.T) {
+	names := map[string]string{}
+	blocks, ts := parseLine([]byte(toolUseLine), names)
+	require.Len(t, blocks, 2)
+	assert.Equal(t, Block{Role: RoleAssistant, Text: "Running the tests"}, blocks[0])
+	assert.Equal(t, Block{Role: RoleTool, Tool: "Bash", Text: "go test ./..."}, blocks[1])
+	assert.True(t, ts.Equal(time.Date(2024, 9, 1, 10, 1, 0, 0, time.UTC)))
+
+	blocks, _ = parseLine([]byte(toolDoneLine), names)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, Block{Role: RoleTool, Tool: "Bash", Text: "ok  example/pkg"}, blocks[0])
+	assert.Empty(t, names)
+
+	blocks, _ = parseLine([]byte(`{"type":"summary","summary":"x"}`), nil)
+	assert.Empty(t, blocks)
+}
+
+// source returns a Source over content.
+func source(key, path, content string, modTime time.Time) Source {
+	return Source{
+		Key:     key,
+		Path:    path,
+		Size:    int64(len(content)),
+		ModTime: modTime,
+		Open:    func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(content)), nil },
+	}
+}
+
+func TestIndex_UpdateAndSearch(t *testing.T) {
+	ix := New()
+	now := time.Now()
+	path := "projects/-work-app/s1.jsonl"
+
+	// A partial last line waits for the next update
+	content := userLine + "\n" + toolUseLine[:20]
+	stats, err := ix.Update([]Source{source(path, path, content, now)}, false)
+	require.NoError(t, err)
+	assert.Equal(t, UpdateStats{Added: 1}, stats)
+	assert.Len(t, ix.Search(Query{Text: "flaky test"}), 1)
+	assert.Empty(t, ix.Search(Query{Text: "running"}))
+
+	// Appended lines are indexed incrementally
+	content = userLine + "\n" + toolUseLine + "\n" + toolDoneLine + "\n"
+	stats, err = ix.Update([]Source{source(path, path, content, now.Add(time.Second))}, false)
+	require.NoError(t, err)
+	assert.Equal(t, UpdateStats{Updated: 1}, stats)
+	assert.Len(t, ix.Files[path].Docs, 4)
+
+	// Words match exactly: "tests" is not "test"
+	hits := ix.Search(Query{Text: "test"})
+	require.Len(t, hits, 2)
+	assert.Equal(t, RoleTool, hits[0].Doc.Role) // newest first
+	assert.Len(t, ix.Search(Query{Text: "test", Role: RoleUser}), 1)
+	assert.Len(t, ix.Search(Query{Text: "go test", Tool: "bash"}), 1)
+	assert.Len(t, ix.Search(Query{Text: "example", Tool: "Bash"}), 1)
+	assert.Empty(t, ix.Search(Query{Text: "test", Project: "lib"}))
+	assert.Len(t, ix.Search(Query{Text: "test", Since: time.Date(2024, 9, 1, 10, 1, 0, 0, time.UTC)}), 1)
+	assert.Len(t, ix.Search(Query{Text: "test", Until: time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)}), 1)
+
+	b, err := ReadBlock(strings.NewReader(content), hits[0].Doc)
+	require.NoError(t, err)
+	assert.Equal(t, "go test ./...", b.Text)
+
+	// A rewrite is reindexed from scratch
+	stats, err = ix.Update([]Source{source(path, path, toolDoneLine+"\n"+userLine+"\n", now.Add(2*time.Second))}, false)
+	require.NoError(t, err)
+	assert.Equal(t, UpdateStats{Updated: 1}, stats)
+	assert.Len(t, ix.Files[path].Docs, 2)
+
+	// History files are kept while updating live files and only searched on request
+	old := source("git:abc", "projects/-work-lib/s0.jsonl", userLine+"\n", time.Time{})
+	old.Object = "abc"
+	_, err = ix.Update([]Source{old}, true)
+	require.NoError(t, err)
+	assert.Len(t, ix.Search(Query{Text: "flaky"}), 1)
+	assert.Len(t, ix.Search(Query{Text: "flaky", History: true}), 2)
+
+	stats, err = ix.Update(nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, UpdateStats{Removed: 1}, stats)
+	assert.Len(t, ix.Search(Query{Text: "flaky", History: true}), 1)
+
+	assert.Empty(t, ix.Search(Query{Text: "!!"}))
+}
+
+func TestIndex_SaveLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cache", "search.idx")
+	ix, err := Load(name)
+	require.NoError(t, err)
+	assert.Empty(t, ix.Files)
+
+	path := "projects/p/s.jsonl"
+	_, err = ix.Update([]Source{source(path, path, userLine+"\n", time.Now())}, false)
+	require.NoError(t, err)
+	require.NoError(t, ix.Save(name))
+
+	loaded, err := Load(name)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Search(Query{Text: "flaky"}), 1)
+}
@@ -0,0 +1,94 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokens splits text into lower-case index terms. Runs of letters and digits
+// form words; Han, Hiragana and Katakana, which are written without spaces,
+// are split into overlapping bigrams so that any substring of two or more
+// characters can be found.
+func Tokens(text string) []string {
+	var tokens []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 1:
+			tokens = append(tokens, string(cjk))
+		case len(cjk) > 1:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー'
+}
+
+// uniqueTokens returns the distinct tokens of text.
+func uniqueTokens(text string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, t := range Tokens(text) {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// Snippet returns about width runes of text around the first occurrence
+// of any word of query, on one line.
+func Snippet(text, query string, width int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	lower := strings.ToLower(text)
+
+	start := 0
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if i := strings.Index(lower, word); i >= 0 {
+			// ToLower maps rune by rune, so rune offsets agree with text
+			start = max(utf8.RuneCountInString(lower[:i])-width/3, 0)
+			break
+		}
+	}
+	end := min(start+width, len(runes))
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet += "..."
+	}
+	return snippet
+}
@@ -0,0 +1,348 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+// Entry is one record of a file: a transcript message, a history prompt,
+// a todo item or a line of text.
+type Entry struct {
+	// Role is the message type, "prompt" for history.jsonl, the status of a
+	// todo item, or empty for plain text.
+	Role string
+	// Time is the timestamp of the record, if it has one.
+	Time time.Time
+	Text string
+
+	key string
+}
+
+// Entries splits a file into records according to its location.
+func Entries(relPath string, data []byte) []Entry {
+	rel := filepath.ToSlash(relPath)
+	switch {
+	case rel == "history.jsonl":
+		return splitLines(data, historyEntry)
+	case path.Ext(rel) == ".jsonl":
+		return splitLines(data, messageEntry)
+	case strings.HasPrefix(rel, "todos/") && path.Ext(rel) == ".json":
+		if entries, ok := todoEntries(data); ok {
+			return entries
+		}
+	}
+	return splitLines(data, func(line string) Entry { return Entry{Text: line} })
+}
+
+// splitLines parses each non-empty line with parse.
+func splitLines(data []byte, parse func(line string) Entry) []Entry {
+	var entries []Entry
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		e := parse(line)
+		e.key = line
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// messageEntry parses a transcript line.
+func messageEntry(line string) Entry {
+	var rec struct {
+		Type      string    `json:"type"`
+		Timestamp time.Time `json:"timestamp"`
+		Summary   string    `json:"summary"`
+		Message   struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		return Entry{Text: line}
+	}
+	e := Entry{Role: rec.Type, Time: rec.Timestamp, Text: rec.Summary}
+	if rec.Message.Role != "" {
+		e.Role = rec.Message.Role
+	}
+	if e.Text == "" {
+		e.Text = contentText(rec.Message.Content)
+	}
+	if e.Text == "" {
+		e.Text = "[" + rec.Type + "]"
+	}
+	return e
+}
+
+// contentText describes message content, which is a string or a list of blocks.
+func contentText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return strings.TrimSpace(text)
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return ""
+	}
+	var parts []string
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			parts = append(parts, strings.TrimSpace(b.Text))
+		case "tool_use":
+			parts = append(parts, "[tool: "+b.Name+"]")
+		case "tool_result":
+			parts = append(parts, "[tool result]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// historyEntry parses a line of history.jsonl.
+func historyEntry(line string) Entry {
+	var rec struct {
+		Display   string `json:"display"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		return Entry{Text: line}
+	}
+	e := Entry{Role: "prompt", Text: rec.Display}
+	if rec.Timestamp > 0 {
+		e.Time = time.UnixMilli(rec.Timestamp)
+	}
+	return e
+}
+
+// todoEntries parses a todo list, a JSON array of items.
+func todoEntries(data []byte) ([]Entry, bool) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, false
+	}
+	entries := make([]Entry, 0, len(items))
+	for _, raw := range items {
+		var item struct {
+			Content string `json:"content"`
+			Status  string `json:"status"`
+		}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, false
+		}
+		var key bytes.Buffer
+		if err := json.Compact(&key, raw); err != nil {
+			return nil, false
+		}
+		entries = append(entries, Entry{Role: item.Status, Text: item.Content, key: key.String()})
+	}
+	return entries, true
+}
+
+// Statuses of a FileDiff.
+const (
+	FileAdded   = "added"
+	FileRemoved = "removed"
+	Appended    = "appended"
+	Rewritten   = "rewritten"
+)
+
+// FileDiff describes how one file differs between two sides.
+type FileDiff struct {
+	Path string
+	// Session reports whether the file is a session transcript.
+	Session bool
+	Status  string
+	// Kept is the number of leading entries both sides share.
+	Kept    int
+	Added   []Entry
+	Removed []Entry
+}
+
+// DiffEntries compares the records of a file before and after a change.
+// It returns nil if they are equal.
+func DiffEntries(relPath string, a, b []Entry) *FileDiff {
+	_, isSession := Parse(relPath)
+	d := &FileDiff{Path: relPath, Session: isSession}
+	for d.Kept < len(a) && d.Kept < len(b) && a[d.Kept].key == b[d.Kept].key {
+		d.Kept++
+	}
+	if d.Kept == len(a) {
+		if d.Kept == len(b) {
+			return nil
+		}
+		d.Status, d.Added = Appended, b[d.Kept:]
+		return d
+	}
+
+	// Everything after the shared prefix, minus entries that only moved
+	d.Status = Rewritten
+	remaining := map[string]int{}
+	for _, e := range b[d.Kept:] {
+		remaining[e.key]++
+	}
+	moved := map[string]int{}
+	for _, e := range a[d.Kept:] {
+		if remaining[e.key] > 0 {
+			remaining[e.key]--
+			moved[e.key]++
+			continue
+		}
+		d.Removed = append(d.Removed, e)
+	}
+	for _, e := range b[d.Kept:] {
+		if moved[e.key] > 0 {
+			moved[e.key]--
+			continue
+		}
+		d.Added = append(d.Added, e)
+	}
+	return d
+}
+
+// Side is a tree of Claude files, such as the source or a backup revision.
+type Side struct {
+	FS   storage.FS
+	Root string
+	// Transform, if set, rewrites file contents as they are read, such as
+	// the redaction a backup applies.
+	Transform func(relPath string, data []byte) ([]byte, error)
+	// Source marks the live source. A backup keeps the files the source
+	// has deleted, so files missing from it are not reported.
+	Source bool
+}
+
+// ReadFile returns the contents of a file below the side's root, transformed.
+func (s Side) ReadFile(relPath string) ([]byte, error) {
+	data, err := storage.ReadFile(s.FS, filepath.Join(s.Root, relPath))
+	if err != nil {
+		return nil, err
+	}
+	if s.Transform != nil {
+		return s.Transform(relPath, data)
+	}
+	return data, nil
+}
+
+// Compare returns the files accepted by filter that differ between a and b,
+// sorted by path.
+func Compare(a, b Side, filter *sync.Filter) ([]FileDiff, error) {
+	filesA, err := listSide(a, filter)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := listSide(b, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for name := range filesA {
+		names[name] = true
+	}
+	for name := range filesB {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diffs []FileDiff
+	for _, name := range sorted {
+		sizeA, inA := filesA[name]
+		sizeB, inB := filesB[name]
+		if (!inA && a.Source) || (!inB && b.Source) {
+			continue
+		}
+		if inA && inB && sizeA == sizeB && sameContent(a, b, name) {
+			continue
+		}
+
+		var dataA, dataB []byte
+		if inA {
+			if dataA, err = a.ReadFile(name); err != nil {
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+		}
+		if inB {
+			if dataB, err = b.ReadFile(name); err != nil {
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+		}
+		if inA && inB && bytes.Equal(dataA, dataB) {
+			continue
+		}
+
+		d := DiffEntries(name, Entries(name, dataA), Entries(name, dataB))
+		if d == nil {
+			continue // only blank lines changed
+		}
+		switch {
+		case !inA:
+			d.Status = FileAdded
+		case !inB:
+			d.Status = FileRemoved
+		}
+		diffs = append(diffs, *d)
+	}
+	return diffs, nil
+}
+
+// sameContent reports whether both sides store the same hash for a file,
+// such as the same git blob, so that it need not be read.
+func sameContent(a, b Side, name string) bool {
+	if a.Transform != nil || b.Transform != nil {
+		return false
+	}
+	hashA, ok := a.FS.(storage.Hasher)
+	if !ok {
+		return false
+	}
+	hashB, ok := b.FS.(storage.Hasher)
+	if !ok {
+		return false
+	}
+	algoA, sumA, err := hashA.ContentHash(filepath.Join(a.Root, name))
+	if err != nil || sumA == "" {
+		return false
+	}
+	algoB, sumB, err := hashB.ContentHash(filepath.Join(b.Root, name))
+	if err != nil {
+		return false
+	}
+	return algoA == algoB && sumA == sumB
+}
+
+// listSide returns the slash-separated paths of the files on a side
+// with their sizes.
+func listSide(s Side, filter *sync.Filter) (map[string]int64, error) {
+	listed, err := sync.List(s.FS, s.Root, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(listed.Warnings) > 0 {
+		w := listed.Warnings[0]
+		return nil, fmt.Errorf("%s: %w", w.RelPath, w.Err)
+	}
+	files := make(map[string]int64, len(listed.Items))
+	for _, item := range listed.Items {
+		files[filepath.ToSlash(item.RelPath)] = item.Size
+	}
+	return files, nil
+}
@@ -0,0 +1,323 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// Format is an output format of Render.
+type Format string
+
+// Supported render formats.
+const (
+	FormatMarkdown Format = "md"
+	FormatHTML     Format = "html"
+)
+
+// ParseFormat parses a render format name.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "md", "markdown":
+		return FormatMarkdown, nil
+	case "html":
+		return FormatHTML, nil
+	}
+	return "", fmt.Errorf("unknown format %q, want md or html", name)
+}
+
+// Ext returns the file extension of the format.
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
+// Field is a metadata line shown under the title.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Subagent is a subagent transcript stored next to its session.
+type Subagent struct {
+	Name       string
+	Transcript *Transcript
+}
+
+// RenderOptions controls Render.
+type RenderOptions struct {
+	Title  string
+	Fields []Field
+	// Thinking includes the assistant's thinking blocks.
+	Thinking  bool
+	Subagents []Subagent
+}
+
+// Render writes t as a Markdown or HTML document.
+func Render(w io.Writer, t *Transcript, format Format, opts RenderOptions) error {
+	doc := buildDocument(t, opts)
+	if format == FormatHTML {
+		return htmlTemplate.Execute(w, doc)
+	}
+	bw := bufio.NewWriter(w)
+	writeMarkdown(bw, doc)
+	return bw.Flush()
+}
+
+// document is a transcript prepared for rendering.
+type document struct {
+	Title     string
+	Summary   string
+	Fields    []Field
+	Sections  []section
+	Subagents []subagentSection
+}
+
+type subagentSection struct {
+	Name     string
+	Sections []section
+}
+
+// section is a turn, or consecutive subagent turns if Sidechain is set.
+type section struct {
+	Turn      turn
+	Sidechain []turn
+}
+
+type turn struct {
+	Role  string
+	Time  string
+	Parts []part
+}
+
+type part struct {
+	Kind string
+	Text string
+	Tool string
+	// Output is the result of a tool use, if it was recorded.
+	Output    string
+	HasOutput bool
+	IsError   bool
+}
+
+func buildDocument(t *Transcript, opts RenderOptions) document {
+	doc := document{
+		Title:    opts.Title,
+		Summary:  t.Summary,
+		Fields:   opts.Fields,
+		Sections: buildSections(t, opts.Thinking),
+	}
+	for _, s := range opts.Subagents {
+		doc.Subagents = append(doc.Subagents, subagentSection{Name: s.Name, Sections: buildSections(s.Transcript, opts.Thinking)})
+	}
+	return doc
+}
+
+// buildSections pairs tool uses with their results and groups subagent turns.
+func buildSections(t *Transcript, thinking bool) []section {
+	results := t.Results()
+	used := map[string]bool{}
+	for _, m := range t.Messages {
+		for _, p := range m.Parts {
+			if p.Kind == PartToolUse {
+				used[p.ID] = true
+			}
+		}
+	}
+
+	var sections []section
+	for _, m := range t.Messages {
+		tr := turn{Role: m.Role, Time: formatTime(m.Time)}
+		for _, p := range m.Parts {
+			switch {
+			case p.Kind == PartThinking && !thinking:
+				continue
+			case p.Kind == PartToolResult && used[p.ID]:
+				continue // shown with its tool use
+			}
+			rp := part{Kind: p.Kind, Text: p.Text, Tool: p.Tool, IsError: p.IsError}
+			if p.Kind == PartToolUse {
+				if r, ok := results[p.ID]; ok {
+					rp.Output, rp.HasOutput, rp.IsError = r.Text, true, r.IsError
+				}
+			}
+			tr.Parts = append(tr.Parts, rp)
+		}
+		if len(tr.Parts) == 0 {
+			continue
+		}
+
+		if !m.Sidechain {
+			sections = append(sections, section{Turn: tr})
+			continue
+		}
+		if n := len(sections); n > 0 && sections[n-1].Sidechain != nil {
+			sections[n-1].Sidechain = append(sections[n-1].Sidechain, tr)
+		} else {
+			sections = append(sections, section{Sidechain: []turn{tr}})
+		}
+	}
+	return sections
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// Title returns the heading of a turn.
+func (t turn) Title() string {
+	title := strings.ToUpper(t.Role[:1]) + t.Role[1:]
+	if t.Time != "" {
+		title += " · " + t.Time
+	}
+	return title
+}
+
+// ToolTitle returns the summary line of a tool use or orphan tool result.
+func (p part) ToolTitle() string {
+	title := "Tool result"
+	if p.Kind == PartToolUse {
+		title = "Tool: " + p.Tool
+	}
+	if p.IsError {
+		title += " (error)"
+	}
+	return title
+}
+
+func writeMarkdown(w io.Writer, doc document) {
+	fmt.Fprintf(w, "# %s\n\n", doc.Title)
+	if doc.Summary != "" {
+		fmt.Fprintf(w, "%s\n\n", doc.Summary)
+	}
+	for _, f := range doc.Fields {
+		fmt.Fprintf(w, "- %s: %s\n", f.Name, f.Value)
+	}
+	if len(doc.Fields) > 0 {
+		fmt.Fprintln(w)
+	}
+	writeMarkdownSections(w, doc.Sections, "##")
+
+	for _, s := range doc.Subagents {
+		fmt.Fprintf(w, "## Subagent %s\n\n<details>\n<summary>%d turns</summary>\n\n", s.Name, countTurns(s.Sections))
+		writeMarkdownSections(w, s.Sections, "###")
+		fmt.Fprint(w, "</details>\n\n")
+	}
+}
+
+func writeMarkdownSections(w io.Writer, sections []section, heading string) {
+	for _, s := range sections {
+		if s.Sidechain == nil {
+			writeMarkdownTurn(w, s.Turn, heading)
+			continue
+		}
+		fmt.Fprintf(w, "<details>\n<summary>Subagent (%d turns)</summary>\n\n", len(s.Sidechain))
+		for _, t := range s.Sidechain {
+			writeMarkdownTurn(w, t, heading+"#")
+		}
+		fmt.Fprint(w, "</details>\n\n")
+	}
+}
+
+func writeMarkdownTurn(w io.Writer, t turn, heading string) {
+	fmt.Fprintf(w, "%s %s\n\n", heading, t.Title())
+	for _, p := range t.Parts {
+		switch p.Kind {
+		case PartText:
+			fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(p.Text))
+		case PartThinking:
+			fmt.Fprintf(w, "<details>\n<summary>Thinking</summary>\n\n%s\n\n</details>\n\n", strings.TrimSpace(p.Text))
+		case PartToolUse:
+			fmt.Fprintf(w, "<details>\n<summary>%s</summary>\n\n**Input**\n\n%s\n", p.ToolTitle(), fenced(p.Text, "json"))
+			if p.HasOutput {
+				fmt.Fprintf(w, "**Output**\n\n%s\n", fenced(p.Output, ""))
+			}
+			fmt.Fprint(w, "</details>\n\n")
+		case PartToolResult:
+			fmt.Fprintf(w, "<details>\n<summary>%s</summary>\n\n%s\n</details>\n\n", p.ToolTitle(), fenced(p.Text, ""))
+		}
+	}
+}
+
+// fenced wraps text in a code fence longer than any backtick run inside it.
+func fenced(text, lang string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n"
+}
+
+func countTurns(sections []section) int {
+	n := 0
+	for _, s := range sections {
+		if s.Sidechain != nil {
+			n += len(s.Sidechain)
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+var htmlTemplate = template.Must(template.New("session").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 56rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; }
+.turn { border-left: 4px solid #ccc; padding: 0 1rem; margin: 1.5rem 0; }
+.user { border-color: #2f6fdf; }
+.assistant { border-color: #d97706; }
+.sidechain { margin-left: 2rem; }
+h2, h3 { font-size: 1rem; margin: 0.5rem 0; }
+.text { white-space: pre-wrap; }
+pre { background: #f5f5f5; padding: 0.5rem; overflow-x: auto; white-space: pre-wrap; }
+details { margin: 0.5rem 0; }
+summary { cursor: pointer; color: #555; }
+.error summary { color: #b91c1c; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{with .Summary}}<p>{{.}}</p>
+{{end}}{{with .Fields}}<ul>
+{{range .}}<li>{{.Name}}: {{.Value}}</li>
+{{end}}</ul>
+{{end}}{{template "sections" .Sections}}
+{{range .Subagents}}<h2>Subagent {{.Name}}</h2>
+<details class="sidechain">
+<summary>Show turns</summary>
+{{template "sections" .Sections}}
+</details>
+{{end}}</body>
+</html>
+{{define "sections"}}{{range .}}{{if .Sidechain}}<details class="sidechain">
+<summary>Subagent ({{len .Sidechain}} turns)</summary>
+{{range .Sidechain}}{{template "turn" .}}{{end}}</details>
+{{else}}{{template "turn" .Turn}}{{end}}{{end}}{{end}}
+{{define "turn"}}<div class="turn {{.Role}}">
+<h2>{{.Title}}</h2>
+{{range .Parts}}{{if eq .Kind "text"}}<div class="text">{{.Text}}</div>
+{{else if eq .Kind "thinking"}}<details><summary>Thinking</summary><div class="text">{{.Text}}</div></details>
+{{else}}<details{{if .IsError}} class="error"{{end}}><summary>{{.ToolTitle}}</summary>
+{{if eq .Kind "tool_use"}}<h3>Input</h3>
+<pre>{{.Text}}</pre>
+{{if .HasOutput}}<h3>Output</h3>
+<pre>{{.Output}}</pre>
+{{end}}{{else}}<pre>{{.Text}}</pre>
+{{end}}</details>
+{{end}}{{end}}</div>
+{{end}}`))
@@ -0,0 +1,110 @@
+// Package session reads Claude Code session transcripts.
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Ref identifies a session transcript stored at projects/<Project>/<ID>.jsonl.
+// Project is the directory name Claude Code derives from the working directory.
+// Host is set for a transcript in a backup namespaced by host.
+type Ref struct {
+	Host    string
+	Project string
+	ID      string
+}
+
+// Parse returns the session stored at relPath, a path relative to the
+// Claude directory or to the root of a backup, if it is a session transcript.
+func Parse(relPath string) (Ref, bool) {
+	host, rel := SplitHost(relPath)
+	parts := strings.Split(rel, "/")
+	if len(parts) != 3 || parts[0] != "projects" || path.Ext(parts[2]) != ".jsonl" {
+		return Ref{}, false
+	}
+	id := strings.TrimSuffix(parts[2], ".jsonl")
+	if parts[1] == "" || id == "" {
+		return Ref{}, false
+	}
+	return Ref{Host: host, Project: parts[1], ID: id}, true
+}
+
+// HostsDir holds the data of each machine in a backup namespaced by host.
+const HostsDir = "hosts"
+
+// SplitHost splits a slash-separated hosts/<host>/<rest> into host and rest.
+// Other paths have no host and are returned unchanged.
+func SplitHost(relPath string) (host, rest string) {
+	rel := filepath.ToSlash(relPath)
+	if after, ok := strings.CutPrefix(rel, HostsDir+"/"); ok {
+		if host, rest, ok := strings.Cut(after, "/"); ok && host != "" {
+			return host, rest
+		}
+	}
+	return "", rel
+}
+
+// maxLine bounds a transcript line; tool results can be large.
+const maxLine = 64 << 20
+
+// record is the part of a transcript line that FirstPrompt needs.
+type record struct {
+	Type    string `json:"type"`
+	IsMeta  bool   `json:"isMeta"`
+	Message struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"message"`
+}
+
+// FirstPrompt returns the text of the first prompt the user typed in a
+// transcript, skipping tool results, slash command output and other
+// generated messages. It returns "" if there is none.
+// Lines that are not valid JSON are ignored.
+func FirstPrompt(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		if rec.Type != "user" || rec.IsMeta {
+			continue
+		}
+		if text := promptText(rec.Message.Content); text != "" {
+			return text, nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// promptText extracts typed text from message content, which is either
+// a string or a list of content blocks.
+func promptText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err != nil {
+		var blocks []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(content, &blocks); err != nil {
+			return ""
+		}
+		for _, b := range blocks {
+			if b.Type == "text" {
+				text = b.Text
+				break
+			}
+		}
+	}
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "<command-") || strings.HasPrefix(text, "<local-command-") {
+		return ""
+	}
+	return text
+}
@@ -0,0 +1,231 @@
+package session
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+func TestParse(t *testing.T) {
+	ref, ok := Parse("projects/-Users-me-app/0b4f.jsonl")
+	require.True(t, ok)
+	assert.Equal(t, Ref{Project: "-Users-me-app", ID: "0b4f"}, ref)
+	ref, ok = Parse("hosts/laptop/projects/-Users-me-app/0b4f.jsonl")
+	require.True(t, ok)
+	assert.Equal(t, Ref{Host: "laptop", Project: "-Users-me-app", ID: "0b4f"}, ref)
+
+	for _, p := range []string{
+		"history.jsonl",
+		"projects/-Users-me-app/notes.txt",
+		"projects/-Users-me-app/0b4f/subagent.jsonl",
+		"projects/.jsonl",
+		"todos/a.jsonl",
+		"hosts/projects/-Users-me-app/0b4f.jsonl",
+	} {
+		_, ok := Parse(p)
+		assert.False(t, ok, p)
+	}
+
+	host, rest := SplitHost("hosts/laptop/history.jsonl")
+	assert.Equal(t, "laptop", host)
+	assert.Equal(t, "history.jsonl", rest)
+	host, rest = SplitHost("hosts/laptop")
+	assert.Equal(t, "", host)
+	assert.Equal(t, "hosts/laptop", rest)
+}
+
+func TestFirstPrompt(t *testing.T) {
+	transcript := strings.Join([]string{
+		`{"type":"summary","summary":"Fix tests"}`,
+		`not json`,
+		`{"type":"user","isMeta":true,"message":{"role":"user","content":"Caveat: generated"}}`,
+		`{"type":"user","message":{"role":"user","content":"<command-name>/clear</command-name>"}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","content":"ok"}]}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"text","text":"  Fix the flaky test\n"}]}}`,
+		`{"type":"user","message":{"role":"user","content":"second"}}`,
+	}, "\n")
+
+	prompt, err := FirstPrompt(strings.NewReader(transcript))
+	require.NoError(t, err)
+	assert.Equal(t, "Fix the flaky test", prompt)
+
+	prompt, err = FirstPrompt(strings.NewReader(`{"type":"user","message":{"content":"plain"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "plain", prompt)
+
+	prompt, err = FirstPrompt(strings.NewReader(`{"type":"assistant","message":{"content":"hi"}}`))
+	require.NoError(t, err)
+	assert.Empty(t, prompt)
+}
+
+func TestEntries(t *testing.T) {
+	msgs := Entries("projects/p/s.jsonl", []byte(strings.Join([]string{
+		`{"type":"user","timestamp":"2024-09-01T10:00:00Z","message":{"role":"user","content":"hello"}}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hi"},{"type":"tool_use","name":"Bash"}]}}`,
+		`{"type":"summary","summary":"Greeting"}`,
+		``,
+	}, "\n")))
+	require.Len(t, msgs, 3)
+	assert.Equal(t, "user", msgs[0].Role)
+	assert.True(t, msgs[0].Time.Equal(time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "hi [tool: Bash]", msgs[1].Text)
+	assert.Equal(t, "Greeting", msgs[2].Text)
+
+	history := Entries("history.jsonl", []byte(`{"display":"fix it","timestamp":1725184800000,"project":"/work"}`))
+	require.Len(t, history, 1)
+	assert.Equal(t, "prompt", history[0].Role)
+	assert.Equal(t, "fix it", history[0].Text)
+	assert.Equal(t, int64(1725184800000), history[0].Time.UnixMilli())
+
+	todos := Entries("todos/a.json", []byte("[\n  {\"content\": \"write tests\", \"status\": \"pending\"}\n]"))
+	require.Len(t, todos, 1)
+	assert.Equal(t, Entry{Role: "pending", Text: "write tests", key: `{"content":"write tests","status":"pending"}`}, todos[0])
+
+	lines := Entries("plans/p.md", []byte("# Plan\n\n- step\n"))
+	assert.Len(t, lines, 2)
+}
+
+func TestCompare(t *testing.T) {
+	fsA, fsB := storage.NewMemFS(), storage.NewMemFS()
+	write := func(fsys storage.FS, name, content string) {
+		require.NoError(t, fsys.WriteFile(name, strings.NewReader(content), 0644, time.Now()))
+	}
+	line := func(text string) string {
+		return `{"type":"user","message":{"role":"user","content":"` + text + `"}}` + "\n"
+	}
+	write(fsA, "a/projects/p/same.jsonl", line("x"))
+	write(fsB, "b/projects/p/same.jsonl", line("x"))
+	write(fsA, "a/projects/p/grow.jsonl", line("one"))
+	write(fsB, "b/projects/p/grow.jsonl", line("one")+line("two"))
+	write(fsA, "a/projects/p/edit.jsonl", line("one")+line("two")+line("three"))
+	write(fsB, "b/projects/p/edit.jsonl", line("one")+line("three")+line("TWO"))
+	write(fsA, "a/projects/p/gone.jsonl", line("bye"))
+	write(fsB, "b/projects/p/new.jsonl", line("new"))
+	write(fsB, "b/history.jsonl", `{"display":"SECRET"}`+"\n")
+	write(fsB, "b/ignored.txt", "x")
+
+	redact := func(relPath string, data []byte) ([]byte, error) {
+		return bytes.ReplaceAll(data, []byte("SECRET"), []byte("***")), nil
+	}
+	diffs, err := Compare(Side{FS: fsA, Root: "a"}, Side{FS: fsB, Root: "b", Transform: redact},
+		sync.NewFilter([]string{"projects", "history.jsonl"}))
+	require.NoError(t, err)
+	require.Len(t, diffs, 5)
+
+	assert.Equal(t, "history.jsonl", diffs[0].Path)
+	assert.False(t, diffs[0].Session)
+	assert.Equal(t, FileAdded, diffs[0].Status)
+	assert.Equal(t, "***", diffs[0].Added[0].Text)
+
+	assert.Equal(t, "projects/p/edit.jsonl", diffs[1].Path)
+	assert.Equal(t, Rewritten, diffs[1].Status)
+	assert.Equal(t, 1, diffs[1].Kept)
+	require.Len(t, diffs[1].Removed, 1)
+	assert.Equal(t, "two", diffs[1].Removed[0].Text)
+	require.Len(t, diffs[1].Added, 1)
+	assert.Equal(t, "TWO", diffs[1].Added[0].Text)
+
+	assert.Equal(t, "projects/p/gone.jsonl", diffs[2].Path)
+	assert.Equal(t, FileRemoved, diffs[2].Status)
+	assert.Len(t, diffs[2].Removed, 1)
+
+	assert.Equal(t, "projects/p/grow.jsonl", diffs[3].Path)
+	assert.True(t, diffs[3].Session)
+	assert.Equal(t, Appended, diffs[3].Status)
+	require.Len(t, diffs[3].Added, 1)
+	assert.Equal(t, "two", diffs[3].Added[0].Text)
+
+	assert.Equal(t, "projects/p/new.jsonl", diffs[4].Path)
+	assert.Equal(t, FileAdded, diffs[4].Status)
+
+	// The source keeps growing, and backups keep what it deleted
+	diffs, err = Compare(Side{FS: fsA, Root: "a"}, Side{FS: fsB, Root: "b", Transform: redact, Source: true},
+		sync.NewFilter([]string{"projects", "history.jsonl"}))
+	require.NoError(t, err)
+	require.Len(t, diffs, 4)
+	for _, d := range diffs {
+		assert.NotEqual(t, FileRemoved, d.Status, d.Path)
+	}
+}
+
+// hashFS reports fixed content hashes, like a git tree or a CAS snapshot.
+type hashFS struct {
+	storage.FS
+	sums map[string]string
+}
+
+func (h hashFS) ContentHash(name string) (string, string, error) {
+	return "git", h.sums[name], nil
+}
+
+func TestCompare_SkipsSameHash(t *testing.T) {
+	fsA, fsB := storage.NewMemFS(), storage.NewMemFS()
+	require.NoError(t, fsA.WriteFile("a/history.jsonl", strings.NewReader(`{"display":"one"}`+"\n"), 0644, time.Now()))
+	require.NoError(t, fsB.WriteFile("b/history.jsonl", strings.NewReader(`{"display":"two"}`+"\n"), 0644, time.Now()))
+	filter := sync.NewFilter([]string{"history.jsonl"})
+
+	// Equal hashes are trusted without reading the files
+	a := Side{FS: hashFS{fsA, map[string]string{"a/history.jsonl": "1234"}}, Root: "a"}
+	b := Side{FS: hashFS{fsB, map[string]string{"b/history.jsonl": "1234"}}, Root: "b"}
+	diffs, err := Compare(a, b, filter)
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	b.FS = hashFS{fsB, map[string]string{"b/history.jsonl": "5678"}}
+	diffs, err = Compare(a, b, filter)
+	require.NoError(t, err)
+	assert.Len(t, diffs, 1)
+}
+
+func TestReadTranscriptAndRender(t *testing.T) {
+	data := strings.Join([]string{
+		`{"type":"summary","summary":"Fix flaky test"}`,
+		`{"type":"user","isMeta":true,"message":{"role":"user","content":"Caveat: generated"}}`,
+		`{"type":"user","timestamp":"2024-09-01T10:00:00Z","message":{"role":"user","content":"Fix the <flaky> test"}}`,
+		`{"type":"assistant","timestamp":"2024-09-01T10:00:05Z","message":{"role":"assistant","content":[` +
+			`{"type":"thinking","thinking":"Look at the test first"},` +
+			`{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"go test ./..."}}]}}`,
+		`{"type":"user","timestamp":"2024-09-01T10:00:09Z","message":{"role":"user","content":[` +
+			`{"type":"tool_result","tool_use_id":"t1","content":"ok ` + "```" + ` done"}]}}`,
+		`{"type":"assistant","isSidechain":true,"message":{"role":"assistant","content":"Subagent reply"}}`,
+		`not json`,
+	}, "\n")
+	tr, err := ReadTranscript(strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "Fix flaky test", tr.Summary)
+	require.Len(t, tr.Messages, 4)
+	assert.Equal(t, []Part{{Kind: PartText, Text: "Fix the <flaky> test"}}, tr.Messages[0].Parts)
+	assert.Equal(t, PartToolUse, tr.Messages[1].Parts[1].Kind)
+	assert.Contains(t, tr.Messages[1].Parts[1].Text, `"command": "go test ./..."`)
+	assert.True(t, tr.Messages[3].Sidechain)
+
+	opts := RenderOptions{Title: "Session s1", Fields: []Field{{Name: "Project", Value: "-work-app"}}}
+	var md bytes.Buffer
+	require.NoError(t, Render(&md, tr, FormatMarkdown, opts))
+	assert.Contains(t, md.String(), "# Session s1\n\nFix flaky test\n\n- Project: -work-app\n")
+	assert.Contains(t, md.String(), "<summary>Tool: Bash</summary>")
+	assert.Contains(t, md.String(), "````\nok ``` done\n````")
+	assert.Contains(t, md.String(), "<summary>Subagent (1 turns)</summary>")
+	assert.NotContains(t, md.String(), "Look at the test first")
+	// The tool result is shown with its tool use, not as a turn of its own
+	assert.Equal(t, 1, strings.Count(md.String(), "## User"))
+
+	opts.Thinking = true
+	var html bytes.Buffer
+	require.NoError(t, Render(&html, tr, FormatHTML, opts))
+	assert.Contains(t, html.String(), "Fix the &lt;flaky&gt; test")
+	assert.Contains(t, html.String(), "Look at the test first")
+	assert.Contains(t, html.String(), "<summary>Tool: Bash</summary>")
+
+	format, err := ParseFormat("markdown")
+	require.NoError(t, err)
+	assert.Equal(t, ".md", format.Ext())
+	_, err = ParseFormat("pdf")
+	assert.Error(t, err)
+}
@@ -0,0 +1,173 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// Part kinds of a Message.
+const (
+	PartText       = "text"
+	PartThinking   = "thinking"
+	PartToolUse    = "tool_use"
+	PartToolResult = "tool_result"
+)
+
+// Part is one content block of a message.
+type Part struct {
+	Kind string
+	Text string
+	// Tool and ID name a tool use; a tool result refers to it by ID.
+	Tool    string
+	ID      string
+	IsError bool
+}
+
+// Message is a user or assistant turn of a transcript.
+type Message struct {
+	Role string
+	Time time.Time
+	// Sidechain marks messages of a subagent run inside the session.
+	Sidechain bool
+	Parts     []Part
+}
+
+// Transcript is a parsed session.
+type Transcript struct {
+	Summary  string
+	Messages []Message
+}
+
+// ReadTranscript parses a session transcript. Generated lines such as
+// caveats are skipped, as are lines that are not valid JSON.
+func ReadTranscript(r io.Reader) (*Transcript, error) {
+	t := &Transcript{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	for scanner.Scan() {
+		var rec struct {
+			Type        string    `json:"type"`
+			IsMeta      bool      `json:"isMeta"`
+			IsSidechain bool      `json:"isSidechain"`
+			Timestamp   time.Time `json:"timestamp"`
+			Summary     string    `json:"summary"`
+			Message     struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.IsMeta {
+			continue
+		}
+		switch rec.Type {
+		case "summary":
+			if t.Summary == "" {
+				t.Summary = rec.Summary
+			}
+		case "user", "assistant":
+			parts := parseParts(rec.Message.Content)
+			if len(parts) == 0 {
+				continue
+			}
+			t.Messages = append(t.Messages, Message{
+				Role:      rec.Type,
+				Time:      rec.Timestamp,
+				Sidechain: rec.IsSidechain,
+				Parts:     parts,
+			})
+		}
+	}
+	return t, scanner.Err()
+}
+
+// parseParts converts message content, a string or a list of blocks.
+func parseParts(content json.RawMessage) []Part {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		return []Part{{Kind: PartText, Text: text}}
+	}
+
+	var blocks []struct {
+		Type      string          `json:"type"`
+		Text      string          `json:"text"`
+		Thinking  string          `json:"thinking"`
+		ID        string          `json:"id"`
+		Name      string          `json:"name"`
+		Input     json.RawMessage `json:"input"`
+		ToolUseID string          `json:"tool_use_id"`
+		Content   json.RawMessage `json:"content"`
+		IsError   bool            `json:"is_error"`
+	}
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return nil
+	}
+	var parts []Part
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			if strings.TrimSpace(b.Text) != "" {
+				parts = append(parts, Part{Kind: PartText, Text: b.Text})
+			}
+		case "thinking":
+			parts = append(parts, Part{Kind: PartThinking, Text: b.Thinking})
+		case "tool_use":
+			parts = append(parts, Part{Kind: PartToolUse, Tool: b.Name, ID: b.ID, Text: indentJSON(b.Input)})
+		case "tool_result":
+			parts = append(parts, Part{Kind: PartToolResult, ID: b.ToolUseID, Text: resultText(b.Content), IsError: b.IsError})
+		}
+	}
+	return parts
+}
+
+// indentJSON pretty-prints tool input.
+func indentJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+// resultText returns the text of a tool result, a string or a list of blocks.
+func resultText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return string(content)
+	}
+	var parts []string
+	for _, b := range blocks {
+		if b.Type == "text" {
+			parts = append(parts, b.Text)
+		} else {
+			parts = append(parts, "["+b.Type+"]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Results maps tool use IDs to their results.
+func (t *Transcript) Results() map[string]Part {
+	results := map[string]Part{}
+	for _, m := range t.Messages {
+		for _, p := range m.Parts {
+			if p.Kind == PartToolResult {
+				results[p.ID] = p
+			}
+		}
+	}
+	return results
+}
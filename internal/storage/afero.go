@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// AferoFS adapts an afero.Fs to FS.
+type AferoFS struct {
+	Fs afero.Fs
+}
+
+// NewOSFS returns an FS backed by the local file system.
+func NewOSFS() *AferoFS {
+	return &AferoFS{Fs: afero.NewOsFs()}
+}
+
+// NewMemFS returns an empty in-memory FS.
+func NewMemFS() *AferoFS {
+	return &AferoFS{Fs: afero.NewMemMapFs()}
+}
+
+// Open opens a file for reading.
+func (a *AferoFS) Open(name string) (io.ReadCloser, error) {
+	return a.Fs.Open(name)
+}
+
+// Stat returns file metadata.
+func (a *AferoFS) Stat(name string) (fs.FileInfo, error) {
+	return a.Fs.Stat(name)
+}
+
+// Walk walks the tree rooted at root.
+func (a *AferoFS) Walk(root string, fn filepath.WalkFunc) error {
+	return afero.Walk(a.Fs, root, fn)
+}
+
+// WriteFile writes to a temporary file next to name and renames it into place.
+func (a *AferoFS) WriteFile(name string, r io.Reader, perm fs.FileMode, modTime time.Time) error {
+	dir := filepath.Dir(name)
+	if err := a.Fs.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := afero.TempFile(a.Fs, dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		a.Fs.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		a.Fs.Remove(tmpName)
+		return err
+	}
+	if err := a.Fs.Chmod(tmpName, perm); err != nil {
+		a.Fs.Remove(tmpName)
+		return err
+	}
+	if err := a.Fs.Rename(tmpName, name); err != nil {
+		a.Fs.Remove(tmpName)
+		return err
+	}
+	return a.Fs.Chtimes(name, modTime, modTime)
+}
+
+// Remove deletes a file.
+func (a *AferoFS) Remove(name string) error {
+	return a.Fs.Remove(name)
+}
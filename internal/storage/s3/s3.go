@@ -0,0 +1,355 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata headers ccbackup stores on every object it writes.
+const (
+	metaMTime  = "X-Amz-Meta-Ccbackup-Mtime"
+	metaMode   = "X-Amz-Meta-Ccbackup-Mode"
+	metaSHA256 = "X-Amz-Meta-Ccbackup-Sha256"
+)
+
+// Config configures access to an S3-compatible service.
+type Config struct {
+	// Endpoint is the service URL, e.g. http://localhost:9000 for MinIO.
+	// Empty means AWS S3 in Region.
+	Endpoint string
+	Region   string
+	// PathStyle addresses buckets as endpoint/bucket instead of bucket.endpoint.
+	PathStyle   bool
+	Credentials Credentials
+	HTTPClient  *http.Client
+}
+
+// FS is a storage.FS backed by a single S3 bucket.
+// Names are object keys; directories exist only as key prefixes.
+type FS struct {
+	Bucket string
+	cfg    Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// New creates an FS for bucket.
+func New(bucket string, cfg Config) *FS {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &FS{Bucket: bucket, cfg: cfg, client: client, now: time.Now}
+}
+
+// IsURL reports whether raw is an s3:// URL.
+func IsURL(raw string) bool {
+	return strings.HasPrefix(raw, "s3://")
+}
+
+// ParseURL splits an s3://bucket/prefix URL into bucket and key prefix.
+func ParseURL(raw string) (bucket, prefix string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %q (want s3://bucket/prefix)", raw)
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
+
+// Open downloads an object.
+func (f *FS) Open(name string) (io.ReadCloser, error) {
+	resp, err := f.do(http.MethodGet, objectKey(name), nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return resp.Body, nil
+}
+
+// Stat returns object metadata.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	resp, err := f.do(http.MethodHead, objectKey(name), nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	resp.Body.Close()
+	return objectInfoFromHeader(name, resp.ContentLength, resp.Header), nil
+}
+
+// ContentHash returns the SHA-256 stored in object metadata,
+// falling back to the ETag, which is the MD5 of single-part uploads.
+func (f *FS) ContentHash(name string) (algo, sum string, err error) {
+	resp, err := f.do(http.MethodHead, objectKey(name), nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp.Body.Close()
+
+	if sum := resp.Header.Get(metaSHA256); sum != "" {
+		return "sha256", sum, nil
+	}
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if len(etag) == 32 && !strings.Contains(etag, "-") {
+		return "md5", etag, nil
+	}
+	return "", "", nil
+}
+
+// Walk lists every object under root and calls fn with its metadata.
+// fn is called for root itself first, as filepath.Walk does.
+// The metadata comes from the listing alone: the size, and the upload time
+// as the modification time. Stat returns the stored mtime and mode.
+func (f *FS) Walk(root string, fn filepath.WalkFunc) error {
+	prefix := objectKey(root)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	if err := fn(root, &objectInfo{name: path.Base(root), dir: true}, nil); err != nil {
+		if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+			return nil
+		}
+		return err
+	}
+
+	objects, err := f.list(prefix)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+
+	for _, obj := range objects {
+		info := &objectInfo{name: path.Base(obj.Key), size: obj.Size, modTime: obj.LastModified, mode: 0644}
+		if err := fn(obj.Key, info, nil); err != nil {
+			if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFile uploads the contents of r with a single PUT, which S3 applies atomically.
+// The body is spooled to a temporary file to compute its hash before signing.
+func (f *FS) WriteFile(name string, r io.Reader, perm fs.FileMode, modTime time.Time) error {
+	tmp, err := os.CreateTemp("", "ccbackup-s3-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	headers := http.Header{}
+	headers.Set(metaMTime, modTime.UTC().Format(time.RFC3339Nano))
+	headers.Set(metaMode, strconv.FormatUint(uint64(perm.Perm()), 8))
+	headers.Set(metaSHA256, sum)
+
+	resp, err := f.do(http.MethodPut, objectKey(name), nil, tmp, size, sum, headers)
+	if err != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Remove deletes an object.
+func (f *FS) Remove(name string) error {
+	resp, err := f.do(http.MethodDelete, objectKey(name), nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listedObject is an object in a ListObjectsV2 response.
+type listedObject struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// listResult is the ListObjectsV2 response body.
+type listResult struct {
+	Contents              []listedObject `xml:"Contents"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	NextContinuationToken string         `xml:"NextContinuationToken"`
+}
+
+// list returns all objects with the given prefix, in key order.
+func (f *FS) list(prefix string) ([]listedObject, error) {
+	var objects []listedObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := f.do(http.MethodGet, "", query, nil, 0, emptyPayloadHash, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode list response: %w", err)
+		}
+
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request and returns the response if its status is 2xx.
+func (f *FS) do(method, key string, query url.Values, body io.Reader, size int64, payloadHash string, headers http.Header) (*http.Response, error) {
+	u, err := f.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	if query != nil {
+		u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	}
+
+	if body != nil && size == 0 {
+		// Send an explicit zero length rather than a chunked body
+		body = http.NoBody
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, f.cfg.Credentials, f.cfg.Region, "s3", payloadHash, f.now())
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, responseError(resp)
+}
+
+// objectURL builds the request URL for key in path or virtual-hosted style.
+func (f *FS) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(f.cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	p := "/" + key
+	if f.cfg.PathStyle {
+		p = "/" + f.Bucket + p
+	} else {
+		u.Host = f.Bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + p
+	u.RawPath = canonicalURI(&url.URL{Path: u.Path})
+	return u, nil
+}
+
+// responseError converts a non-2xx response into an error.
+// A missing object satisfies errors.Is(err, fs.ErrNotExist).
+func responseError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return fs.ErrNotExist
+	}
+
+	var s3err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(data, &s3err) == nil && s3err.Code != "" {
+		return fmt.Errorf("s3: %s: %s", s3err.Code, s3err.Message)
+	}
+	return fmt.Errorf("s3: unexpected status %s", resp.Status)
+}
+
+// objectKey converts a file name into an object key.
+func objectKey(name string) string {
+	key := strings.Trim(filepath.ToSlash(name), "/")
+	if key == "." {
+		return ""
+	}
+	return key
+}
+
+// objectInfo implements fs.FileInfo for an object or key prefix.
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+	dir     bool
+}
+
+func objectInfoFromHeader(name string, size int64, h http.Header) *objectInfo {
+	info := &objectInfo{name: path.Base(filepath.ToSlash(name)), size: size, mode: 0644}
+
+	if t, err := time.Parse(time.RFC3339Nano, h.Get(metaMTime)); err == nil {
+		info.modTime = t
+	} else if t, err := http.ParseTime(h.Get("Last-Modified")); err == nil {
+		info.modTime = t
+	}
+	if m, err := strconv.ParseUint(h.Get(metaMode), 8, 32); err == nil {
+		info.mode = fs.FileMode(m).Perm()
+	}
+	return info
+}
+
+func (i *objectInfo) Name() string       { return i.name }
+func (i *objectInfo) Size() int64        { return i.size }
+func (i *objectInfo) ModTime() time.Time { return i.modTime }
+func (i *objectInfo) IsDir() bool        { return i.dir }
+func (i *objectInfo) Sys() any           { return nil }
+
+func (i *objectInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return i.mode
+}
@@ -0,0 +1,214 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/storage/s3/s3test"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+func newTestFS(t *testing.T) (*FS, *s3test.Server) {
+	t.Helper()
+	server := s3test.NewServer("backups")
+	t.Cleanup(server.Close)
+
+	fsys := New("backups", Config{
+		Endpoint:    server.URL,
+		PathStyle:   true,
+		Credentials: Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+	})
+	return fsys, server
+}
+
+func TestSignV4_GetVanilla(t *testing.T) {
+	// "get-vanilla" from the AWS Signature Version 4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	creds := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	signV4(req, creds, "us-east-1", "service", emptyPayloadHash, now)
+
+	assert.Equal(t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestParseURL(t *testing.T) {
+	bucket, prefix, err := ParseURL("s3://team-backups/alice/claude/")
+	require.NoError(t, err)
+	assert.Equal(t, "team-backups", bucket)
+	assert.Equal(t, "alice/claude", prefix)
+
+	_, _, err = ParseURL("s3:///nobucket")
+	assert.Error(t, err)
+}
+
+func TestFS_WriteStatOpenRemove(t *testing.T) {
+	fsys, server := newTestFS(t)
+	modTime := time.Date(2024, 1, 15, 14, 30, 0, 123, time.UTC)
+
+	name := "prefix/projects/-Users-me-app/session 1.jsonl"
+	require.NoError(t, fsys.WriteFile(name, strings.NewReader("hello"), 0600, modTime))
+	assert.Equal(t, []string{name}, server.Keys("backups"))
+
+	info, err := fsys.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size())
+	assert.True(t, info.ModTime().Equal(modTime))
+	assert.Equal(t, fs.FileMode(0600), info.Mode())
+
+	data, err := storage.ReadFile(fsys, name)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	algo, sum, err := fsys.ContentHash(name)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256", algo)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sum)
+
+	require.NoError(t, fsys.Remove(name))
+	_, err = fsys.Stat(name)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestFS_WriteEmptyFile(t *testing.T) {
+	fsys, server := newTestFS(t)
+
+	require.NoError(t, fsys.WriteFile("empty.json", strings.NewReader(""), 0644, time.Now()))
+	data, ok := server.Object("backups", "empty.json")
+	require.True(t, ok)
+	assert.Empty(t, data)
+}
+
+func TestFS_Walk_Paginates(t *testing.T) {
+	fsys, server := newTestFS(t)
+	server.MaxKeys = 2
+
+	for _, name := range []string{"root/a", "root/b/c", "root/d", "root/e", "other/x"} {
+		require.NoError(t, fsys.WriteFile(name, strings.NewReader(name), 0644, time.Now()))
+	}
+
+	var files []string
+	require.NoError(t, fsys.Walk("root", func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"root/a", "root/b/c", "root/d", "root/e"}, files)
+}
+
+func TestFS_Walk_UsesListing(t *testing.T) {
+	fsys, server := newTestFS(t)
+	modTime := time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
+	require.NoError(t, fsys.WriteFile("root/a.jsonl", strings.NewReader("hello"), 0600, modTime))
+
+	var infos []os.FileInfo
+	require.NoError(t, fsys.Walk("root", func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		if !info.IsDir() {
+			infos = append(infos, info)
+		}
+		return nil
+	}))
+	require.Len(t, infos, 1)
+	assert.Equal(t, "a.jsonl", infos[0].Name())
+	assert.Equal(t, int64(5), infos[0].Size())
+	// The listing has the upload time, not the stored mtime
+	assert.WithinDuration(t, time.Now(), infos[0].ModTime(), time.Minute)
+	assert.Zero(t, server.Requests(http.MethodHead))
+}
+
+func TestSyncer_BackupAndRestoreThroughS3(t *testing.T) {
+	fsys, server := newTestFS(t)
+	src := t.TempDir()
+	restored := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "projects"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "projects", "session.jsonl"), []byte("data1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "history.jsonl"), []byte("data2"), 0644))
+
+	patterns := []string{"projects", "history.jsonl"}
+	ctx := context.Background()
+
+	backup := sync.NewSyncer(src, "claude", patterns)
+	backup.DstFS = fsys
+	result, err := backup.Execute(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.CopiedCount)
+	assert.Equal(t, []string{"claude/history.jsonl", "claude/projects/session.jsonl"}, server.Keys("backups"))
+
+	// Unchanged files are not uploaded again
+	plan, err := backup.Plan(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Items)
+
+	// A touched but identical file is detected by its content hash
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(src, "history.jsonl"), later, later))
+	plan, err = backup.Plan(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Items)
+
+	restore := sync.NewSyncer("claude", restored, patterns)
+	restore.SrcFS = fsys
+	result, err = restore.Execute(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.CopiedCount)
+
+	content, err := os.ReadFile(filepath.Join(restored, "projects", "session.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, "data1", string(content))
+}
+
+// TestFS_MinIO runs against a real S3-compatible server when configured, e.g.
+//
+//	CCBACKUP_TEST_S3_ENDPOINT=http://localhost:9000 CCBACKUP_TEST_S3_BUCKET=test \
+//	AWS_ACCESS_KEY_ID=minioadmin AWS_SECRET_ACCESS_KEY=minioadmin go test ./internal/storage/s3
+func TestFS_MinIO(t *testing.T) {
+	endpoint := os.Getenv("CCBACKUP_TEST_S3_ENDPOINT")
+	bucket := os.Getenv("CCBACKUP_TEST_S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		t.Skip("CCBACKUP_TEST_S3_ENDPOINT and CCBACKUP_TEST_S3_BUCKET not set")
+	}
+
+	fsys := New(bucket, Config{
+		Endpoint:  endpoint,
+		PathStyle: true,
+		Credentials: Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		},
+	})
+
+	name := "ccbackup-test/" + time.Now().Format("20060102T150405.000000000") + "/a b+c.jsonl"
+	require.NoError(t, fsys.WriteFile(name, strings.NewReader("hello"), 0644, time.Now()))
+	t.Cleanup(func() { fsys.Remove(name) })
+
+	data, err := storage.ReadFile(fsys, name)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	var found bool
+	require.NoError(t, fsys.Walk(filepath.Dir(name), func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		found = found || path == name
+		return nil
+	}))
+	assert.True(t, found)
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// FS is the file system a Syncer reads from or writes to.
+// Paths are slash- or OS-separated names rooted in the FS.
+type FS interface {
+	// Open opens a file for reading.
+	Open(name string) (io.ReadCloser, error)
+	// Stat returns file metadata, or an error satisfying
+	// errors.Is(err, fs.ErrNotExist) if the file does not exist.
+	Stat(name string) (fs.FileInfo, error)
+	// Walk walks the tree rooted at root like filepath.Walk.
+	Walk(root string, fn filepath.WalkFunc) error
+	// WriteFile atomically replaces name with the contents of r,
+	// creating parent directories and setting its modification time.
+	WriteFile(name string, r io.Reader, perm fs.FileMode, modTime time.Time) error
+	// Remove deletes a file.
+	Remove(name string) error
+}
+
+// ReadFile reads the whole file from fsys.
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Hasher is implemented by file systems that store a content hash per file,
+// so unchanged files can be detected without relying on mtimes.
+type Hasher interface {
+	// ContentHash returns the stored hash of name and its algorithm
+	// ("sha256", "md5", or "git" for a git blob id), or empty strings if
+	// none is known.
+	ContentHash(name string) (algo, sum string, err error)
+}
+
+// HashFile computes the hex digest of a file with the given algorithm.
+func HashFile(fsys FS, name, algo string) (string, error) {
+	var h hash.Hash
+	switch algo {
+	case "sha256":
+		h = sha256.New()
+	case "md5":
+		h = md5.New()
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm %q", algo)
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAferoFS_WriteFile(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		fsys *AferoFS
+		root string
+	}{
+		{"os", NewOSFS(), t.TempDir()},
+		{"mem", NewMemFS(), "/root"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(tt.root, "a", "b", "file.jsonl")
+			modTime := time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
+
+			require.NoError(t, tt.fsys.WriteFile(name, strings.NewReader("first"), 0644, modTime))
+			require.NoError(t, tt.fsys.WriteFile(name, strings.NewReader("second"), 0600, modTime))
+
+			data, err := ReadFile(tt.fsys, name)
+			require.NoError(t, err)
+			assert.Equal(t, "second", string(data))
+
+			info, err := tt.fsys.Stat(name)
+			require.NoError(t, err)
+			assert.True(t, info.ModTime().Equal(modTime))
+			assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+
+			// No temporary files are left behind
+			var names []string
+			require.NoError(t, tt.fsys.Walk(tt.root, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					names = append(names, filepath.Base(path))
+				}
+				return err
+			}))
+			assert.Equal(t, []string{"file.jsonl"}, names)
+
+			require.NoError(t, tt.fsys.Remove(name))
+			_, err = tt.fsys.Stat(name)
+			assert.True(t, errors.Is(err, fs.ErrNotExist))
+		})
+	}
+}
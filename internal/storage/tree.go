@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TreeFile is the metadata of one file in a Tree.
+type TreeFile struct {
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+// Tree is an in-memory index of files, used by read-only FS implementations
+// to provide Stat and Walk. Names are slash-separated and relative to the
+// tree root; directories are implied by the files they contain.
+type Tree struct {
+	// DirModTime is reported as the modification time of every directory.
+	DirModTime time.Time
+
+	files map[string]TreeFile
+	dirs  map[string]bool
+}
+
+// NewTree creates an empty tree.
+func NewTree() *Tree {
+	return &Tree{files: map[string]TreeFile{}, dirs: map[string]bool{".": true}}
+}
+
+// Add records a file and its parent directories.
+func (t *Tree) Add(name string, f TreeFile) {
+	name = CleanName(name)
+	t.files[name] = f
+	for d := path.Dir(name); d != "."; d = path.Dir(d) {
+		t.dirs[d] = true
+	}
+}
+
+// File returns the metadata of a file.
+func (t *Tree) File(name string) (TreeFile, bool) {
+	f, ok := t.files[CleanName(name)]
+	return f, ok
+}
+
+// Stat returns metadata for a file or directory in the tree.
+func (t *Tree) Stat(name string) (fs.FileInfo, error) {
+	clean := CleanName(name)
+	if f, ok := t.files[clean]; ok {
+		return &treeInfo{name: path.Base(clean), size: f.Size, mode: f.Mode, modTime: f.ModTime}, nil
+	}
+	if t.dirs[clean] {
+		return &treeInfo{name: path.Base(clean), dir: true, modTime: t.DirModTime}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// Walk visits the tree under root in lexical order.
+func (t *Tree) Walk(root string, fn filepath.WalkFunc) error {
+	clean := CleanName(root)
+	info, err := t.Stat(clean)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+
+	var names []string
+	for name := range t.files {
+		if clean == "." || name == clean || strings.HasPrefix(name, clean+"/") {
+			names = append(names, name)
+		}
+	}
+	for name := range t.dirs {
+		if name != "." && (clean == "." || strings.HasPrefix(name, clean+"/")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if err := fn(root, info, nil); err != nil {
+		if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+			return nil
+		}
+		return err
+	}
+
+	var skipped string
+	for _, name := range names {
+		if skipped != "" && strings.HasPrefix(name, skipped+"/") {
+			continue
+		}
+		info, _ := t.Stat(name)
+		if err := fn(name, info, nil); err != nil {
+			if errors.Is(err, filepath.SkipDir) && info.IsDir() {
+				skipped = name
+				continue
+			}
+			if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanName normalizes a name to a slash-separated tree path.
+func CleanName(name string) string {
+	name = strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// treeInfo implements fs.FileInfo for a tree entry.
+type treeInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	dir     bool
+}
+
+func (i *treeInfo) Name() string       { return i.name }
+func (i *treeInfo) Size() int64        { return i.size }
+func (i *treeInfo) ModTime() time.Time { return i.modTime }
+func (i *treeInfo) IsDir() bool        { return i.dir }
+func (i *treeInfo) Sys() any           { return nil }
+
+func (i *treeInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return i.mode
+}
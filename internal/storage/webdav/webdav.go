@@ -0,0 +1,467 @@
+package webdav
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// propNS is the XML namespace of the dead properties ccbackup stores.
+const propNS = "https://github.com/takoeight0821/ccbackup"
+
+// Config configures access to a WebDAV server.
+type Config struct {
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+}
+
+// FS is a storage.FS backed by a WebDAV collection.
+// Names are slash-separated paths relative to the base URL.
+type FS struct {
+	base   *url.URL
+	cfg    Config
+	client *http.Client
+}
+
+// New creates an FS rooted at baseURL (http or https).
+func New(baseURL string, cfg Config) (*FS, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid WebDAV URL %q", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &FS{base: u, cfg: cfg, client: client}, nil
+}
+
+// IsURL reports whether raw is a dav:// or davs:// URL.
+func IsURL(raw string) bool {
+	return strings.HasPrefix(raw, "dav://") || strings.HasPrefix(raw, "davs://")
+}
+
+// ParseURL converts a dav:// or davs:// URL to its http or https form.
+func ParseURL(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, "davs://"):
+		return "https://" + strings.TrimPrefix(raw, "davs://"), nil
+	case strings.HasPrefix(raw, "dav://"):
+		return "http://" + strings.TrimPrefix(raw, "dav://"), nil
+	default:
+		return "", fmt.Errorf("invalid WebDAV URL %q (want dav:// or davs://)", raw)
+	}
+}
+
+// Open downloads a file.
+func (f *FS) Open(name string) (io.ReadCloser, error) {
+	resp, err := f.do(http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return resp.Body, nil
+}
+
+// Stat returns file metadata from a Depth 0 PROPFIND.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	entries, err := f.propfind(name, "0")
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if len(entries) == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return entries[0].info, nil
+}
+
+// ContentHash returns the SHA-256 stored as a dead property by WriteFile.
+func (f *FS) ContentHash(name string) (algo, sum string, err error) {
+	entries, err := f.propfind(name, "0")
+	if err != nil || len(entries) == 0 {
+		return "", "", err
+	}
+	if entries[0].sha256 == "" {
+		return "", "", nil
+	}
+	return "sha256", entries[0].sha256, nil
+}
+
+// Walk lists the tree under root with Depth 1 PROPFINDs,
+// since many servers refuse Depth infinity.
+func (f *FS) Walk(root string, fn filepath.WalkFunc) error {
+	info, err := f.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	err = f.walk(root, info, fn)
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func (f *FS) walk(name string, info fs.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(name, info, nil)
+	}
+
+	entries, err := f.propfind(name, "1")
+	if err != nil {
+		return fn(name, info, err)
+	}
+	if err := fn(name, info, nil); err != nil {
+		if errors.Is(err, filepath.SkipDir) {
+			return nil
+		}
+		return err
+	}
+
+	for _, e := range entries {
+		if e.name == f.relName(name) {
+			continue
+		}
+		child := path.Join(filepath.ToSlash(name), path.Base(e.name))
+		if err := f.walk(child, e.info, fn); err != nil {
+			if errors.Is(err, filepath.SkipDir) && !e.info.IsDir() {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFile uploads to a temporary name and MOVEs it into place, so readers
+// never see a partial file. The original mtime and SHA-256 are stored as dead
+// properties; Nextcloud also honours the X-OC-Mtime header.
+func (f *FS) WriteFile(name string, r io.Reader, perm fs.FileMode, modTime time.Time) error {
+	if err := f.mkdirAll(path.Dir(filepath.ToSlash(name))); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "ccbackup-dav-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	tmpName := path.Join(path.Dir(filepath.ToSlash(name)), "."+path.Base(filepath.ToSlash(name))+".tmp-"+randomSuffix())
+	headers := http.Header{}
+	headers.Set("X-OC-Mtime", strconv.FormatInt(modTime.Unix(), 10))
+
+	var body io.Reader = tmp
+	if size == 0 {
+		body = http.NoBody
+	}
+	resp, err := f.doSized(http.MethodPut, tmpName, body, size, headers)
+	if err != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	resp.Body.Close()
+
+	if err := f.proppatch(tmpName, modTime, perm, sum); err != nil {
+		f.Remove(tmpName)
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+
+	headers = http.Header{}
+	headers.Set("Destination", f.url(name).String())
+	headers.Set("Overwrite", "T")
+	resp, err = f.do("MOVE", tmpName, nil, headers)
+	if err != nil {
+		f.Remove(tmpName)
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Remove deletes a file.
+func (f *FS) Remove(name string) error {
+	resp, err := f.do(http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// mkdirAll creates dir and its parents with MKCOL,
+// including the base collection itself.
+func (f *FS) mkdirAll(dir string) error {
+	if dir == "." || dir == "/" {
+		dir = ""
+	}
+	if info, err := f.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s: not a directory", dir)
+		}
+		return nil
+	}
+	if dir != "" {
+		if err := f.mkdirAll(path.Dir(dir)); err != nil {
+			return err
+		}
+	}
+
+	resp, err := f.do("MKCOL", dir+"/", nil, nil)
+	if err != nil {
+		// 405 means the collection already exists
+		var se *statusError
+		if errors.As(err, &se) && se.code == http.StatusMethodNotAllowed {
+			return nil
+		}
+		return fmt.Errorf("mkcol %s: %w", dir, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="` + propNS + `">
+  <d:prop>
+    <d:resourcetype/><d:getcontentlength/><d:getlastmodified/>
+    <c:mtime/><c:mode/><c:sha256/>
+  </d:prop>
+</d:propfind>`
+
+// multistatus is a 207 Multi-Status response body.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+				MTime         string `xml:"https://github.com/takoeight0821/ccbackup mtime"`
+				Mode          string `xml:"https://github.com/takoeight0821/ccbackup mode"`
+				SHA256        string `xml:"https://github.com/takoeight0821/ccbackup sha256"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// davEntry is one resource from a PROPFIND response.
+type davEntry struct {
+	name   string
+	info   *davInfo
+	sha256 string
+}
+
+// propfind returns the resources at name, in href order.
+func (f *FS) propfind(name, depth string) ([]davEntry, error) {
+	headers := http.Header{}
+	headers.Set("Depth", depth)
+	headers.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := f.do("PROPFIND", name, strings.NewReader(propfindBody), headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("decode propfind response: %w", err)
+	}
+
+	var entries []davEntry
+	for _, r := range ms.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			href = r.Href
+		}
+		if u, err := url.Parse(href); err == nil && u.IsAbs() {
+			href = u.Path
+		}
+		rel := strings.Trim(strings.TrimPrefix(href, f.base.Path), "/")
+
+		info := &davInfo{name: path.Base("/" + rel), mode: 0644}
+		var sum string
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			p := ps.Prop
+			if p.ResourceType.Collection != nil {
+				info.dir = true
+			}
+			if n, err := strconv.ParseInt(p.ContentLength, 10, 64); err == nil {
+				info.size = n
+			}
+			if t, err := http.ParseTime(p.LastModified); err == nil && info.modTime.IsZero() {
+				info.modTime = t
+			}
+			if t, err := time.Parse(time.RFC3339Nano, p.MTime); err == nil {
+				info.modTime = t
+			}
+			if m, err := strconv.ParseUint(p.Mode, 8, 32); err == nil {
+				info.mode = fs.FileMode(m).Perm()
+			}
+			if p.SHA256 != "" {
+				sum = p.SHA256
+			}
+		}
+		entries = append(entries, davEntry{name: rel, info: info, sha256: sum})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+// proppatch stores ccbackup's dead properties on a resource.
+func (f *FS) proppatch(name string, modTime time.Time, perm fs.FileMode, sum string) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `<?xml version="1.0" encoding="utf-8"?>
+<d:propertyupdate xmlns:d="DAV:" xmlns:c="%s">
+  <d:set><d:prop>
+    <c:mtime>%s</c:mtime><c:mode>%o</c:mode><c:sha256>%s</c:sha256>
+  </d:prop></d:set>
+</d:propertyupdate>`, propNS, modTime.UTC().Format(time.RFC3339Nano), perm.Perm(), sum)
+
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := f.do("PROPPATCH", name, &body, headers)
+	if err != nil {
+		return fmt.Errorf("proppatch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// A 207 response can still report per-property failures
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if ps.Status != "" && !strings.Contains(ps.Status, " 200 ") {
+				return fmt.Errorf("proppatch: %s", ps.Status)
+			}
+		}
+	}
+	return nil
+}
+
+// statusError is a non-2xx response.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "webdav: unexpected status " + e.status
+}
+
+// Is makes a 404 response satisfy errors.Is(err, fs.ErrNotExist).
+func (e *statusError) Is(target error) bool {
+	return target == fs.ErrNotExist && e.code == http.StatusNotFound
+}
+
+func (f *FS) do(method, name string, body io.Reader, headers http.Header) (*http.Response, error) {
+	return f.doSized(method, name, body, -1, headers)
+}
+
+// doSized sends an authenticated request and returns the response if its status is 2xx.
+func (f *FS) doSized(method, name string, body io.Reader, size int64, headers http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, f.url(name).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	if f.cfg.Username != "" || f.cfg.Password != "" {
+		req.SetBasicAuth(f.cfg.Username, f.cfg.Password)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil, &statusError{code: resp.StatusCode, status: resp.Status}
+}
+
+// url returns the absolute URL of name.
+func (f *FS) url(name string) *url.URL {
+	u := *f.base
+	rel := strings.TrimPrefix(filepath.ToSlash(name), "/")
+	u.Path = f.base.Path + "/" + rel
+	return &u
+}
+
+// relName normalizes name the way propfind reports resource names.
+func (f *FS) relName(name string) string {
+	return strings.Trim(filepath.ToSlash(name), "/")
+}
+
+func randomSuffix() string {
+	var b [6]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// davInfo implements fs.FileInfo for a WebDAV resource.
+type davInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+	dir     bool
+}
+
+func (i *davInfo) Name() string       { return i.name }
+func (i *davInfo) Size() int64        { return i.size }
+func (i *davInfo) ModTime() time.Time { return i.modTime }
+func (i *davInfo) IsDir() bool        { return i.dir }
+func (i *davInfo) Sys() any           { return nil }
+
+func (i *davInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return i.mode
+}
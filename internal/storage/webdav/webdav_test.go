@@ -0,0 +1,154 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+	"golang.org/x/net/webdav"
+)
+
+// newTestServer starts an in-memory WebDAV server under /remote.php/dav
+// that requires basic auth, like Nextcloud.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	handler := &webdav.Handler{
+		Prefix:     "/remote.php/dav",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestFS(t *testing.T) *FS {
+	t.Helper()
+	server := newTestServer(t)
+	fsys, err := New(server.URL+"/remote.php/dav/", Config{Username: "alice", Password: "secret"})
+	require.NoError(t, err)
+	return fsys
+}
+
+func TestParseURL(t *testing.T) {
+	u, err := ParseURL("davs://cloud.example.com/remote.php/dav/files/alice/claude")
+	require.NoError(t, err)
+	assert.Equal(t, "https://cloud.example.com/remote.php/dav/files/alice/claude", u)
+
+	u, err = ParseURL("dav://localhost:8080/dav")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/dav", u)
+
+	assert.False(t, IsURL("/home/alice/claude-backup"))
+	_, err = ParseURL("https://example.com")
+	assert.Error(t, err)
+}
+
+func TestFS_WriteStatOpenRemove(t *testing.T) {
+	fsys := newTestFS(t)
+	modTime := time.Date(2024, 1, 15, 14, 30, 0, 123, time.UTC)
+
+	name := "claude/projects/-Users-alice-app/session 1.jsonl"
+	require.NoError(t, fsys.WriteFile(name, strings.NewReader("hello"), 0600, modTime))
+	// Overwrite goes through the same temp + MOVE path
+	require.NoError(t, fsys.WriteFile(name, strings.NewReader("hello!"), 0600, modTime))
+
+	info, err := fsys.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), info.Size())
+	assert.True(t, info.ModTime().Equal(modTime))
+	assert.Equal(t, fs.FileMode(0600), info.Mode())
+
+	data, err := storage.ReadFile(fsys, name)
+	require.NoError(t, err)
+	assert.Equal(t, "hello!", string(data))
+
+	algo, sum, err := fsys.ContentHash(name)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256", algo)
+	assert.Len(t, sum, 64)
+
+	require.NoError(t, fsys.Remove(name))
+	_, err = fsys.Stat(name)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestFS_Walk(t *testing.T) {
+	fsys := newTestFS(t)
+
+	for _, name := range []string{"root/a", "root/b/c", "root/b/d/e", "other/x", "root/empty"} {
+		require.NoError(t, fsys.WriteFile(name, strings.NewReader(name), 0644, time.Now()))
+	}
+
+	var files []string
+	require.NoError(t, fsys.Walk("root", func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"root/a", "root/b/c", "root/b/d/e", "root/empty"}, files)
+}
+
+func TestSyncer_BackupAndRestoreThroughWebDAV(t *testing.T) {
+	fsys := newTestFS(t)
+	src := t.TempDir()
+	restored := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "projects", "p"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "projects", "p", "session.jsonl"), []byte("data1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "history.jsonl"), []byte("data2"), 0644))
+
+	patterns := []string{"projects", "history.jsonl"}
+	ctx := context.Background()
+
+	backup := sync.NewSyncer(src, "claude", patterns)
+	backup.DstFS = fsys
+	result, err := backup.Execute(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.CopiedCount)
+
+	// Unchanged files are not uploaded again
+	plan, err := backup.Plan(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Items)
+
+	restore := sync.NewSyncer("claude", restored, patterns)
+	restore.SrcFS = fsys
+	result, err = restore.Execute(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.CopiedCount)
+
+	content, err := os.ReadFile(filepath.Join(restored, "projects", "p", "session.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, "data1", string(content))
+}
+
+func TestFS_Unauthorized(t *testing.T) {
+	server := newTestServer(t)
+	fsys, err := New(server.URL+"/remote.php/dav", Config{Username: "alice", Password: "wrong"})
+	require.NoError(t, err)
+
+	_, err = fsys.Stat("anything")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, fs.ErrNotExist))
+	assert.Contains(t, err.Error(), "401")
+}
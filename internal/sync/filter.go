@@ -15,6 +15,9 @@ var excludedFiles = map[string]bool{
 // Filter handles file inclusion based on patterns.
 type Filter struct {
 	includePatterns []string
+	excludePatterns []string
+	// also, if set, must include a path as well
+	also *Filter
 }
 
 // NewFilter creates a Filter from a list of include patterns.
@@ -22,12 +25,31 @@ func NewFilter(patterns []string) *Filter {
 	return &Filter{includePatterns: patterns}
 }
 
+// Exclude returns a filter that also rejects paths matching any of patterns.
+func (f *Filter) Exclude(patterns []string) *Filter {
+	excluded := append(append([]string{}, f.excludePatterns...), patterns...)
+	return &Filter{includePatterns: f.includePatterns, excludePatterns: excluded, also: f.also}
+}
+
+// And returns a filter that includes a path only if both f and other do.
+func (f *Filter) And(other *Filter) *Filter {
+	return &Filter{includePatterns: f.includePatterns, excludePatterns: f.excludePatterns, also: other}
+}
+
 // ShouldInclude returns true if the path should be included.
 func (f *Filter) ShouldInclude(path string) bool {
 	base := filepath.Base(path)
 	if excludedFiles[base] {
 		return false
 	}
+	if f.also != nil && !f.also.ShouldInclude(path) {
+		return false
+	}
+	for _, pattern := range f.excludePatterns {
+		if matchPattern(pattern, path) {
+			return false
+		}
+	}
 
 	for _, pattern := range f.includePatterns {
 		if matchPattern(pattern, path) {
@@ -37,6 +59,26 @@ func (f *Filter) ShouldInclude(path string) bool {
 	return false
 }
 
+// ShouldDescend reports whether files below a directory may be included,
+// so walks can skip directories such as the rest of a home directory.
+func (f *Filter) ShouldDescend(dir string) bool {
+	if f.also != nil && !f.also.ShouldDescend(dir) {
+		return false
+	}
+	for _, pattern := range f.excludePatterns {
+		if !strings.Contains(pattern, "*") && matchPattern(pattern, dir) {
+			return false
+		}
+	}
+
+	for _, pattern := range f.includePatterns {
+		if strings.Contains(pattern, "*") || matchPattern(pattern, dir) || strings.HasPrefix(pattern, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // matchPattern checks if a path matches a pattern.
 // Supports:
 // - Simple directory names: "projects" matches "projects" and "projects/foo"
@@ -134,3 +134,42 @@ func TestFilter_RealWorldConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestFilter_And(t *testing.T) {
+	f := NewFilter([]string{"projects", "history.jsonl"}).And(NewFilter([]string{"projects/-Users-me-app"}))
+
+	assert.True(t, f.ShouldInclude("projects/-Users-me-app/session.jsonl"))
+	assert.False(t, f.ShouldInclude("projects/-Users-me-other/session.jsonl"))
+	assert.False(t, f.ShouldInclude("history.jsonl"))
+
+	// The narrower filter cannot widen the configured one
+	f = NewFilter([]string{"projects"}).And(NewFilter([]string{"debug"}))
+	assert.False(t, f.ShouldInclude("debug/log.txt"))
+}
+
+func TestFilter_Exclude(t *testing.T) {
+	f := NewFilter([]string{"projects", "*.json"}).Exclude([]string{"projects/tmp", "*.log"})
+
+	assert.True(t, f.ShouldInclude("projects/p/s.jsonl"))
+	assert.True(t, f.ShouldInclude(".claude.json"))
+	assert.False(t, f.ShouldInclude("projects/tmp/s.jsonl"))
+	assert.False(t, f.ShouldInclude("projects/p/debug.log"))
+
+	// The exclusions survive narrowing
+	assert.False(t, f.And(NewFilter([]string{"projects"})).ShouldInclude("projects/tmp/s.jsonl"))
+}
+
+func TestFilter_ShouldDescend(t *testing.T) {
+	f := NewFilter([]string{"projects", ".config/app/state.json"}).Exclude([]string{"projects/tmp"})
+
+	assert.True(t, f.ShouldDescend("projects"))
+	assert.True(t, f.ShouldDescend("projects/p"))
+	assert.True(t, f.ShouldDescend(".config"))
+	assert.True(t, f.ShouldDescend(".config/app"))
+	assert.False(t, f.ShouldDescend(".config/other"))
+	assert.False(t, f.ShouldDescend("node_modules"))
+	assert.False(t, f.ShouldDescend("projects/tmp"))
+
+	// Wildcards can match anywhere
+	assert.True(t, NewFilter([]string{"*.jsonl"}).ShouldDescend("any/dir"))
+}
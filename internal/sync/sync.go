@@ -1,11 +1,16 @@
 package sync
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/storage"
 )
 
 // FileInfo holds file metadata for comparison.
@@ -20,6 +25,8 @@ type SyncItem struct {
 	SrcPath string
 	DstPath string
 	Size    int64
+	ModTime time.Time
+	Mode    fs.FileMode
 }
 
 // SyncError records a per-file error that did not abort the sync.
@@ -37,18 +44,38 @@ type SyncResult struct {
 }
 
 // Syncer handles file synchronization between source and destination.
+// SrcDir and DstDir are roots inside SrcFS and DstFS respectively.
 type Syncer struct {
+	SrcFS   storage.FS
 	SrcDir  string
+	DstFS   storage.FS
 	DstDir  string
 	Filter  *Filter
 	DryRun  bool
 	Verbose bool
+
+	// Transform, if set, rewrites file contents on their way to DstDir.
+	Transform func(relPath string, data []byte) ([]byte, error)
+
+	// Rename, if set, returns the path below DstDir a source file is copied to.
+	Rename func(relPath string) string
+
+	// Metadata, if set, supplies the mode and modification time of a source
+	// file of the given size in place of what SrcFS reports.
+	Metadata func(relPath string, size int64) (mode fs.FileMode, modTime time.Time, ok bool)
+
+	// Recorded, if set, returns the size and modification time of the source
+	// a destination file of the given size was copied from, when they differ
+	// from the copy's, as after Transform. Plan compares the source with them.
+	Recorded func(relPath string, size int64) (FileInfo, bool)
 }
 
-// NewSyncer creates a new Syncer.
+// NewSyncer creates a new Syncer between two local directories.
 func NewSyncer(srcDir, dstDir string, includePatterns []string) *Syncer {
 	return &Syncer{
+		SrcFS:  storage.NewOSFS(),
 		SrcDir: srcDir,
+		DstFS:  storage.NewOSFS(),
 		DstDir: dstDir,
 		Filter: NewFilter(includePatterns),
 	}
@@ -76,13 +103,58 @@ type PlanResult struct {
 
 // Plan scans the source directory and returns items that need syncing.
 func (s *Syncer) Plan(ctx context.Context) (*PlanResult, error) {
+	listed, err := List(s.SrcFS, s.SrcDir, s.Filter)
+	if err != nil {
+		return listed, err
+	}
+
+	result := &PlanResult{Warnings: listed.Warnings}
+	for _, item := range listed.Items {
+		// Check if destination file exists and needs sync
+		dstRel := item.RelPath
+		if s.Rename != nil {
+			dstRel = s.Rename(dstRel)
+		}
+		item.DstPath = filepath.Join(s.DstDir, dstRel)
+		if s.Metadata != nil {
+			if mode, modTime, ok := s.Metadata(item.RelPath, item.Size); ok {
+				item.Mode, item.ModTime = mode, modTime
+			}
+		}
+		srcInfo := &FileInfo{Size: item.Size, ModTime: item.ModTime}
+
+		var dstInfo *FileInfo
+		if dstStat, err := s.DstFS.Stat(item.DstPath); err == nil {
+			dstInfo = &FileInfo{Size: dstStat.Size(), ModTime: dstStat.ModTime()}
+			if s.Recorded != nil {
+				if info, ok := s.Recorded(item.RelPath, dstInfo.Size); ok {
+					dstInfo = &info
+				}
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			result.Warnings = append(result.Warnings, SyncError{RelPath: item.RelPath, Err: err})
+			continue
+		}
+
+		if NeedsSync(srcInfo, dstInfo) && !s.sameContent(item.SrcPath, item.DstPath, srcInfo, dstInfo) &&
+			!s.sameTransformed(item, srcInfo, dstInfo) {
+			result.Items = append(result.Items, item)
+		}
+	}
+
+	return result, nil
+}
+
+// List walks root in fsys and returns every file accepted by filter,
+// without a destination. Walk errors on individual paths become warnings.
+func List(fsys storage.FS, root string, filter *Filter) (*PlanResult, error) {
 	result := &PlanResult{}
 
-	err := filepath.Walk(s.SrcDir, func(path string, info os.FileInfo, err error) error {
+	err := fsys.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			// For walk errors on individual files, record and continue.
 			// If info is nil, we can try to get the relPath from the path.
-			relPath, relErr := filepath.Rel(s.SrcDir, path)
+			relPath, relErr := filepath.Rel(root, path)
 			if relErr != nil {
 				relPath = path
 			}
@@ -90,53 +162,89 @@ func (s *Syncer) Plan(ctx context.Context) (*PlanResult, error) {
 			return nil
 		}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
-
 		// Get relative path
-		relPath, err := filepath.Rel(s.SrcDir, path)
+		relPath, err := filepath.Rel(root, path)
 		if err != nil {
 			return err
 		}
 
-		// Check filter
-		if !s.Filter.ShouldInclude(relPath) {
+		// Skip directories, and do not walk those the filter excludes
+		if info.IsDir() {
+			if relPath != "." && !filter.ShouldDescend(relPath) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		// Check if destination file exists and needs sync
-		dstPath := filepath.Join(s.DstDir, relPath)
-		srcInfo := &FileInfo{Size: info.Size(), ModTime: info.ModTime()}
-
-		var dstInfo *FileInfo
-		if dstStat, err := os.Stat(dstPath); err == nil {
-			dstInfo = &FileInfo{Size: dstStat.Size(), ModTime: dstStat.ModTime()}
-		}
-
-		if NeedsSync(srcInfo, dstInfo) {
-			result.Items = append(result.Items, SyncItem{
-				RelPath: relPath,
-				SrcPath: path,
-				DstPath: dstPath,
-				Size:    info.Size(),
-			})
+		// Check filter
+		if !filter.ShouldInclude(relPath) {
+			return nil
 		}
 
+		result.Items = append(result.Items, SyncItem{
+			RelPath: relPath,
+			SrcPath: path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Mode:    info.Mode().Perm(),
+		})
 		return nil
 	})
 
 	return result, err
 }
 
+// sameContent reports whether a file that NeedsSync flagged is in fact
+// unchanged, using the content hash stored by DstFS when it has one.
+func (s *Syncer) sameContent(srcPath, dstPath string, src, dst *FileInfo) bool {
+	if dst == nil || src.Size != dst.Size {
+		return false
+	}
+	hasher, ok := s.DstFS.(storage.Hasher)
+	if !ok {
+		return false
+	}
+
+	algo, dstSum, err := hasher.ContentHash(dstPath)
+	if err != nil || dstSum == "" {
+		return false
+	}
+	srcSum, err := storage.HashFile(s.SrcFS, srcPath, algo)
+	if err != nil {
+		return false
+	}
+	return srcSum == dstSum
+}
+
+// sameTransformed reports whether a file that NeedsSync flagged for its
+// size alone is unchanged once Transform rewrites it. Files modified since
+// they were copied are not read.
+func (s *Syncer) sameTransformed(item SyncItem, src, dst *FileInfo) bool {
+	if s.Transform == nil || dst == nil || src.Size == dst.Size || src.ModTime.After(dst.ModTime) {
+		return false
+	}
+	data, err := storage.ReadFile(s.SrcFS, item.SrcPath)
+	if err != nil {
+		return false
+	}
+	if data, err = s.Transform(item.RelPath, data); err != nil || int64(len(data)) != dst.Size {
+		return false
+	}
+	copied, err := storage.ReadFile(s.DstFS, item.DstPath)
+	return err == nil && bytes.Equal(data, copied)
+}
+
 // Execute performs the sync operation.
 func (s *Syncer) Execute(ctx context.Context) (*SyncResult, error) {
 	plan, err := s.Plan(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return s.Apply(ctx, plan)
+}
 
+// Apply copies the items of a previously computed plan.
+func (s *Syncer) Apply(ctx context.Context, plan *PlanResult) (*SyncResult, error) {
 	result := &SyncResult{
 		Items:  plan.Items,
 		Errors: plan.Warnings,
@@ -149,7 +257,7 @@ func (s *Syncer) Execute(ctx context.Context) (*SyncResult, error) {
 			continue
 		}
 
-		if err := s.copyFile(item.SrcPath, item.DstPath); err != nil {
+		if err := s.copyItem(item); err != nil {
 			result.Errors = append(result.Errors, SyncError{RelPath: item.RelPath, Err: err})
 			continue
 		}
@@ -161,34 +269,39 @@ func (s *Syncer) Execute(ctx context.Context) (*SyncResult, error) {
 	return result, nil
 }
 
-// copyFile copies a file from src to dst, preserving modtime.
-func (s *Syncer) copyFile(src, dst string) error {
-	// Ensure destination directory exists
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
-		return err
-	}
-
-	srcFile, err := os.Open(src)
+// copyItem copies a planned item, applying Transform if set.
+func (s *Syncer) copyItem(item SyncItem) error {
+	srcFile, err := s.SrcFS.Open(item.SrcPath)
 	if err != nil {
 		return err
 	}
 	defer srcFile.Close()
 
-	srcInfo, err := srcFile.Stat()
+	srcInfo, err := s.SrcFS.Stat(item.SrcPath)
 	if err != nil {
 		return err
 	}
 
-	dstFile, err := os.Create(dst)
-	if err != nil {
-		return err
+	var r io.Reader = srcFile
+	if s.Transform != nil {
+		data, err := io.ReadAll(srcFile)
+		if err != nil {
+			return err
+		}
+		data, err = s.Transform(item.RelPath, data)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
 	}
-	defer dstFile.Close()
 
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
-		return err
+	mode, modTime := srcInfo.Mode().Perm(), srcInfo.ModTime()
+	if s.Metadata != nil {
+		if m, t, ok := s.Metadata(item.RelPath, srcInfo.Size()); ok {
+			mode, modTime = m, t
+		}
 	}
 
-	// Preserve modification time
-	return os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime())
+	// Preserve modification time so the next Plan sees the file as synced
+	return s.DstFS.WriteFile(item.DstPath, r, mode, modTime)
 }
@@ -2,13 +2,16 @@ package sync
 
 import (
 	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/takoeight0821/ccbackup/internal/storage"
 )
 
 func TestNeedsSync(t *testing.T) {
@@ -242,3 +245,208 @@ func TestSyncer_DryRun(t *testing.T) {
 	_, err = os.Stat(filepath.Join(dst, "history.jsonl"))
 	assert.True(t, os.IsNotExist(err))
 }
+
+// fsCase creates a file system and a root directory inside it.
+type fsCase struct {
+	name  string
+	newFS func(t *testing.T) (storage.FS, string)
+}
+
+var fsCases = []fsCase{
+	{"os", func(t *testing.T) (storage.FS, string) {
+		return storage.NewOSFS(), t.TempDir()
+	}},
+	{"mem", func(t *testing.T) (storage.FS, string) {
+		return storage.NewMemFS(), "/root"
+	}},
+}
+
+// forEachFS runs fn once per FS implementation with fresh src and dst roots.
+func forEachFS(t *testing.T, fn func(t *testing.T, newSyncer func(patterns []string) *Syncer)) {
+	for _, c := range fsCases {
+		t.Run(c.name, func(t *testing.T) {
+			srcFS, src := c.newFS(t)
+			dstFS, dst := c.newFS(t)
+			fn(t, func(patterns []string) *Syncer {
+				s := NewSyncer(src, dst, patterns)
+				s.SrcFS, s.DstFS = srcFS, dstFS
+				return s
+			})
+		})
+	}
+}
+
+// newMemSyncer returns a syncer between two in-memory file systems.
+func newMemSyncer(patterns []string) *Syncer {
+	s := NewSyncer("/src", "/dst", patterns)
+	s.SrcFS, s.DstFS = storage.NewMemFS(), storage.NewMemFS()
+	return s
+}
+
+func writeFile(t *testing.T, fsys storage.FS, name, content string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, fsys.WriteFile(name, strings.NewReader(content), 0644, modTime))
+}
+
+func readFile(t *testing.T, fsys storage.FS, name string) string {
+	t.Helper()
+	data, err := storage.ReadFile(fsys, name)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestSyncer_Plan_MemFS(t *testing.T) {
+	syncer := newMemSyncer([]string{"projects", "history.jsonl"})
+	src, now := syncer.SrcDir, time.Now()
+
+	// Create test files in src
+	writeFile(t, syncer.SrcFS, filepath.Join(src, "projects", "session.jsonl"), "hello", now)
+	writeFile(t, syncer.SrcFS, filepath.Join(src, "history.jsonl"), "world", now)
+	// Create files that should NOT be included
+	writeFile(t, syncer.SrcFS, filepath.Join(src, "debug", "log.txt"), "debug", now)
+	writeFile(t, syncer.SrcFS, filepath.Join(src, "settings.json"), "settings", now)
+
+	plan, err := syncer.Plan(context.Background())
+	require.NoError(t, err)
+
+	// Should find 2 files (projects/session.jsonl and history.jsonl), not debug/log.txt or settings.json
+	assert.Len(t, plan.Items, 2)
+
+	paths := make([]string, len(plan.Items))
+	for i, item := range plan.Items {
+		paths[i] = item.RelPath
+	}
+	assert.Contains(t, paths, "projects/session.jsonl")
+	assert.Contains(t, paths, "history.jsonl")
+}
+
+func TestSyncer_Plan_ExistingDstFile_MemFS(t *testing.T) {
+	syncer := newMemSyncer([]string{"history.jsonl"})
+	modTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	// Create the same file in src and dst (same size, same time)
+	writeFile(t, syncer.SrcFS, filepath.Join(syncer.SrcDir, "history.jsonl"), "hello", modTime)
+	writeFile(t, syncer.DstFS, filepath.Join(syncer.DstDir, "history.jsonl"), "hello", modTime)
+
+	plan, err := syncer.Plan(context.Background())
+	require.NoError(t, err)
+
+	// Should find 0 files (already synced)
+	assert.Len(t, plan.Items, 0)
+}
+
+func TestSyncer_Execute_MemFS(t *testing.T) {
+	syncer := newMemSyncer([]string{"projects", "history.jsonl"})
+	src, dst, now := syncer.SrcDir, syncer.DstDir, time.Now()
+
+	// Create test files in src
+	writeFile(t, syncer.SrcFS, filepath.Join(src, "projects", "session.jsonl"), "hello", now)
+	writeFile(t, syncer.SrcFS, filepath.Join(src, "history.jsonl"), "world", now)
+
+	result, err := syncer.Execute(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, result.CopiedCount)
+	assert.Equal(t, int64(10), result.TotalBytes) // "hello" + "world" = 10 bytes
+
+	// Verify content in dst
+	assert.Equal(t, "hello", readFile(t, syncer.DstFS, filepath.Join(dst, "projects", "session.jsonl")))
+	assert.Equal(t, "world", readFile(t, syncer.DstFS, filepath.Join(dst, "history.jsonl")))
+
+	// A second run has nothing left to copy
+	plan, err := syncer.Plan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, plan.Items)
+}
+
+func TestSyncer_RoundTrip_MemFS(t *testing.T) {
+	// Simulate backup -> restore -> compare
+	fsys := storage.NewMemFS()
+	now := time.Now()
+
+	// Create original files
+	writeFile(t, fsys, filepath.Join("/original", "history.jsonl"), "data1", now)
+	writeFile(t, fsys, filepath.Join("/original", "projects", "session.jsonl"), "data2", now)
+
+	includePatterns := []string{"projects", "history.jsonl"}
+
+	// Backup: original -> backup
+	backupSyncer := NewSyncer("/original", "/backup", includePatterns)
+	backupSyncer.SrcFS, backupSyncer.DstFS = fsys, fsys
+	_, err := backupSyncer.Execute(context.Background())
+	require.NoError(t, err)
+
+	// Restore: backup -> restored
+	restoreSyncer := NewSyncer("/backup", "/restored", includePatterns)
+	restoreSyncer.SrcFS, restoreSyncer.DstFS = fsys, fsys
+	_, err = restoreSyncer.Execute(context.Background())
+	require.NoError(t, err)
+
+	// Compare original and restored
+	for _, name := range []string{"history.jsonl", filepath.Join("projects", "session.jsonl")} {
+		assert.Equal(t,
+			readFile(t, fsys, filepath.Join("/original", name)),
+			readFile(t, fsys, filepath.Join("/restored", name)))
+	}
+}
+
+func TestSyncer_DryRun_MemFS(t *testing.T) {
+	syncer := newMemSyncer([]string{"history.jsonl"})
+	syncer.DryRun = true
+
+	// Create test file in src
+	writeFile(t, syncer.SrcFS, filepath.Join(syncer.SrcDir, "history.jsonl"), "hello", time.Now())
+
+	result, err := syncer.Execute(context.Background())
+	require.NoError(t, err)
+
+	// DryRun should report what would happen
+	assert.Equal(t, 1, result.CopiedCount)
+
+	// But file should NOT exist in dst
+	_, err = syncer.DstFS.Stat(filepath.Join(syncer.DstDir, "history.jsonl"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSyncer_Transform(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newSyncer func([]string) *Syncer) {
+		syncer := newSyncer([]string{"history.jsonl"})
+		syncer.Transform = func(relPath string, data []byte) ([]byte, error) {
+			return []byte("[REDACTED]"), nil
+		}
+
+		writeFile(t, syncer.SrcFS, filepath.Join(syncer.SrcDir, "history.jsonl"), "secret", time.Now())
+
+		result, err := syncer.Execute(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.CopiedCount)
+
+		assert.Equal(t, "[REDACTED]", readFile(t, syncer.DstFS, filepath.Join(syncer.DstDir, "history.jsonl")))
+
+		// The copy differs in size from its source but is up to date
+		plan, err := syncer.Plan(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, plan.Items)
+	})
+}
+
+func TestSyncer_Rename(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newSyncer func([]string) *Syncer) {
+		syncer := newSyncer([]string{"projects"})
+		syncer.Rename = func(relPath string) string {
+			return strings.Replace(relPath, "-old", "-new", 1)
+		}
+
+		writeFile(t, syncer.SrcFS, filepath.Join(syncer.SrcDir, "projects", "-old", "s1.jsonl"), "data", time.Now())
+
+		result, err := syncer.Execute(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.CopiedCount)
+		assert.Equal(t, "data", readFile(t, syncer.DstFS, filepath.Join(syncer.DstDir, "projects", "-new", "s1.jsonl")))
+
+		// The renamed file is up to date
+		plan, err := syncer.Plan(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, plan.Items)
+	})
+}
@@ -0,0 +1,73 @@
+package usage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Price is the cost of a model in US dollars per million tokens.
+type Price struct {
+	Model      string  `mapstructure:"model" json:"model"`
+	Input      float64 `mapstructure:"input" json:"input"`
+	Output     float64 `mapstructure:"output" json:"output"`
+	CacheWrite float64 `mapstructure:"cache_write" json:"cache_write"`
+	CacheRead  float64 `mapstructure:"cache_read" json:"cache_read"`
+}
+
+// Cost returns the price of t.
+func (p Price) Cost(t Tokens) float64 {
+	return (float64(t.Input)*p.Input +
+		float64(t.Output)*p.Output +
+		float64(t.CacheWrite)*p.CacheWrite +
+		float64(t.CacheRead)*p.CacheRead) / 1e6
+}
+
+// DefaultPrices are list prices of Claude models. Cache writes are priced
+// as 5-minute cache writes.
+var DefaultPrices = []Price{
+	{Model: "claude-opus-4-5", Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.50},
+	{Model: "claude-opus-4", Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+	{Model: "claude-sonnet-4", Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	{Model: "claude-3-7-sonnet", Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	{Model: "claude-3-5-sonnet", Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	{Model: "claude-haiku-4-5", Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.10},
+	{Model: "claude-3-5-haiku", Input: 0.80, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+}
+
+// PriceTable looks up the price of a model by the longest matching prefix.
+type PriceTable struct {
+	prices []Price
+}
+
+// NewPriceTable returns DefaultPrices overridden and extended by configs.
+func NewPriceTable(configs []Price) (*PriceTable, error) {
+	byModel := map[string]int{}
+	t := &PriceTable{}
+	for _, p := range append(append([]Price{}, DefaultPrices...), configs...) {
+		if p.Model == "" {
+			return nil, fmt.Errorf("price without model")
+		}
+		if p.Input < 0 || p.Output < 0 || p.CacheWrite < 0 || p.CacheRead < 0 {
+			return nil, fmt.Errorf("price of %s: negative price", p.Model)
+		}
+		if i, ok := byModel[p.Model]; ok {
+			t.prices[i] = p
+			continue
+		}
+		byModel[p.Model] = len(t.prices)
+		t.prices = append(t.prices, p)
+	}
+	return t, nil
+}
+
+// Lookup returns the price of model.
+func (t *PriceTable) Lookup(model string) (Price, bool) {
+	var best Price
+	found := false
+	for _, p := range t.prices {
+		if strings.HasPrefix(model, p.Model) && len(p.Model) > len(best.Model) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
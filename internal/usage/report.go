@@ -0,0 +1,76 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Breakdowns of a report.
+const (
+	ByProject = "project"
+	ByModel   = "model"
+	ByDay     = "day"
+	BySession = "session"
+)
+
+// Row is the usage of one group of records.
+type Row struct {
+	Key      string `json:"key"`
+	Messages int    `json:"messages"`
+	Tokens
+	// Cost is the estimated cost in US dollars of the priced records.
+	Cost float64 `json:"cost"`
+	// Unpriced counts the records whose model has no price.
+	Unpriced int `json:"unpriced_messages"`
+}
+
+// Summarize groups records by a breakdown and prices them. Rows are sorted
+// by key; the total is returned separately.
+func Summarize(records []Record, by string, prices *PriceTable) ([]Row, Row, error) {
+	var keyOf func(Record) string
+	switch by {
+	case ByProject:
+		keyOf = func(r Record) string { return r.Project }
+	case ByModel:
+		keyOf = func(r Record) string { return r.Model }
+	case ByDay:
+		keyOf = func(r Record) string {
+			if r.Time.IsZero() {
+				return "unknown"
+			}
+			return r.Time.Local().Format(time.DateOnly)
+		}
+	case BySession:
+		keyOf = func(r Record) string { return r.Project + "/" + r.Session }
+	default:
+		return nil, Row{}, fmt.Errorf("unknown breakdown %q, want project, model, day or session", by)
+	}
+
+	groups := map[string]*Row{}
+	total := Row{Key: "TOTAL"}
+	for _, r := range records {
+		key := keyOf(r)
+		row := groups[key]
+		if row == nil {
+			row = &Row{Key: key}
+			groups[key] = row
+		}
+		for _, acc := range []*Row{row, &total} {
+			acc.Messages++
+			acc.Tokens.Add(r.Tokens)
+			if p, ok := prices.Lookup(r.Model); ok {
+				acc.Cost += p.Cost(r.Tokens)
+			} else {
+				acc.Unpriced++
+			}
+		}
+	}
+
+	rows := make([]Row, 0, len(groups))
+	for _, row := range groups {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	return rows, total, nil
+}
@@ -0,0 +1,126 @@
+// Package usage aggregates the token usage recorded in session transcripts.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/takoeight0821/ccbackup/internal/session"
+)
+
+// maxLine bounds the length of a transcript line.
+const maxLine = 64 << 20
+
+// Tokens counts the tokens of one or more API responses.
+type Tokens struct {
+	Input      int64 `json:"input"`
+	Output     int64 `json:"output"`
+	CacheWrite int64 `json:"cache_write"`
+	CacheRead  int64 `json:"cache_read"`
+}
+
+// Add adds u to t.
+func (t *Tokens) Add(u Tokens) {
+	t.Input += u.Input
+	t.Output += u.Output
+	t.CacheWrite += u.CacheWrite
+	t.CacheRead += u.CacheRead
+}
+
+// Total returns the sum of all token kinds.
+func (t Tokens) Total() int64 {
+	return t.Input + t.Output + t.CacheWrite + t.CacheRead
+}
+
+// Record is the usage of one assistant response.
+type Record struct {
+	Project string
+	Session string
+	Model   string
+	Time    time.Time
+	Tokens  Tokens
+}
+
+// Collector reads transcripts into records. A response is split over several
+// transcript lines and may be copied into other files when a session is
+// resumed, so each message is counted once.
+type Collector struct {
+	Records []Record
+	seen    map[string]bool
+}
+
+// NewCollector returns an empty collector.
+func NewCollector() *Collector {
+	return &Collector{seen: map[string]bool{}}
+}
+
+// Read adds the usage of a transcript at relPath, projects/<project>/<id>.jsonl
+// or a subagent transcript below projects/<project>/<id>/.
+func (c *Collector) Read(relPath string, r io.Reader) error {
+	project, sessionID := sessionOf(relPath)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	for scanner.Scan() {
+		var rec struct {
+			Type      string    `json:"type"`
+			RequestID string    `json:"requestId"`
+			Timestamp time.Time `json:"timestamp"`
+			Message   struct {
+				ID    string `json:"id"`
+				Model string `json:"model"`
+				Usage *struct {
+					InputTokens              int64 `json:"input_tokens"`
+					OutputTokens             int64 `json:"output_tokens"`
+					CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+					CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		u := rec.Message.Usage
+		if rec.Type != "assistant" || u == nil || rec.Message.Model == "<synthetic>" {
+			continue
+		}
+		if rec.Message.ID != "" {
+			key := rec.Message.ID + ":" + rec.RequestID
+			if c.seen[key] {
+				continue
+			}
+			c.seen[key] = true
+		}
+		c.Records = append(c.Records, Record{
+			Project: project,
+			Session: sessionID,
+			Model:   rec.Message.Model,
+			Time:    rec.Timestamp,
+			Tokens: Tokens{
+				Input:      u.InputTokens,
+				Output:     u.OutputTokens,
+				CacheWrite: u.CacheCreationInputTokens,
+				CacheRead:  u.CacheReadInputTokens,
+			},
+		})
+	}
+	return scanner.Err()
+}
+
+// sessionOf returns the project and session of a transcript path, of any
+// host. Subagent transcripts belong to the session whose directory they
+// are stored in.
+func sessionOf(relPath string) (project, sessionID string) {
+	_, rel := session.SplitHost(relPath)
+	parts := strings.Split(rel, "/")
+	if len(parts) < 3 || parts[0] != "projects" {
+		return "", strings.TrimSuffix(path.Base(rel), ".jsonl")
+	}
+	if len(parts) == 3 {
+		return parts[1], strings.TrimSuffix(parts[2], ".jsonl")
+	}
+	return parts[1], parts[2]
+}
@@ -0,0 +1,105 @@
+package usage
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assistantLine(id, model, ts string, input, output int) string {
+	return `{"type":"assistant","requestId":"req_` + id + `","timestamp":"` + ts + `","message":{"id":"msg_` + id + `","model":"` + model +
+		`","usage":{"input_tokens":` + strconv.Itoa(input) + `,"output_tokens":` + strconv.Itoa(output) + `,"cache_creation_input_tokens":100,"cache_read_input_tokens":1000}}}`
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	transcript := strings.Join([]string{
+		`{"type":"user","message":{"role":"user","content":"hi"}}`,
+		assistantLine("1", "claude-sonnet-4-5-20250929", "2024-09-01T10:00:00Z", 10, 20),
+		// A response split over two lines is counted once
+		assistantLine("1", "claude-sonnet-4-5-20250929", "2024-09-01T10:00:00Z", 10, 20),
+		`{"type":"assistant","message":{"id":"msg_x","model":"<synthetic>","usage":{"input_tokens":0,"output_tokens":0}}}`,
+		`not json`,
+	}, "\n")
+	require.NoError(t, c.Read("projects/-work-app/s1.jsonl", strings.NewReader(transcript)))
+	require.NoError(t, c.Read("projects/-work-app/s1/subagents/agent-1.jsonl",
+		strings.NewReader(assistantLine("2", "claude-haiku-4-5", "2024-09-02T10:00:00Z", 1, 2))))
+	// A resumed session copies earlier messages
+	require.NoError(t, c.Read("projects/-work-app/s2.jsonl", strings.NewReader(transcript)))
+
+	require.Len(t, c.Records, 2)
+	assert.Equal(t, Record{
+		Project: "-work-app",
+		Session: "s1",
+		Model:   "claude-sonnet-4-5-20250929",
+		Time:    c.Records[0].Time,
+		Tokens:  Tokens{Input: 10, Output: 20, CacheWrite: 100, CacheRead: 1000},
+	}, c.Records[0])
+	assert.Equal(t, "s1", c.Records[1].Session)
+}
+
+func TestPriceTable(t *testing.T) {
+	prices, err := NewPriceTable([]Price{
+		{Model: "claude-sonnet-4", Input: 1, Output: 2},
+		{Model: "local-model"},
+	})
+	require.NoError(t, err)
+
+	p, ok := prices.Lookup("claude-sonnet-4-5-20250929")
+	require.True(t, ok)
+	assert.Equal(t, 1.0, p.Input, "configured prices override the defaults")
+	p, ok = prices.Lookup("claude-opus-4-5-20251101")
+	require.True(t, ok)
+	assert.Equal(t, 5.0, p.Input, "the longest prefix wins")
+	_, ok = prices.Lookup("gpt-5")
+	assert.False(t, ok)
+
+	assert.InDelta(t, 3.0+15+0.375+0.3, Price{Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30}.Cost(
+		Tokens{Input: 1e6, Output: 1e6, CacheWrite: 1e5, CacheRead: 1e6}), 1e-9)
+
+	_, err = NewPriceTable([]Price{{Input: 1}})
+	assert.Error(t, err)
+	_, err = NewPriceTable([]Price{{Model: "m", Output: -1}})
+	assert.Error(t, err)
+}
+
+func TestSummarize(t *testing.T) {
+	prices, err := NewPriceTable(nil)
+	require.NoError(t, err)
+	c := NewCollector()
+	require.NoError(t, c.Read("projects/-a/s1.jsonl", strings.NewReader(strings.Join([]string{
+		assistantLine("1", "claude-sonnet-4-20250514", "2024-09-01T10:00:00Z", 1000, 1000),
+		assistantLine("2", "unknown-model", "2024-09-01T11:00:00Z", 5, 5),
+	}, "\n"))))
+	require.NoError(t, c.Read("projects/-b/s2.jsonl", strings.NewReader(
+		assistantLine("3", "claude-sonnet-4-20250514", "2024-09-03T10:00:00Z", 1000, 1000))))
+
+	rows, total, err := Summarize(c.Records, ByProject, prices)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "-a", rows[0].Key)
+	assert.Equal(t, 2, rows[0].Messages)
+	assert.Equal(t, 1, rows[0].Unpriced)
+	assert.Equal(t, int64(1005), rows[0].Input)
+	assert.Equal(t, 3, total.Messages)
+	assert.InDelta(t, 2*(0.003+0.015+0.000375+0.0003), total.Cost, 1e-9)
+
+	rows, _, err = Summarize(c.Records, ByModel, prices)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-sonnet-4-20250514", rows[0].Key)
+	assert.Equal(t, 2, rows[0].Messages)
+
+	rows, _, err = Summarize(c.Records, BySession, prices)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-a/s1", "-b/s2"}, []string{rows[0].Key, rows[1].Key})
+
+	rows, _, err = Summarize(c.Records, ByDay, prices)
+	require.NoError(t, err)
+	assert.Len(t, rows, 2)
+
+	_, _, err = Summarize(c.Records, "week", prices)
+	assert.Error(t, err)
+}
@@ -0,0 +1,409 @@
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/manifest"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+// Status is the outcome of a single check.
+type Status string
+
+const (
+	StatusPass Status = "PASS"
+	StatusFail Status = "FAIL"
+	StatusSkip Status = "SKIP"
+)
+
+// Check is the result of one verification step.
+type Check struct {
+	Name     string
+	Status   Status
+	Detail   string
+	Problems []string
+}
+
+// Report collects the results of all checks.
+type Report struct {
+	Checks []Check
+}
+
+// Failed returns the number of failed checks.
+func (r *Report) Failed() int {
+	n := 0
+	for _, c := range r.Checks {
+		if c.Status == StatusFail {
+			n++
+		}
+	}
+	return n
+}
+
+// Options configures a verification run.
+type Options struct {
+	SrcFS     storage.FS
+	SrcDir    string
+	BackupFS  storage.FS
+	BackupDir string
+	Filter    *sync.Filter
+	// Transform is applied to source contents before comparing,
+	// so files redacted during backup still match.
+	Transform func(relPath string, data []byte) ([]byte, error)
+	// Git enables the checks against the backup repository at BackupDir.
+	Git bool
+	// GitDir is the root of the backup repository if BackupDir is a
+	// directory inside it, such as the data of one host.
+	GitDir string
+	// RestoreDrill restores the backup into a temporary directory and compares it.
+	RestoreDrill bool
+	// Sources are the directories backed up besides SrcDir.
+	Sources []Source
+}
+
+// Source is a directory backed up below Prefix of BackupDir.
+type Source struct {
+	Dir string
+	// Prefix is slash-separated.
+	Prefix string
+	Filter *sync.Filter
+}
+
+// sources returns SrcDir, backed up to BackupDir itself, and the others.
+func (opts Options) sources() []Source {
+	return append([]Source{{Dir: opts.SrcDir, Filter: opts.Filter}}, opts.Sources...)
+}
+
+// Run performs every check and returns the report.
+func Run(ctx context.Context, opts Options) *Report {
+	r := &Report{}
+	r.Checks = append(r.Checks, checkSource(opts))
+	if opts.Git {
+		r.Checks = append(r.Checks, checkHead(opts), checkFsck(opts), checkLFS(opts))
+	} else {
+		skip := "backup is not a git repository"
+		r.Checks = append(r.Checks,
+			Check{Name: "backup vs HEAD", Status: StatusSkip, Detail: skip},
+			Check{Name: "git fsck", Status: StatusSkip, Detail: skip},
+			Check{Name: "LFS objects", Status: StatusSkip, Detail: skip},
+		)
+	}
+	r.Checks = append(r.Checks, checkManifest(opts), checkJSONL(opts))
+	if opts.RestoreDrill {
+		r.Checks = append(r.Checks, checkRestoreDrill(ctx, opts))
+	}
+	return r
+}
+
+// newCheck finalizes a check from its problems.
+func newCheck(name, detail string, problems []string) Check {
+	c := Check{Name: name, Status: StatusPass, Detail: detail, Problems: problems}
+	if len(problems) > 0 {
+		c.Status = StatusFail
+	}
+	return c
+}
+
+// failed returns a check that could not run at all.
+func failed(name string, err error) Check {
+	return Check{Name: name, Status: StatusFail, Problems: []string{err.Error()}}
+}
+
+// listFiles returns the filtered files under root keyed by relative path.
+func listFiles(fsys storage.FS, root string, filter *sync.Filter) (map[string]string, []string, error) {
+	listed, err := sync.List(fsys, root, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := make(map[string]string, len(listed.Items))
+	for _, item := range listed.Items {
+		files[filepath.ToSlash(item.RelPath)] = item.SrcPath
+	}
+	var problems []string
+	for _, w := range listed.Warnings {
+		problems = append(problems, fmt.Sprintf("unreadable: %s: %v", w.RelPath, w.Err))
+	}
+	return files, problems, nil
+}
+
+// listSources lists the files of every source in the directory dir
+// returns for it, keyed by their path relative to the backup root.
+func listSources(fsys storage.FS, sources []Source, dir func(Source) string) (map[string]string, []string, error) {
+	files := map[string]string{}
+	var problems []string
+	for _, s := range sources {
+		listed, warnings, err := listFiles(fsys, dir(s), s.Filter)
+		if err != nil {
+			return nil, nil, err
+		}
+		for rel, p := range listed {
+			files[path.Join(s.Prefix, rel)] = p
+		}
+		problems = append(problems, warnings...)
+	}
+	return files, problems, nil
+}
+
+// below returns the directory of a source below root.
+func below(root string) func(Source) string {
+	return func(s Source) string {
+		return filepath.Join(root, filepath.FromSlash(s.Prefix))
+	}
+}
+
+// compare hashes every file in want against the file of the same
+// relative path in got and reports missing and differing files.
+func compare(want map[string]string, wantFS storage.FS, transform func(string, []byte) ([]byte, error),
+	got map[string]string, gotFS storage.FS) []string {
+	var problems []string
+	for _, rel := range sortedKeys(want) {
+		gotPath, ok := got[rel]
+		if !ok {
+			problems = append(problems, "missing: "+rel)
+			continue
+		}
+		wantSum, err := hashFile(wantFS, want[rel], rel, transform)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unreadable: %s: %v", rel, err))
+			continue
+		}
+		gotSum, err := hashFile(gotFS, gotPath, rel, nil)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unreadable: %s: %v", rel, err))
+			continue
+		}
+		if wantSum != gotSum {
+			problems = append(problems, "differs: "+rel)
+		}
+	}
+	return problems
+}
+
+// checkSource compares the sources with the backup by content hash.
+func checkSource(opts Options) Check {
+	const name = "source vs backup"
+	src, problems, err := listSources(opts.SrcFS, opts.sources(), func(s Source) string { return s.Dir })
+	if err != nil {
+		return failed(name, err)
+	}
+	backup, warnings, err := listSources(opts.BackupFS, opts.sources(), below(opts.BackupDir))
+	if err != nil {
+		return failed(name, err)
+	}
+	problems = append(problems, warnings...)
+	problems = append(problems, compare(src, opts.SrcFS, opts.Transform, backup, opts.BackupFS)...)
+	return newCheck(name, fmt.Sprintf("%d files", len(src)), problems)
+}
+
+// checkHead compares the backup working tree with the HEAD commit.
+func checkHead(opts Options) Check {
+	const name = "backup vs HEAD"
+	gitDir := opts.gitDir()
+	tree, err := git.NewTreeFS(gitDir, "HEAD")
+	if err != nil {
+		return failed(name, err)
+	}
+	prefix, err := filepath.Rel(gitDir, opts.BackupDir)
+	if err != nil {
+		return failed(name, err)
+	}
+	head, problems, err := listSources(tree, opts.sources(), below(prefix))
+	if err != nil {
+		return failed(name, err)
+	}
+	work, warnings, err := listSources(opts.BackupFS, opts.sources(), below(opts.BackupDir))
+	if err != nil {
+		return failed(name, err)
+	}
+	problems = append(problems, warnings...)
+	problems = append(problems, compare(work, opts.BackupFS, nil, head, tree)...)
+	for _, rel := range sortedKeys(head) {
+		if _, ok := work[rel]; !ok {
+			problems = append(problems, "deleted from working tree: "+rel)
+		}
+	}
+	return newCheck(name, fmt.Sprintf("%d files", len(head)), problems)
+}
+
+func (opts Options) gitDir() string {
+	if opts.GitDir != "" {
+		return opts.GitDir
+	}
+	return opts.BackupDir
+}
+
+// checkFsck runs git fsck on the backup repository.
+func checkFsck(opts Options) Check {
+	if err := git.NewGit(opts.gitDir()).Fsck(); err != nil {
+		return failed("git fsck", err)
+	}
+	return newCheck("git fsck", "", nil)
+}
+
+// checkLFS verifies that LFS objects referenced by HEAD are present.
+func checkLFS(opts Options) Check {
+	const name = "LFS objects"
+	attrs, err := os.ReadFile(filepath.Join(opts.gitDir(), ".gitattributes"))
+	if err != nil || !bytes.Contains(attrs, []byte("filter=lfs")) {
+		return Check{Name: name, Status: StatusSkip, Detail: "no LFS patterns tracked"}
+	}
+	lfs := git.NewLFS(opts.gitDir())
+	if !lfs.Available() {
+		return Check{Name: name, Status: StatusSkip, Detail: "git-lfs is not installed"}
+	}
+	if err := lfs.Fsck(); err != nil {
+		return failed(name, err)
+	}
+	return newCheck(name, "", nil)
+}
+
+// checkManifest compares the backup with the manifest written by the last backup.
+func checkManifest(opts Options) Check {
+	const name = "backup vs manifest"
+	m, err := manifest.Read(opts.BackupFS, filepath.Join(opts.BackupDir, manifest.Path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Check{Name: name, Status: StatusSkip, Detail: "no manifest"}
+	}
+	if err != nil {
+		return failed(name, err)
+	}
+
+	var problems []string
+	for _, e := range m.Files {
+		path := filepath.Join(opts.BackupDir, filepath.FromSlash(e.Path))
+		sum, err := storage.HashFile(opts.BackupFS, path, "sha256")
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			problems = append(problems, "missing: "+e.Path)
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("unreadable: %s: %v", e.Path, err))
+		case sum != e.SHA256:
+			problems = append(problems, "differs: "+e.Path)
+		}
+	}
+	for _, w := range m.Warnings {
+		problems = append(problems, fmt.Sprintf("not backed up: %s: %s", w.Path, w.Message))
+	}
+	return newCheck(name, fmt.Sprintf("%d files", len(m.Files)), problems)
+}
+
+// checkJSONL validates that every line of every *.jsonl file in the backup parses.
+func checkJSONL(opts Options) Check {
+	const name = "JSONL parse"
+	files, problems, err := listSources(opts.BackupFS, opts.sources(), below(opts.BackupDir))
+	if err != nil {
+		return failed(name, err)
+	}
+	count := 0
+	for _, rel := range sortedKeys(files) {
+		if filepath.Ext(rel) != ".jsonl" {
+			continue
+		}
+		count++
+		problems = append(problems, validateJSONL(opts.BackupFS, files[rel], rel)...)
+	}
+	return newCheck(name, fmt.Sprintf("%d files", count), problems)
+}
+
+// validateJSONL reports the lines of a file that are not valid JSON.
+func validateJSONL(fsys storage.FS, path, rel string) []string {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return []string{fmt.Sprintf("unreadable: %s: %v", rel, err)}
+	}
+	defer f.Close()
+
+	var problems []string
+	r := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && !json.Valid(trimmed) {
+			problems = append(problems, fmt.Sprintf("invalid JSON: %s:%d", rel, lineNo))
+		}
+		if errors.Is(err, io.EOF) {
+			return problems
+		}
+		if err != nil {
+			return append(problems, fmt.Sprintf("unreadable: %s: %v", rel, err))
+		}
+	}
+}
+
+// checkRestoreDrill restores the backup into a temporary directory
+// and compares the result with the backup.
+func checkRestoreDrill(ctx context.Context, opts Options) Check {
+	const name = "restore drill"
+	tmp, err := os.MkdirTemp("", "ccbackup-verify-*")
+	if err != nil {
+		return failed(name, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var problems []string
+	copied := 0
+	for _, s := range opts.sources() {
+		syncer := sync.NewSyncer(below(opts.BackupDir)(s), below(tmp)(s), nil)
+		syncer.SrcFS = opts.BackupFS
+		syncer.Filter = s.Filter
+		result, err := syncer.Execute(ctx)
+		if err != nil {
+			return failed(name, err)
+		}
+		copied += result.CopiedCount
+		for _, e := range result.Errors {
+			problems = append(problems, fmt.Sprintf("restore failed: %s: %v", path.Join(s.Prefix, filepath.ToSlash(e.RelPath)), e.Err))
+		}
+	}
+	backup, _, err := listSources(opts.BackupFS, opts.sources(), below(opts.BackupDir))
+	if err != nil {
+		return failed(name, err)
+	}
+	restoredFS := storage.NewOSFS()
+	restored, warnings, err := listSources(restoredFS, opts.sources(), below(tmp))
+	if err != nil {
+		return failed(name, err)
+	}
+	problems = append(problems, warnings...)
+	problems = append(problems, compare(backup, opts.BackupFS, nil, restored, restoredFS)...)
+	return newCheck(name, fmt.Sprintf("%d files", copied), problems)
+}
+
+// hashFile returns the SHA-256 of a file, after transform if set.
+func hashFile(fsys storage.FS, path, rel string, transform func(string, []byte) ([]byte, error)) (string, error) {
+	if transform == nil {
+		return storage.HashFile(fsys, path, "sha256")
+	}
+	data, err := storage.ReadFile(fsys, path)
+	if err != nil {
+		return "", err
+	}
+	if data, err = transform(rel, data); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
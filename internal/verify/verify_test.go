@@ -0,0 +1,155 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/takoeight0821/ccbackup/internal/git"
+	"github.com/takoeight0821/ccbackup/internal/manifest"
+	"github.com/takoeight0821/ccbackup/internal/storage"
+	"github.com/takoeight0821/ccbackup/internal/sync"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// setup creates a source dir and a committed backup repository with the same files.
+func setup(t *testing.T) Options {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	srcDir := t.TempDir()
+	backupDir := t.TempDir()
+	for _, dir := range []string{srcDir, backupDir} {
+		writeFile(t, filepath.Join(dir, "history.jsonl"), "{\"a\":1}\n{\"b\":2}\n")
+		writeFile(t, filepath.Join(dir, "projects", "p", "s.jsonl"), "{}\n")
+	}
+	g := git.NewGit(backupDir)
+	require.NoError(t, g.Init())
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("backup"))
+
+	return Options{
+		SrcFS:     storage.NewOSFS(),
+		SrcDir:    srcDir,
+		BackupFS:  storage.NewOSFS(),
+		BackupDir: backupDir,
+		Filter:    sync.NewFilter([]string{"history.jsonl", "projects"}),
+		Git:       true,
+	}
+}
+
+func findCheck(t *testing.T, r *Report, name string) Check {
+	t.Helper()
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("check %q not found", name)
+	return Check{}
+}
+
+func TestRun_Pass(t *testing.T) {
+	opts := setup(t)
+	opts.RestoreDrill = true
+
+	r := Run(context.Background(), opts)
+
+	assert.Equal(t, 0, r.Failed(), "%+v", r.Checks)
+	assert.Equal(t, StatusPass, findCheck(t, r, "restore drill").Status)
+	assert.Equal(t, StatusSkip, findCheck(t, r, "LFS objects").Status)
+}
+
+func TestRun_SourceChanged(t *testing.T) {
+	opts := setup(t)
+	writeFile(t, filepath.Join(opts.SrcDir, "history.jsonl"), "{\"changed\":true}\n")
+	writeFile(t, filepath.Join(opts.SrcDir, "projects", "p", "new.jsonl"), "{}\n")
+
+	r := Run(context.Background(), opts)
+
+	c := findCheck(t, r, "source vs backup")
+	assert.Equal(t, StatusFail, c.Status)
+	assert.Equal(t, []string{"differs: history.jsonl", "missing: projects/p/new.jsonl"}, c.Problems)
+}
+
+func TestRun_Sources(t *testing.T) {
+	opts := setup(t)
+	homeDir := t.TempDir()
+	writeFile(t, filepath.Join(homeDir, ".claude.json"), "{}")
+	writeFile(t, filepath.Join(opts.BackupDir, "home", ".claude.json"), "{}")
+	writeFile(t, filepath.Join(opts.BackupDir, "home", "broken.jsonl"), "{broken\n")
+	g := git.NewGit(opts.BackupDir)
+	require.NoError(t, g.AddAll())
+	require.NoError(t, g.Commit("sources"))
+	opts.Sources = []Source{{Dir: homeDir, Prefix: "home", Filter: sync.NewFilter([]string{".claude.json", "broken.jsonl"})}}
+	opts.RestoreDrill = true
+
+	r := Run(context.Background(), opts)
+	assert.Equal(t, StatusPass, findCheck(t, r, "backup vs HEAD").Status)
+	assert.Equal(t, StatusPass, findCheck(t, r, "restore drill").Status)
+	assert.Equal(t, []string{"invalid JSON: home/broken.jsonl:1"}, findCheck(t, r, "JSONL parse").Problems)
+
+	writeFile(t, filepath.Join(homeDir, ".claude.json"), "{\"changed\":true}")
+	r = Run(context.Background(), opts)
+	assert.Equal(t, []string{"differs: home/.claude.json"}, findCheck(t, r, "source vs backup").Problems)
+}
+
+func TestRun_UncommittedAndInvalidJSONL(t *testing.T) {
+	opts := setup(t)
+	writeFile(t, filepath.Join(opts.BackupDir, "history.jsonl"), "{\"a\":1}\n{broken\n")
+	require.NoError(t, os.Remove(filepath.Join(opts.BackupDir, "projects", "p", "s.jsonl")))
+
+	r := Run(context.Background(), opts)
+
+	head := findCheck(t, r, "backup vs HEAD")
+	assert.Equal(t, StatusFail, head.Status)
+	assert.Equal(t, []string{"differs: history.jsonl", "deleted from working tree: projects/p/s.jsonl"}, head.Problems)
+
+	jsonl := findCheck(t, r, "JSONL parse")
+	assert.Equal(t, []string{"invalid JSON: history.jsonl:2"}, jsonl.Problems)
+}
+
+func TestRun_Transform(t *testing.T) {
+	opts := setup(t)
+	writeFile(t, filepath.Join(opts.SrcDir, "history.jsonl"), "{\"a\":\"secret\"}\n")
+	writeFile(t, filepath.Join(opts.BackupDir, "history.jsonl"), "{\"a\":\"xxx\"}\n")
+	opts.Git = false
+	opts.Transform = func(relPath string, data []byte) ([]byte, error) {
+		return bytes.ReplaceAll(data, []byte("secret"), []byte("xxx")), nil
+	}
+
+	r := Run(context.Background(), opts)
+
+	assert.Equal(t, StatusPass, findCheck(t, r, "source vs backup").Status)
+	assert.Equal(t, StatusSkip, findCheck(t, r, "git fsck").Status)
+}
+
+func TestRun_Manifest(t *testing.T) {
+	opts := setup(t)
+	assert.Equal(t, StatusSkip, findCheck(t, Run(context.Background(), opts), "backup vs manifest").Status)
+
+	m, err := manifest.Build(opts.BackupFS, opts.BackupDir, opts.Filter, nil)
+	require.NoError(t, err)
+	m.Warnings = []manifest.Warning{{Path: "projects/p/locked.jsonl", Message: "permission denied"}}
+	require.NoError(t, m.Write(opts.BackupFS, filepath.Join(opts.BackupDir, manifest.Path)))
+	writeFile(t, filepath.Join(opts.BackupDir, "history.jsonl"), "{}\n")
+
+	c := findCheck(t, Run(context.Background(), opts), "backup vs manifest")
+	assert.Equal(t, StatusFail, c.Status)
+	assert.Equal(t, []string{
+		"differs: history.jsonl",
+		"not backed up: projects/p/locked.jsonl: permission denied",
+	}, c.Problems)
+}